@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// adminConfig is the part of the configuration the admin API can change at runtime.
+type adminConfig struct {
+	FilterSampleTypes                []string `json:"filter_sample_types"`
+	FilterExecutableNames            []string `json:"filter_executable_names"`
+	FilterScopeNames                 []string `json:"filter_scope_names"`
+	IgnoreProfilesWithoutContainerID bool     `json:"ignore_profiles_without_container_id"`
+	ExportResourceAttributes         bool     `json:"export_resource_attributes"`
+	ExportProfileAttributes          bool     `json:"export_profile_attributes"`
+	ExportSampleAttributes           bool     `json:"export_sample_attributes"`
+	ExportStackFrames                bool     `json:"export_stack_frames"`
+	ExportStackFrameTypes            []string `json:"export_stack_frame_types"`
+	MaxAttributeLength               int      `json:"max_attribute_length"`
+	MaxStackDepth                    int      `json:"max_stack_depth"`
+	// Paused is read-only, see /admin/pause and /admin/resume.
+	Paused bool `json:"paused"`
+}
+
+func (f *profilesServer) adminConfig() adminConfig {
+	c := f.currentConfig()
+	return adminConfig{
+		FilterSampleTypes:                c.FilterSampleTypes,
+		FilterExecutableNames:            c.FilterExecutableNames,
+		FilterScopeNames:                 c.FilterScopeNames,
+		IgnoreProfilesWithoutContainerID: c.IgnoreProfilesWithoutContainerID,
+		ExportResourceAttributes:         c.ExportResourceAttributes,
+		ExportProfileAttributes:          c.ExportProfileAttributes,
+		ExportSampleAttributes:           c.ExportSampleAttributes,
+		ExportStackFrames:                c.ExportStackFrames,
+		ExportStackFrameTypes:            c.ExportStackFrameTypes,
+		MaxAttributeLength:               c.MaxAttributeLength,
+		MaxStackDepth:                    c.MaxStackDepth,
+		Paused:                           f.paused.Load(),
+	}
+}
+
+// registerAdminHandlers adds the endpoints controlling the running server. Configuration
+// changes apply to the dump output, the HTTP API and the sinks resolving profiles, which read
+// the current configuration for every request. Pausing only stops the dump output.
+func (f *profilesServer) registerAdminHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/config", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, f.adminConfig())
+	})
+	mux.HandleFunc("POST /admin/config", f.handleAdminConfig)
+	mux.HandleFunc("POST /admin/pause", func(w http.ResponseWriter, r *http.Request) {
+		f.paused.Store(true)
+		f.log.Info("paused dumping")
+		writeJSON(w, f.adminConfig())
+	})
+	mux.HandleFunc("POST /admin/resume", func(w http.ResponseWriter, r *http.Request) {
+		f.paused.Store(false)
+		f.log.Info("resumed dumping")
+		writeJSON(w, f.adminConfig())
+	})
+	mux.HandleFunc("POST /admin/rotate", func(w http.ResponseWriter, r *http.Request) {
+		if err := f.rotateOutput(); err != nil {
+			http.Error(w, fmt.Sprintf("error rotating output: %v", err), http.StatusInternalServerError)
+			return
+		}
+		f.log.Info("rotated output")
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// rotateOutput rotates the output file and the files of the split output.
+func (f *profilesServer) rotateOutput() error {
+	outputs := []any{f.out}
+	if f.split != nil {
+		outputs = append(outputs, f.split)
+	}
+	var errs []error
+	rotated := false
+	for _, out := range outputs {
+		if r, ok := out.(interface{ Rotate() error }); ok {
+			rotated = true
+			errs = append(errs, r.Rotate())
+		}
+	}
+	if !rotated {
+		return errors.New("the output is no file")
+	}
+	return errors.Join(errs...)
+}
+
+// handleAdminConfig applies the fields set in the body to the configuration, all others keep
+// their value.
+func (f *profilesServer) handleAdminConfig(w http.ResponseWriter, r *http.Request) {
+	update := f.adminConfig()
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&update); err != nil {
+		http.Error(w, fmt.Sprintf("invalid configuration: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := dump.ValidateScopePatterns(update.FilterScopeNames); err != nil {
+		http.Error(w, fmt.Sprintf("invalid configuration: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	f.configMu.Lock()
+	f.config.FilterSampleTypes = update.FilterSampleTypes
+	f.config.FilterExecutableNames = update.FilterExecutableNames
+	f.config.FilterScopeNames = update.FilterScopeNames
+	f.config.IgnoreProfilesWithoutContainerID = update.IgnoreProfilesWithoutContainerID
+	f.config.ExportResourceAttributes = update.ExportResourceAttributes
+	f.config.ExportProfileAttributes = update.ExportProfileAttributes
+	f.config.ExportSampleAttributes = update.ExportSampleAttributes
+	f.config.ExportStackFrames = update.ExportStackFrames
+	f.config.ExportStackFrameTypes = update.ExportStackFrameTypes
+	f.config.MaxAttributeLength = update.MaxAttributeLength
+	f.config.MaxStackDepth = update.MaxStackDepth
+	f.configMu.Unlock()
+
+	config := f.adminConfig()
+	f.log.Info("changed configuration", slog.Any("config", config))
+	writeJSON(w, config)
+}
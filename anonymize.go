@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// anonymizedAttributes are the attributes identifying infrastructure, whose values get
+// pseudonymized.
+var anonymizedAttributes = map[string]bool{
+	"host.name":               true,
+	"host.id":                 true,
+	"host.ip":                 true,
+	"host.mac":                true,
+	"container.id":            true,
+	"container.name":          true,
+	"container.image.name":    true,
+	"k8s.cluster.name":        true,
+	"k8s.node.name":           true,
+	"k8s.namespace.name":      true,
+	"k8s.pod.name":            true,
+	"k8s.pod.uid":             true,
+	"k8s.deployment.name":     true,
+	"k8s.container.name":      true,
+	"process.command":         true,
+	"process.command_line":    true,
+	"process.command_args":    true,
+	"process.executable.path": true,
+	"process.owner":           true,
+	"service.instance.id":     true,
+	"cloud.account.id":        true,
+	"cloud.resource_id":       true,
+}
+
+// anonymizer consistently replaces identifying values with a keyed hash, so dumps can be
+// shared without leaking infrastructure details. Equal values map to equal pseudonyms, which
+// keeps the structure of the profiles intact.
+type anonymizer struct {
+	key []byte
+}
+
+// newAnonymizer returns an anonymizer using the given key, or a random one if it's empty. With
+// a random key, pseudonyms are only consistent for the lifetime of the process.
+func newAnonymizer(key string) *anonymizer {
+	k := []byte(key)
+	if len(k) == 0 {
+		k = make([]byte, 32)
+		rand.Read(k)
+	}
+	return &anonymizer{key: k}
+}
+
+func (a *anonymizer) pseudonym(s string) string {
+	if s == "" {
+		return s
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(s))
+	return hex.EncodeToString(mac.Sum(nil)[:6])
+}
+
+// path pseudonymizes every component of a file path, keeping the separators and the file
+// extension, e.g. /usr/lib/libc.so.6 becomes /1a2b3c4d5e6f/.../0a1b2c3d4e5f.so.6.
+func (a *anonymizer) path(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		name, ext := part, ""
+		if i == len(parts)-1 {
+			if j := strings.IndexByte(part[1:], '.'); j >= 0 {
+				name, ext = part[:j+1], part[j+1:]
+			}
+		}
+		parts[i] = a.pseudonym(name) + ext
+	}
+	return strings.Join(parts, "/")
+}
+
+func (a *anonymizer) anonymize(pd pprofile.Profiles) {
+	rangeAttributes(pd, func(key string, v pcommon.Value) {
+		if !anonymizedAttributes[key] {
+			return
+		}
+		switch v.Type() {
+		case pcommon.ValueTypeSlice:
+			s := v.Slice()
+			for i := 0; i < s.Len(); i++ {
+				s.At(i).SetStr(a.pseudonym(s.At(i).AsString()))
+			}
+		default:
+			v.SetStr(a.pseudonym(v.AsString()))
+		}
+	})
+
+	// File names are only referenced from the string table, so they are replaced there.
+	dict := pd.Dictionary()
+	stringTable := dict.StringTable()
+	paths := map[int32]bool{}
+	for i := 0; i < dict.FunctionTable().Len(); i++ {
+		paths[dict.FunctionTable().At(i).FilenameStrindex()] = true
+	}
+	for i := 0; i < dict.MappingTable().Len(); i++ {
+		paths[dict.MappingTable().At(i).FilenameStrindex()] = true
+	}
+	for idx := range paths {
+		if idx <= 0 || int(idx) >= stringTable.Len() {
+			continue
+		}
+		stringTable.SetAt(int(idx), a.path(stringTable.At(int(idx))))
+	}
+}
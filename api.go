@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// newAPIHandler returns the handler of the HTTP API, which gives access to what the server has
+// received.
+func newAPIHandler(srv *profilesServer) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/stream", srv.stream)
+	mux.HandleFunc("GET /api/profiles", srv.handleListProfiles)
+	mux.HandleFunc("GET /api/profiles/{id}", srv.handleGetProfile)
+	mux.HandleFunc("GET /api/profiles/{id}/pprof", srv.handleGetProfilePprof)
+	mux.HandleFunc("GET /api/profiles/{id}/chrome-trace", srv.handleGetProfileChromeTrace)
+	mux.HandleFunc("GET /api/stats", srv.handleStats)
+	mux.HandleFunc("GET /api/traces", srv.handleListTraces)
+	mux.HandleFunc("GET /api/traces/{trace_id}", srv.handleGetTrace)
+	mux.HandleFunc("GET /api/rollups", srv.handleListRollups)
+	mux.HandleFunc("GET /api/rollups/series", srv.handleGetRollupSeries)
+	mux.HandleFunc("GET /api/attributes", srv.handleAttributeStats)
+	srv.registerHealthHandlers(mux)
+	if srv.adminAPI {
+		srv.registerAdminHandlers(mux)
+	}
+	return mux
+}
+
+// profileSummary is the list representation of a retained profile.
+type profileSummary struct {
+	Seq        int64             `json:"seq"`
+	ProfileID  string            `json:"profile_id"`
+	ReceivedAt time.Time         `json:"received_at"`
+	Time       time.Time         `json:"time"`
+	Duration   time.Duration     `json:"duration"`
+	SampleType string            `json:"sample_type"`
+	Samples    int               `json:"samples"`
+	Scope      string            `json:"scope,omitempty"`
+	Resource   map[string]string `json:"resource,omitempty"`
+}
+
+func (f *profilesServer) handleListProfiles(w http.ResponseWriter, r *http.Request) {
+	if f.ring == nil {
+		http.Error(w, "profile retention is disabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	entries := f.ring.list()
+	summaries := make([]profileSummary, 0, len(entries))
+	for _, e := range entries {
+		summaries = append(summaries, profileSummary{
+			Seq:        e.Seq,
+			ProfileID:  e.View.Profile.ProfileID,
+			ReceivedAt: e.ReceivedAt,
+			Time:       e.View.Profile.Time,
+			Duration:   e.View.Profile.Duration,
+			SampleType: e.View.Profile.SampleType,
+			Samples:    len(e.View.Profile.Samples),
+			Scope:      e.View.Scope.Name,
+			Resource:   e.View.Resource.Attributes,
+		})
+	}
+
+	writeJSON(w, summaries)
+}
+
+func (f *profilesServer) handleGetProfile(w http.ResponseWriter, r *http.Request) {
+	entry, ok := f.lookupProfile(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, entry)
+}
+
+func (f *profilesServer) handleGetProfilePprof(w http.ResponseWriter, r *http.Request) {
+	entry, ok := f.lookupProfile(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("profile-%d.pb.gz", entry.Seq)))
+	if err := toPprof(entry.View).Write(w); err != nil {
+		f.log.Error("error writing pprof", slog.Any("error", err.Error()))
+	}
+}
+
+// serverStats are the counters of the running server.
+type serverStats struct {
+	Uptime           time.Duration `json:"uptime"`
+	Requests         int64         `json:"requests"`
+	ResourceProfiles int64         `json:"resource_profiles"`
+	Resources        int           `json:"resources"`
+	Profiles         int64         `json:"profiles"`
+	Samples          int64         `json:"samples"`
+	DumpQueueDepth   int           `json:"dump_queue_depth"`
+	DumpsDropped     int64         `json:"dumps_dropped"`
+	RequestsRejected int64         `json:"requests_rejected"`
+	CorruptRequests  int64         `json:"corrupt_requests"`
+	BadStringTables  int64         `json:"bad_string_tables"`
+	InFlightBytes    int64         `json:"in_flight_bytes,omitempty"`
+	// Compression are the request sizes by compression algorithm.
+	Compression map[string]compressionTotals `json:"compression,omitempty"`
+	// Dropped are the dropped counts reported by senders, by resource.
+	Dropped map[string]droppedCounts `json:"dropped,omitempty"`
+}
+
+func (f *profilesServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, f.serverStats())
+}
+
+func (f *profilesServer) serverStats() serverStats {
+	stats := serverStats{
+		Uptime:           time.Since(f.stats.started),
+		Requests:         f.stats.requests.Load(),
+		ResourceProfiles: f.stats.resourceProfiles.Load(),
+		Resources:        f.resources.Len(),
+		Profiles:         f.stats.profiles.Load(),
+		Samples:          f.stats.samples.Load(),
+		DumpsDropped:     f.stats.dumpsDropped.Load(),
+		RequestsRejected: f.stats.requestsRejected.Load(),
+		CorruptRequests:  f.stats.corruptRequests.Load(),
+		BadStringTables:  f.stats.stringTableIssues.Load(),
+		Compression:      f.stats.compressionSnapshot(),
+		Dropped:          f.dropped.snapshot(),
+	}
+	if f.memory != nil {
+		stats.InFlightBytes = f.memory.inFlight.Load()
+	}
+	if f.queue != nil {
+		stats.DumpQueueDepth = f.queue.depth()
+	}
+	return stats
+}
+
+// lookupProfile resolves the {id} path value, which is either the sequence number assigned by
+// the server or the hex encoded profile ID.
+func (f *profilesServer) lookupProfile(w http.ResponseWriter, r *http.Request) (storedProfile, bool) {
+	if f.ring == nil {
+		http.Error(w, "profile retention is disabled", http.StatusServiceUnavailable)
+		return storedProfile{}, false
+	}
+
+	id := r.PathValue("id")
+	seq, seqErr := strconv.ParseInt(id, 10, 64)
+	entry, ok := f.ring.get(func(e storedProfile) bool {
+		return (seqErr == nil && e.Seq == seq) || e.View.Profile.ProfileID == id
+	})
+	if !ok {
+		http.Error(w, fmt.Sprintf("profile %q not found", id), http.StatusNotFound)
+		return storedProfile{}, false
+	}
+	return entry, true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"google.golang.org/grpc"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// assertion checks received profiles against a set of expectations. A profile matches, if
+// it satisfies every configured expectation.
+type assertion struct {
+	ExpectedProfiles      int
+	ExpectedFrameTypes    []string
+	ExpectedSampleTypes   []string
+	ExpectedResourceAttrs map[string]string
+
+	mu       sync.Mutex
+	matched  int
+	received int
+	// What was actually seen, reported in case the assertion fails.
+	seenFrameTypes    map[string]int
+	seenSampleTypes   map[string]int
+	seenResourceAttrs map[string]map[string]int
+
+	met     chan struct{}
+	metOnce sync.Once
+}
+
+func newAssertion() *assertion {
+	return &assertion{
+		ExpectedProfiles:      1,
+		ExpectedResourceAttrs: map[string]string{},
+		seenFrameTypes:        map[string]int{},
+		seenSampleTypes:       map[string]int{},
+		seenResourceAttrs:     map[string]map[string]int{},
+		met:                   make(chan struct{}),
+	}
+}
+
+// Met returns a channel that is closed once enough matching profiles have been received.
+func (a *assertion) Met() <-chan struct{} {
+	return a.met
+}
+
+func (a *assertion) observe(pd pprofile.Profiles) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	dict := pd.Dictionary()
+	lookup := dump.NewLookup(dict)
+
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rp := rps.At(i)
+
+		resourceMatches := true
+		for key, expected := range a.ExpectedResourceAttrs {
+			value := ""
+			if v, ok := rp.Resource().Attributes().Get(key); ok {
+				value = v.AsString()
+				if a.seenResourceAttrs[key] == nil {
+					a.seenResourceAttrs[key] = map[string]int{}
+				}
+				a.seenResourceAttrs[key][value]++
+			}
+			if value != expected {
+				resourceMatches = false
+			}
+		}
+
+		sps := rp.ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			pcs := sps.At(j).Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				profile := pcs.At(k)
+				a.received++
+
+				sampleType := lookup.String(profile.SampleType().TypeStrindex())
+				a.seenSampleTypes[sampleType]++
+
+				frameTypes := map[string]struct{}{}
+				samples := profile.Samples()
+				for l := 0; l < samples.Len(); l++ {
+					stack, ok := lookup.Stack(samples.At(l).StackIndex())
+					if !ok {
+						continue
+					}
+					for _, locationIdx := range stack.LocationIndices().All() {
+						if location, ok := lookup.Location(locationIdx); ok {
+							frameTypes[dump.FrameType(dict, location)] = struct{}{}
+						}
+					}
+				}
+				for frameType := range frameTypes {
+					a.seenFrameTypes[frameType]++
+				}
+
+				if !resourceMatches {
+					continue
+				}
+				if len(a.ExpectedSampleTypes) > 0 && !slices.Contains(a.ExpectedSampleTypes, sampleType) {
+					continue
+				}
+				if !hasAllKeys(frameTypes, a.ExpectedFrameTypes) {
+					continue
+				}
+
+				a.matched++
+			}
+		}
+	}
+
+	if a.matched >= a.ExpectedProfiles {
+		a.metOnce.Do(func() {
+			close(a.met)
+		})
+	}
+}
+
+func hasAllKeys(m map[string]struct{}, keys []string) bool {
+	for _, k := range keys {
+		if _, ok := m[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (a *assertion) printReport(w io.Writer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	fmt.Fprintln(w, "-------------------- Assertion --------------------")
+	fmt.Fprintf(w, "  Expected matching profiles: %d\n", a.ExpectedProfiles)
+	if len(a.ExpectedFrameTypes) > 0 {
+		fmt.Fprintf(w, "  Expected frame types: %s\n", strings.Join(a.ExpectedFrameTypes, ", "))
+	}
+	if len(a.ExpectedSampleTypes) > 0 {
+		fmt.Fprintf(w, "  Expected sample types: %s\n", strings.Join(a.ExpectedSampleTypes, ", "))
+	}
+	for _, key := range slices.Sorted(maps.Keys(a.ExpectedResourceAttrs)) {
+		fmt.Fprintf(w, "  Expected resource attribute: %s=%s\n", key, a.ExpectedResourceAttrs[key])
+	}
+	fmt.Fprintf(w, "  Received profiles: %d\n", a.received)
+	fmt.Fprintf(w, "  Matching profiles: %d\n", a.matched)
+	fmt.Fprintln(w, "  Seen frame types (profiles):")
+	printCounts(w, a.seenFrameTypes)
+	fmt.Fprintln(w, "  Seen sample types (profiles):")
+	printCounts(w, a.seenSampleTypes)
+	for _, key := range slices.Sorted(maps.Keys(a.ExpectedResourceAttrs)) {
+		fmt.Fprintf(w, "  Seen values for resource attribute %s (resource profiles):\n", key)
+		printCounts(w, a.seenResourceAttrs[key])
+	}
+	fmt.Fprintln(w, "---------------------------------------------------")
+}
+
+func printCounts(w io.Writer, counts map[string]int) {
+	if len(counts) == 0 {
+		fmt.Fprintln(w, "    <none>")
+		return
+	}
+	for _, k := range slices.Sorted(maps.Keys(counts)) {
+		fmt.Fprintf(w, "    %s: %d\n", k, counts[k])
+	}
+}
+
+// runAssert starts the server and waits until the configured expectations are met. It returns
+// the exit code of the process.
+func runAssert(args []string) int {
+	fs := flag.NewFlagSet("assert", flag.ExitOnError)
+	port := fs.Int("port", 4137, "port to listen on, ignored if -listen is set")
+	listen := fs.String("listen", "", "host:port to listen on (default 127.0.0.1:<port>)")
+	timeout := fs.Duration("timeout", 60*time.Second, "time to wait for the expectations to be met")
+	dumpProfiles := fs.Bool("dump", false, "dump received profiles while waiting")
+	var frameTypes, sampleTypes, resourceAttrs stringSliceFlag
+	fs.Var(&frameTypes, "expect-frame-type", "frame type a matching profile must contain (repeatable)")
+	fs.Var(&sampleTypes, "expect-sample-type", "sample type a matching profile must have (repeatable, any of)")
+	fs.Var(&resourceAttrs, "expect-resource-attr", "key=value resource attribute a matching profile must have (repeatable)")
+	expectedProfiles := fs.Int("expect-profiles", 1, "number of matching profiles required")
+	var limits grpcLimits
+	limits.registerFlags(fs)
+	fs.Parse(args)
+
+	a := newAssertion()
+	a.ExpectedProfiles = *expectedProfiles
+	a.ExpectedFrameTypes = frameTypes
+	a.ExpectedSampleTypes = sampleTypes
+	for _, attr := range resourceAttrs {
+		key, value, ok := strings.Cut(attr, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "invalid resource attribute expectation %q, expected key=value\n", attr)
+			return 2
+		}
+		a.ExpectedResourceAttrs[key] = value
+	}
+
+	srv := newProfilesServer(Config{
+		Config: dump.Config{
+			ExportResourceAttributes: true,
+			ExportProfileAttributes:  true,
+			ExportSampleAttributes:   true,
+			ExportStackFrames:        true,
+		},
+	})
+	srv.assertion = a
+	srv.dumpDisabled = !*dumpProfiles
+
+	s := grpc.NewServer(append(limits.serverOptions(), grpc.StatsHandler(&requestInfoHandler{}))...)
+	registerServices(s, srv)
+
+	lis, err := net.Listen("tcp", listenAddress(*listen, *port))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error creating listener: %v\n", err)
+		return 2
+	}
+	go s.Serve(lis)
+	defer s.GracefulStop()
+
+	fmt.Fprintln(os.Stderr, "GRPC server started at ", lis.Addr().String())
+
+	select {
+	case <-a.Met():
+		a.printReport(os.Stdout)
+		fmt.Println("assertion met")
+		return 0
+	case <-time.After(*timeout):
+		a.printReport(os.Stdout)
+		fmt.Printf("assertion not met within %v\n", *timeout)
+		return 1
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// attributeExamples is the number of distinct example values kept per attribute key, and
+// attributeExampleLength the length they are truncated to.
+const (
+	attributeExamples      = 3
+	attributeExampleLength = 64
+)
+
+// attributeLevels are where attributes are found, in report order.
+var attributeLevels = []string{"resource", "profile", "sample", "location"}
+
+// attributeKeyStats describes an attribute key seen at a level.
+type attributeKeyStats struct {
+	Level    string   `json:"level"`
+	Key      string   `json:"key"`
+	Count    int64    `json:"count"`
+	Types    []string `json:"types"`
+	Examples []string `json:"examples"`
+}
+
+// attributeStats records every attribute key seen at the resource, profile, sample and
+// location level with its occurrences and a few example values, to find out what an
+// unfamiliar sender emits.
+type attributeStats struct {
+	mu   sync.Mutex
+	keys map[[2]string]*attributeKeyStats
+}
+
+func newAttributeStats() *attributeStats {
+	return &attributeStats{keys: map[[2]string]*attributeKeyStats{}}
+}
+
+func (s *attributeStats) record(pd pprofile.Profiles) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dict := pd.Dictionary()
+	lookup := dump.NewLookup(dict)
+	recordIndices := func(level string, indices pcommon.Int32Slice) {
+		for _, idx := range indices.All() {
+			if attr, ok := lookup.Attribute(idx); ok {
+				s.add(level, lookup.String(attr.KeyStrindex()), attr.Value())
+			}
+		}
+	}
+
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rps.At(i).Resource().Attributes().Range(func(k string, v pcommon.Value) bool {
+			s.add("resource", k, v)
+			return true
+		})
+		sps := rps.At(i).ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			pcs := sps.At(j).Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				recordIndices("profile", pcs.At(k).AttributeIndices())
+				for _, sample := range pcs.At(k).Samples().All() {
+					recordIndices("sample", sample.AttributeIndices())
+				}
+			}
+		}
+	}
+	for _, location := range dict.LocationTable().All() {
+		recordIndices("location", location.AttributeIndices())
+	}
+}
+
+func (s *attributeStats) add(level, key string, value pcommon.Value) {
+	ks, ok := s.keys[[2]string{level, key}]
+	if !ok {
+		ks = &attributeKeyStats{Level: level, Key: key}
+		s.keys[[2]string{level, key}] = ks
+	}
+	ks.Count++
+	if t := value.Type().String(); !slices.Contains(ks.Types, t) {
+		ks.Types = append(ks.Types, t)
+	}
+	if len(ks.Examples) < attributeExamples {
+		example := value.AsString()
+		if len(example) > attributeExampleLength {
+			example = example[:attributeExampleLength] + "..."
+		}
+		if !slices.Contains(ks.Examples, example) {
+			ks.Examples = append(ks.Examples, example)
+		}
+	}
+}
+
+// snapshot returns the keys ordered by level and key.
+func (s *attributeStats) snapshot() []attributeKeyStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]attributeKeyStats, 0, len(s.keys))
+	for _, ks := range s.keys {
+		c := *ks
+		c.Types = slices.Clone(ks.Types)
+		c.Examples = slices.Clone(ks.Examples)
+		out = append(out, c)
+	}
+	slices.SortFunc(out, func(a, b attributeKeyStats) int {
+		return cmp.Or(cmp.Compare(slices.Index(attributeLevels, a.Level), slices.Index(attributeLevels, b.Level)),
+			cmp.Compare(a.Key, b.Key))
+	})
+	return out
+}
+
+func (s *attributeStats) printSummary(w io.Writer) {
+	keys := s.snapshot()
+	if len(keys) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "----------------- Attribute keys ------------------")
+	level := ""
+	for _, ks := range keys {
+		if ks.Level != level {
+			level = ks.Level
+			fmt.Fprintf(w, "  %s:\n", level)
+		}
+		examples := make([]string, len(ks.Examples))
+		for i, example := range ks.Examples {
+			examples[i] = fmt.Sprintf("%q", example)
+		}
+		fmt.Fprintf(w, "    %s (%s): %d times, e.g. %s\n", ks.Key, strings.Join(ks.Types, "|"), ks.Count, strings.Join(examples, ", "))
+	}
+	fmt.Fprintln(w, "---------------------------------------------------")
+}
+
+func (f *profilesServer) handleAttributeStats(w http.ResponseWriter, r *http.Request) {
+	if f.attributeStats == nil {
+		http.Error(w, "attribute statistics are disabled, set -attribute-stats", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, f.attributeStats.snapshot())
+}
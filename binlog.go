@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	binlogpb "google.golang.org/grpc/binarylog/grpc_binarylog_v1"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// binaryLogHandler is a stats.Handler writing every RPC to a file in the gRPC binary log
+// format, that is GrpcLogEntry messages prefixed by their length as big endian uint32. The
+// binary logger built into grpc-go can only be enabled via an environment variable, which is
+// why the entries are assembled here.
+type binaryLogHandler struct {
+	log *slog.Logger
+	// codec encodes the messages like the server does, see serverCodec.
+	codec encoding.CodecV2
+	calls atomic.Uint64
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+type binaryLogKey struct{}
+
+// binaryLogCall is the state of a single logged RPC.
+type binaryLogCall struct {
+	id      uint64
+	seq     atomic.Uint64
+	trailer atomic.Pointer[metadata.MD]
+}
+
+func newBinaryLogHandler(log *slog.Logger, path string) (*binaryLogHandler, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &binaryLogHandler{
+		log:   log,
+		codec: newServerCodec(),
+		f:     f,
+	}, nil
+}
+
+func (h *binaryLogHandler) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.f.Close()
+}
+
+func (h *binaryLogHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, binaryLogKey{}, &binaryLogCall{id: h.calls.Add(1)})
+}
+
+func (h *binaryLogHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	call, ok := ctx.Value(binaryLogKey{}).(*binaryLogCall)
+	if !ok || s.IsClient() {
+		return
+	}
+
+	entry := &binlogpb.GrpcLogEntry{
+		Logger: binlogpb.GrpcLogEntry_LOGGER_SERVER,
+	}
+	switch s := s.(type) {
+	case *stats.InHeader:
+		entry.Type = binlogpb.GrpcLogEntry_EVENT_TYPE_CLIENT_HEADER
+		entry.Payload = &binlogpb.GrpcLogEntry_ClientHeader{ClientHeader: &binlogpb.ClientHeader{
+			Metadata:   binaryLogMetadata(s.Header),
+			MethodName: s.FullMethod,
+			Authority:  firstValue(s.Header, ":authority"),
+		}}
+		entry.Peer = binaryLogAddress(s.RemoteAddr)
+	case *stats.InPayload:
+		entry.Type = binlogpb.GrpcLogEntry_EVENT_TYPE_CLIENT_MESSAGE
+		entry.Payload = &binlogpb.GrpcLogEntry_Message{Message: h.message(s.Payload)}
+	case *stats.OutHeader:
+		entry.Type = binlogpb.GrpcLogEntry_EVENT_TYPE_SERVER_HEADER
+		entry.Payload = &binlogpb.GrpcLogEntry_ServerHeader{ServerHeader: &binlogpb.ServerHeader{
+			Metadata: binaryLogMetadata(s.Header),
+		}}
+	case *stats.OutPayload:
+		entry.Type = binlogpb.GrpcLogEntry_EVENT_TYPE_SERVER_MESSAGE
+		entry.Payload = &binlogpb.GrpcLogEntry_Message{Message: h.message(s.Payload)}
+	case *stats.OutTrailer:
+		// The status is only known at the end of the RPC, so the trailer gets written then.
+		call.trailer.Store(&s.Trailer)
+		return
+	case *stats.End:
+		st := status.Convert(s.Error)
+		trailer := &binlogpb.Trailer{
+			StatusCode:    uint32(st.Code()),
+			StatusMessage: st.Message(),
+		}
+		if md := call.trailer.Load(); md != nil {
+			trailer.Metadata = binaryLogMetadata(*md)
+		}
+		if len(st.Details()) > 0 {
+			trailer.StatusDetails, _ = protobuf.Marshal(st.Proto())
+		}
+		entry.Type = binlogpb.GrpcLogEntry_EVENT_TYPE_SERVER_TRAILER
+		entry.Payload = &binlogpb.GrpcLogEntry_Trailer{Trailer: trailer}
+	default:
+		return
+	}
+
+	entry.Timestamp = timestamppb.Now()
+	entry.CallId = call.id
+	entry.SequenceIdWithinCall = call.seq.Add(1)
+	if err := h.write(entry); err != nil {
+		h.log.Error("error writing binary log", slog.Any("error", err.Error()))
+	}
+}
+
+func (h *binaryLogHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *binaryLogHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+// message re-encodes the payload, which yields the uncompressed message as it was on the wire.
+func (h *binaryLogHandler) message(payload any) *binlogpb.Message {
+	data, err := h.codec.Marshal(payload)
+	if err != nil {
+		h.log.Error("error encoding message for binary log", slog.Any("error", err.Error()))
+		return &binlogpb.Message{}
+	}
+	b := data.Materialize()
+	data.Free()
+	return &binlogpb.Message{
+		Length: uint32(len(b)),
+		Data:   b,
+	}
+}
+
+func (h *binaryLogHandler) write(entry *binlogpb.GrpcLogEntry) error {
+	b, err := protobuf.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, err := h.f.Write(binary.BigEndian.AppendUint32(nil, uint32(len(b)))); err != nil {
+		return err
+	}
+	_, err = h.f.Write(b)
+	return err
+}
+
+func binaryLogMetadata(md metadata.MD) *binlogpb.Metadata {
+	out := &binlogpb.Metadata{}
+	for k, vs := range md {
+		for _, v := range vs {
+			out.Entry = append(out.Entry, &binlogpb.MetadataEntry{Key: k, Value: []byte(v)})
+		}
+	}
+	return out
+}
+
+func binaryLogAddress(addr net.Addr) *binlogpb.Address {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		typ := binlogpb.Address_TYPE_IPV6
+		if addr.IP.To4() != nil {
+			typ = binlogpb.Address_TYPE_IPV4
+		}
+		return &binlogpb.Address{Type: typ, Address: addr.IP.String(), IpPort: uint32(addr.Port)}
+	case *net.UnixAddr:
+		return &binlogpb.Address{Type: binlogpb.Address_TYPE_UNIX, Address: addr.Name}
+	case nil:
+		return nil
+	default:
+		return &binlogpb.Address{Type: binlogpb.Address_TYPE_UNKNOWN, Address: addr.String()}
+	}
+}
+
+func firstValue(md metadata.MD, key string) string {
+	if vs := md.Get(key); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
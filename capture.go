@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+)
+
+// captureConfig configures uploading received payloads to object storage.
+type captureConfig struct {
+	// URL is s3://bucket/prefix or gs://bucket/prefix.
+	URL string
+	// Endpoint overrides the endpoint derived from the URL scheme, e.g. for MinIO.
+	Endpoint string
+	Region   string
+	Insecure bool
+	// Key is the text/template of the object key, appended to the prefix of the URL.
+	Key string
+	// Format is proto or json.
+	Format      string
+	Concurrency int
+}
+
+func (c *captureConfig) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.URL, "capture-url", "", "object storage location to upload every received resource profile to, e.g. s3://bucket/prefix or gs://bucket/prefix")
+	fs.StringVar(&c.Endpoint, "capture-endpoint", "", "object storage endpoint, e.g. localhost:9000 for MinIO (default derived from -capture-url)")
+	fs.StringVar(&c.Region, "capture-region", "", "object storage region")
+	fs.BoolVar(&c.Insecure, "capture-insecure", false, "connect to the object storage endpoint without TLS")
+	fs.StringVar(&c.Key, "capture-key", `{{.Time.Format "2006/01/02"}}/{{index .Resource "service.name" | default "unknown"}}/{{.Time.Format "150405.000000000"}}-{{.Seq}}`,
+		"text/template of the object key, with .Time, .Resource (attributes) and .Seq; the file extension is added")
+	fs.StringVar(&c.Format, "capture-format", "proto", "format of the uploaded objects (proto, json), both OTLP")
+	fs.IntVar(&c.Concurrency, "capture-concurrency", 4, "number of parallel uploads")
+}
+
+// captureKeyData is passed to the object key template.
+type captureKeyData struct {
+	Time     time.Time
+	Resource map[string]string
+	// Seq numbers the uploads, to keep keys unique.
+	Seq int64
+}
+
+// captureUploader uploads every received resource profile as its own OTLP request to an S3
+// compatible object storage. GCS is used via its S3 interoperability API with HMAC keys.
+// Credentials are taken from the usual AWS environment variables and files, or the instance
+// metadata.
+type captureUploader struct {
+	log    *slog.Logger
+	cfg    captureConfig
+	client *minio.Client
+	bucket string
+	prefix string
+	key    *template.Template
+	seq    atomic.Int64
+}
+
+func newCaptureUploader(log *slog.Logger, cfg captureConfig) (*captureUploader, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capture url: %w", err)
+	}
+	endpoint := cfg.Endpoint
+	switch u.Scheme {
+	case "s3":
+		if endpoint == "" {
+			endpoint = "s3.amazonaws.com"
+		}
+	case "gs":
+		if endpoint == "" {
+			endpoint = "storage.googleapis.com"
+		}
+	default:
+		return nil, fmt.Errorf("unknown capture url scheme %q, expected s3 or gs", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("capture url %q has no bucket", cfg.URL)
+	}
+	if cfg.Format != "proto" && cfg.Format != "json" {
+		return nil, fmt.Errorf("unknown capture format %q, expected proto or json", cfg.Format)
+	}
+
+	funcs := template.FuncMap{
+		"default": func(def, v string) string {
+			if v == "" {
+				return def
+			}
+			return v
+		},
+	}
+	key, err := template.New("key").Funcs(templateFuncs).Funcs(funcs).Option("missingkey=zero").Parse(cfg.Key)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing capture key template: %w", err)
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		}),
+		Secure: !cfg.Insecure,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := strings.TrimPrefix(u.Path, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &captureUploader{
+		log:    log,
+		cfg:    cfg,
+		client: client,
+		bucket: u.Host,
+		prefix: prefix,
+		key:    key,
+	}, nil
+}
+
+func (c *captureUploader) forward(pd pprofile.Profiles) {
+	now := time.Now().UTC()
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rp := rps.At(i)
+		if err := c.upload(now, pd.Dictionary(), rp); err != nil {
+			c.log.Error("error uploading capture", slog.String("bucket", c.bucket), slog.Any("error", err.Error()))
+		}
+	}
+}
+
+func (c *captureUploader) upload(now time.Time, dict pprofile.ProfilesDictionary, rp pprofile.ResourceProfiles) error {
+	var key strings.Builder
+	key.WriteString(c.prefix)
+	err := c.key.Execute(&key, captureKeyData{
+		Time:     now,
+		Resource: mapAttributes(rp.Resource().Attributes()),
+		Seq:      c.seq.Add(1),
+	})
+	if err != nil {
+		return fmt.Errorf("error executing capture key template: %w", err)
+	}
+
+	single := pprofile.NewProfiles()
+	dict.CopyTo(single.Dictionary())
+	rp.CopyTo(single.ResourceProfiles().AppendEmpty())
+	request := pprofileotlp.NewExportRequestFromProfiles(single)
+
+	var data []byte
+	contentType := "application/x-protobuf"
+	if c.cfg.Format == "json" {
+		data, err = request.MarshalJSON()
+		contentType = "application/json"
+		key.WriteString(".json")
+	} else {
+		data, err = request.MarshalProto()
+		key.WriteString(".binpb")
+	}
+	if err != nil {
+		return fmt.Errorf("error encoding capture: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err = c.client.PutObject(ctx, c.bucket, key.String(), bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// keyCardinality tracks the distinct values of an attribute key. Once the threshold is
+// exceeded the values are dropped, as the key is reported already and they could grow
+// without bound.
+type keyCardinality struct {
+	level, key string
+	values     map[uint64]struct{}
+	exceeded   bool
+	example    string
+}
+
+// cardinalityDetector counts the distinct values of every attribute key at the resource,
+// profile, sample and location level and warns once a key has more than the threshold, which
+// usually means a sender puts unbounded values like request IDs into attributes.
+type cardinalityDetector struct {
+	threshold int
+	seed      maphash.Seed
+
+	mu   sync.Mutex
+	keys map[[2]string]*keyCardinality
+}
+
+func newCardinalityDetector(threshold int) *cardinalityDetector {
+	return &cardinalityDetector{
+		threshold: threshold,
+		seed:      maphash.MakeSeed(),
+		keys:      map[[2]string]*keyCardinality{},
+	}
+}
+
+func (d *cardinalityDetector) check(log *slog.Logger, pd pprofile.Profiles) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dict := pd.Dictionary()
+	lookup := dump.NewLookup(dict)
+	checkIndices := func(level string, indices pcommon.Int32Slice) {
+		for _, idx := range indices.All() {
+			if attr, ok := lookup.Attribute(idx); ok {
+				d.add(log, level, lookup.String(attr.KeyStrindex()), attr.Value())
+			}
+		}
+	}
+
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rps.At(i).Resource().Attributes().Range(func(k string, v pcommon.Value) bool {
+			d.add(log, "resource", k, v)
+			return true
+		})
+		sps := rps.At(i).ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			pcs := sps.At(j).Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				checkIndices("profile", pcs.At(k).AttributeIndices())
+				for _, sample := range pcs.At(k).Samples().All() {
+					checkIndices("sample", sample.AttributeIndices())
+				}
+			}
+		}
+	}
+	for _, location := range dict.LocationTable().All() {
+		checkIndices("location", location.AttributeIndices())
+	}
+}
+
+func (d *cardinalityDetector) add(log *slog.Logger, level, key string, value pcommon.Value) {
+	kc, ok := d.keys[[2]string{level, key}]
+	if !ok {
+		kc = &keyCardinality{level: level, key: key, values: map[uint64]struct{}{}}
+		d.keys[[2]string{level, key}] = kc
+	}
+	if kc.exceeded {
+		return
+	}
+	v := value.AsString()
+	kc.values[maphash.String(d.seed, v)] = struct{}{}
+	if len(kc.values) > d.threshold {
+		kc.exceeded = true
+		kc.values = nil
+		kc.example = v
+		log.Warn("high cardinality attribute", slog.String("level", level), slog.String("key", key),
+			slog.Int("threshold", d.threshold), slog.String("example", v))
+	}
+}
+
+func (d *cardinalityDetector) printSummary(w io.Writer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var exceeded []*keyCardinality
+	for _, kc := range d.keys {
+		if kc.exceeded {
+			exceeded = append(exceeded, kc)
+		}
+	}
+	if len(exceeded) == 0 {
+		return
+	}
+	slices.SortFunc(exceeded, func(a, b *keyCardinality) int {
+		return cmp.Or(cmp.Compare(slices.Index(attributeLevels, a.level), slices.Index(attributeLevels, b.level)),
+			cmp.Compare(a.key, b.key))
+	})
+	fmt.Fprintln(w, "----------- High cardinality attributes -----------")
+	for _, kc := range exceeded {
+		fmt.Fprintf(w, "  %s: %s has more than %d distinct values, e.g. %q\n", kc.level, kc.key, d.threshold, kc.example)
+	}
+	fmt.Fprintln(w, "---------------------------------------------------")
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// chromeTrace is the Chrome trace event format, understood by about://tracing and Perfetto.
+type chromeTrace struct {
+	TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+	DisplayTimeUnit string             `json:"displayTimeUnit"`
+}
+
+type chromeTraceEvent struct {
+	Name string `json:"name"`
+	Cat  string `json:"cat,omitempty"`
+	Ph   string `json:"ph"`
+	// Ts and Dur are in microseconds.
+	Ts   float64        `json:"ts"`
+	Dur  float64        `json:"dur,omitempty"`
+	Pid  int64          `json:"pid"`
+	Tid  int64          `json:"tid"`
+	S    string         `json:"s,omitempty"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// toChromeTrace converts the timestamped samples of resolved profiles into trace events, one
+// per timestamp on the track of its process.pid and thread.id. Threads without a thread.id get
+// a track per thread.name. Samples of profiles with a time based period span the period, all
+// others are instant events.
+func toChromeTrace(views []profileView) chromeTrace {
+	trace := chromeTrace{DisplayTimeUnit: "ns"}
+	// processes and threads hold the tracks already named by metadata events.
+	processes := map[int64]bool{}
+	threads := map[[2]int64]bool{}
+	// threadNames assigns track IDs to threads only known by name, counting down from -1 to
+	// not collide with thread IDs.
+	threadNames := map[string]int64{}
+
+	for _, view := range views {
+		p := view.Profile
+		var dur float64
+		if p.PeriodUnit == "nanoseconds" && p.Period > 0 {
+			dur = float64(p.Period) / 1e3
+		}
+
+		for _, sample := range p.Samples {
+			pid := chromeTraceID(sample.Attributes["process.pid"], view.Resource.Attributes["process.pid"])
+			tid := chromeTraceID(sample.Attributes["thread.id"])
+			if _, ok := sample.Attributes["thread.id"]; !ok && sample.Attributes["thread.name"] != "" {
+				name := sample.Attributes["thread.name"]
+				if _, ok := threadNames[name]; !ok {
+					threadNames[name] = -int64(len(threadNames) + 1)
+				}
+				tid = threadNames[name]
+			}
+			if !processes[pid] {
+				processes[pid] = true
+				processName := sample.Attributes["process.executable.name"]
+				if processName == "" {
+					processName = resourceName(view.Resource.Attributes)
+				}
+				trace.TraceEvents = append(trace.TraceEvents, chromeTraceEvent{
+					Name: "process_name", Ph: "M", Pid: pid,
+					Args: map[string]any{"name": processName},
+				})
+			}
+			if threadName := sample.Attributes["thread.name"]; threadName != "" && !threads[[2]int64{pid, tid}] {
+				threads[[2]int64{pid, tid}] = true
+				trace.TraceEvents = append(trace.TraceEvents, chromeTraceEvent{
+					Name: "thread_name", Ph: "M", Pid: pid, Tid: tid,
+					Args: map[string]any{"name": threadName},
+				})
+			}
+
+			stack := make([]string, 0, len(sample.Frames))
+			for _, frame := range sample.Frames {
+				stack = append(stack, frameName(frame))
+			}
+			name := "<no frames>"
+			if len(stack) > 0 {
+				name = stack[0]
+			}
+
+			for i, ts := range sample.Timestamps {
+				event := chromeTraceEvent{
+					Name: name,
+					Cat:  p.SampleType,
+					Ph:   "X",
+					Ts:   float64(ts.UnixNano()) / 1e3,
+					Dur:  dur,
+					Pid:  pid,
+					Tid:  tid,
+					Args: map[string]any{"stack": stack},
+				}
+				if dur == 0 {
+					event.Ph, event.S = "i", "t"
+				}
+				if len(sample.Values) == len(sample.Timestamps) {
+					event.Args["value"] = sample.Values[i]
+				}
+				if sample.TraceID != "" {
+					event.Args["trace_id"], event.Args["span_id"] = sample.TraceID, sample.SpanID
+				}
+				trace.TraceEvents = append(trace.TraceEvents, event)
+			}
+		}
+	}
+	return trace
+}
+
+// chromeTraceID parses the first non-empty value as a process or thread ID.
+func chromeTraceID(values ...string) int64 {
+	for _, v := range values {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return id
+		}
+	}
+	return 0
+}
+
+func (f *profilesServer) handleGetProfileChromeTrace(w http.ResponseWriter, r *http.Request) {
+	entry, ok := f.lookupProfile(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("profile-%d.trace.json", entry.Seq)))
+	writeJSON(w, toChromeTrace([]profileView{entry.View}))
+}
+
+// chromeTraceWriter writes the samples of every request to a Chrome trace event file.
+type chromeTraceWriter struct {
+	log    *slog.Logger
+	dir    string
+	config func() Config
+
+	seq atomic.Int64
+}
+
+func newChromeTraceWriter(log *slog.Logger, dir string, config func() Config) (*chromeTraceWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &chromeTraceWriter{log: log, dir: dir, config: func() Config {
+		config := config()
+		config.ExportStackFrames = true
+		config.ExportSampleAttributes = true
+		return config
+	}}, nil
+}
+
+func (w *chromeTraceWriter) forward(pd pprofile.Profiles) {
+	name := fmt.Sprintf("%s-%06d.trace.json", time.Now().UTC().Format("20060102T150405"), w.seq.Add(1))
+	path := filepath.Join(w.dir, name)
+
+	data, err := json.Marshal(toChromeTrace(resolveProfiles(w.config(), pd)))
+	if err == nil {
+		err = os.WriteFile(path, data, 0o644)
+	}
+	if err != nil {
+		w.log.Error("error writing Chrome trace", slog.String("path", path), slog.Any("error", err.Error()))
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// clickhouseConfig configures inserting received samples into ClickHouse.
+type clickhouseConfig struct {
+	// URL is the HTTP interface of ClickHouse, e.g. http://localhost:8123.
+	URL          string
+	Database     string
+	SamplesTable string
+	StacksTable  string
+	User         string
+	Password     string
+	CreateTables bool
+	Timeout      time.Duration
+}
+
+func (c *clickhouseConfig) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.URL, "clickhouse-url", "", "HTTP interface of ClickHouse to insert received samples into, e.g. http://localhost:8123 (disabled if empty)")
+	fs.StringVar(&c.Database, "clickhouse-database", "default", "ClickHouse database of the tables")
+	fs.StringVar(&c.SamplesTable, "clickhouse-samples-table", "profile_samples", "ClickHouse table to insert samples into")
+	fs.StringVar(&c.StacksTable, "clickhouse-stacks-table", "profile_stacks", "ClickHouse table to insert the stacks referenced by samples into")
+	fs.StringVar(&c.User, "clickhouse-user", "default", "ClickHouse user")
+	fs.StringVar(&c.Password, "clickhouse-password", os.Getenv("CLICKHOUSE_PASSWORD"), "ClickHouse password")
+	fs.BoolVar(&c.CreateTables, "clickhouse-create-tables", true, "create the ClickHouse tables on startup if they don't exist")
+	fs.DurationVar(&c.Timeout, "clickhouse-timeout", 30*time.Second, "timeout of a single ClickHouse request")
+}
+
+const clickhouseSamplesSchema = `CREATE TABLE IF NOT EXISTS %s (
+	received_at DateTime64(9, 'UTC'),
+	service_name LowCardinality(String),
+	host_name LowCardinality(String),
+	container_id String,
+	profile_id String,
+	profile_time DateTime64(9, 'UTC'),
+	sample_type LowCardinality(String),
+	sample_unit LowCardinality(String),
+	value Int64,
+	timestamps_unix_nano Array(UInt64),
+	stack_id UInt64,
+	leaf_function String,
+	trace_id String,
+	span_id String,
+	resource_attributes Map(String, String),
+	profile_attributes Map(String, String),
+	sample_attributes Map(String, String)
+) ENGINE = MergeTree
+ORDER BY (service_name, sample_type, received_at)`
+
+const clickhouseStacksSchema = `CREATE TABLE IF NOT EXISTS %s (
+	stack_id UInt64,
+	folded String,
+	frames Array(String),
+	depth UInt32
+) ENGINE = ReplacingMergeTree
+ORDER BY stack_id`
+
+type clickhouseSample struct {
+	ReceivedAt         string            `json:"received_at"`
+	ServiceName        string            `json:"service_name"`
+	HostName           string            `json:"host_name"`
+	ContainerID        string            `json:"container_id"`
+	ProfileID          string            `json:"profile_id"`
+	ProfileTime        string            `json:"profile_time"`
+	SampleType         string            `json:"sample_type"`
+	SampleUnit         string            `json:"sample_unit"`
+	Value              int64             `json:"value"`
+	Timestamps         []int64           `json:"timestamps_unix_nano"`
+	StackID            uint64            `json:"stack_id"`
+	LeafFunction       string            `json:"leaf_function"`
+	TraceID            string            `json:"trace_id"`
+	SpanID             string            `json:"span_id"`
+	ResourceAttributes map[string]string `json:"resource_attributes"`
+	ProfileAttributes  map[string]string `json:"profile_attributes"`
+	SampleAttributes   map[string]string `json:"sample_attributes"`
+}
+
+// clickhouseStack is a stack with its frames leaf first.
+type clickhouseStack struct {
+	StackID uint64   `json:"stack_id"`
+	Folded  string   `json:"folded"`
+	Frames  []string `json:"frames"`
+	Depth   int      `json:"depth"`
+}
+
+// clickhouseTime is the format of DateTime64 values in JSONEachRow input.
+const clickhouseTime = "2006-01-02 15:04:05.999999999"
+
+// clickhouseSink inserts the samples of every request into ClickHouse via its HTTP interface.
+// Stacks are stored once in their own table, keyed by a hash of the folded stack.
+type clickhouseSink struct {
+	log    *slog.Logger
+	cfg    clickhouseConfig
+	config func() Config
+	client *http.Client
+
+	mu sync.Mutex
+	// insertedStacks holds the stacks already inserted by this process.
+	insertedStacks map[uint64]bool
+}
+
+func newClickhouseSink(log *slog.Logger, cfg clickhouseConfig, config func() Config) (*clickhouseSink, error) {
+	c := &clickhouseSink{
+		log: log,
+		cfg: cfg,
+		config: func() Config {
+			config := config()
+			config.ExportStackFrames = true
+			return config
+		},
+		client:         &http.Client{Timeout: cfg.Timeout},
+		insertedStacks: map[uint64]bool{},
+	}
+	if cfg.CreateTables {
+		for _, query := range []string{
+			fmt.Sprintf(clickhouseSamplesSchema, c.table(cfg.SamplesTable)),
+			fmt.Sprintf(clickhouseStacksSchema, c.table(cfg.StacksTable)),
+		} {
+			if err := c.exec(query, nil); err != nil {
+				return nil, fmt.Errorf("error creating table: %w", err)
+			}
+		}
+	}
+	return c, nil
+}
+
+// table returns the quoted name of a table in the configured database.
+func (c *clickhouseSink) table(name string) string {
+	quote := func(s string) string { return "`" + strings.ReplaceAll(s, "`", "\\`") + "`" }
+	return quote(c.cfg.Database) + "." + quote(name)
+}
+
+func (c *clickhouseSink) forward(pd pprofile.Profiles) {
+	receivedAt := time.Now().UTC().Format(clickhouseTime)
+	var samples, stacks bytes.Buffer
+	samplesEnc, stacksEnc := json.NewEncoder(&samples), json.NewEncoder(&stacks)
+	var newStacks []uint64
+
+	c.mu.Lock()
+	for _, view := range resolveProfiles(c.config(), pd) {
+		resource := view.Resource.Attributes
+		for _, sample := range view.Profile.Samples {
+			folded := foldFrames(sample.Frames)
+			stackID := clickhouseStackID(folded)
+			if !c.insertedStacks[stackID] {
+				c.insertedStacks[stackID] = true
+				newStacks = append(newStacks, stackID)
+				frames := make([]string, 0, len(sample.Frames))
+				for _, f := range sample.Frames {
+					frames = append(frames, frameName(f))
+				}
+				stacksEnc.Encode(clickhouseStack{StackID: stackID, Folded: folded, Frames: frames, Depth: len(frames)})
+			}
+
+			row := clickhouseSample{
+				ReceivedAt:         receivedAt,
+				ServiceName:        resource["service.name"],
+				HostName:           resource["host.name"],
+				ContainerID:        resource["container.id"],
+				ProfileID:          view.Profile.ProfileID,
+				ProfileTime:        view.Profile.Time.UTC().Format(clickhouseTime),
+				SampleType:         view.Profile.SampleType,
+				SampleUnit:         view.Profile.SampleUnit,
+				Value:              sample.total(),
+				Timestamps:         []int64{},
+				StackID:            stackID,
+				TraceID:            sample.TraceID,
+				SpanID:             sample.SpanID,
+				ResourceAttributes: resource,
+				ProfileAttributes:  view.Profile.Attributes,
+				SampleAttributes:   sample.Attributes,
+			}
+			for _, ts := range sample.Timestamps {
+				row.Timestamps = append(row.Timestamps, ts.UnixNano())
+			}
+			if len(sample.Frames) > 0 {
+				row.LeafFunction = frameName(sample.Frames[0])
+			}
+			samplesEnc.Encode(row)
+		}
+	}
+	c.mu.Unlock()
+
+	if stacks.Len() > 0 {
+		if err := c.insert(c.cfg.StacksTable, &stacks); err != nil {
+			c.log.Error("error inserting stacks into ClickHouse", slog.Any("error", err.Error()))
+			// Insert them again with the next request referencing them.
+			c.mu.Lock()
+			for _, id := range newStacks {
+				delete(c.insertedStacks, id)
+			}
+			c.mu.Unlock()
+		}
+	}
+	if samples.Len() > 0 {
+		if err := c.insert(c.cfg.SamplesTable, &samples); err != nil {
+			c.log.Error("error inserting samples into ClickHouse", slog.Any("error", err.Error()))
+		}
+	}
+}
+
+func (c *clickhouseSink) insert(table string, rows io.Reader) error {
+	return c.exec(fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", c.table(table)), rows)
+}
+
+// exec runs the query, with body as the data of an INSERT.
+func (c *clickhouseSink) exec(query string, body io.Reader) error {
+	u, err := url.Parse(c.cfg.URL)
+	if err != nil {
+		return err
+	}
+	params := u.Query()
+	params.Set("query", query)
+	u.RawQuery = params.Encode()
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-ClickHouse-User", c.cfg.User)
+	if c.cfg.Password != "" {
+		req.Header.Set("X-ClickHouse-Key", c.cfg.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// clickhouseStackID derives a stable ID of a folded stack.
+func clickhouseStackID(folded string) uint64 {
+	sum := sha256.Sum256([]byte(folded))
+	return binary.BigEndian.Uint64(sum[:8])
+}
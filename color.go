@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// colorEnabled resolves the -color flag. In auto mode colors are used if the output is a
+// terminal and NO_COLOR is not set.
+func colorEnabled(mode string, out any) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		return isTerminal(out), nil
+	default:
+		return false, fmt.Errorf("unknown color mode %q, expected always, never or auto", mode)
+	}
+}
+
+func isTerminal(out any) bool {
+	if w, ok := out.(nopWriteCloser); ok {
+		out = w.Writer
+	}
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
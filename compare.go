@@ -0,0 +1,270 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"google.golang.org/grpc"
+)
+
+// goldenAddress matches the addresses of unsymbolized frames in golden renderings.
+var goldenAddress = regexp.MustCompile(`^(    frame \S+ )0x[0-9a-f]+ `)
+
+// goldenOptions select the parts of golden renderings left out of the comparison.
+type goldenOptions struct {
+	ignoreTimestamps bool
+	ignoreProfileIDs bool
+	ignoreAddresses  bool
+}
+
+// goldenProfile is a profile of a golden rendering, split into the lines describing its
+// resource, scope and profile, and its samples.
+type goldenProfile struct {
+	header  string
+	samples []string
+}
+
+// parseGolden splits a golden rendering into its profiles, leaving out the ignored lines.
+// Samples are sorted again, as their order depends on the ignored lines.
+func parseGolden(text string, opts goldenOptions) []goldenProfile {
+	var profiles []goldenProfile
+	for block := range strings.SplitSeq(strings.TrimSpace(text), "\n\n") {
+		if block == "" {
+			continue
+		}
+		var p goldenProfile
+		var header, sample []string
+		flush := func() {
+			if sample != nil {
+				p.samples = append(p.samples, strings.Join(sample, "\n"))
+			}
+			sample = nil
+		}
+		for line := range strings.SplitSeq(block, "\n") {
+			switch {
+			case opts.ignoreTimestamps && (strings.HasPrefix(line, "  time ") || strings.HasPrefix(line, "    timestamp ")):
+				continue
+			case opts.ignoreProfileIDs && strings.HasPrefix(line, "  profile_id "):
+				continue
+			case opts.ignoreAddresses:
+				line = goldenAddress.ReplaceAllString(line, "${1}0x? ")
+			}
+			if strings.HasPrefix(line, "  sample ") {
+				flush()
+				sample = []string{}
+			}
+			if sample != nil {
+				sample = append(sample, line)
+			} else {
+				header = append(header, line)
+			}
+		}
+		flush()
+		p.header = strings.Join(header, "\n")
+		slices.Sort(p.samples)
+		profiles = append(profiles, p)
+	}
+	slices.SortFunc(profiles, func(a, b goldenProfile) int {
+		return strings.Compare(a.header, b.header)
+	})
+	return profiles
+}
+
+// diffGolden writes the profiles and samples only found on one side, prefixed with - for the
+// golden side and + for the actual side. It returns whether they differ.
+func diffGolden(w io.Writer, golden, actual []goldenProfile) bool {
+	samples := func(profiles []goldenProfile) map[string]map[string]int {
+		out := map[string]map[string]int{}
+		for _, p := range profiles {
+			if out[p.header] == nil {
+				out[p.header] = map[string]int{}
+			}
+			for _, s := range p.samples {
+				out[p.header][s]++
+			}
+		}
+		return out
+	}
+	expected, got := samples(golden), samples(actual)
+
+	var headers []string
+	for header := range expected {
+		headers = append(headers, header)
+	}
+	for header := range got {
+		if _, ok := expected[header]; !ok {
+			headers = append(headers, header)
+		}
+	}
+	slices.Sort(headers)
+
+	differ := false
+	for _, header := range headers {
+		e, eok := expected[header]
+		g, gok := got[header]
+		switch {
+		case !gok:
+			differ = true
+			fmt.Fprintln(w, prefixLines("- ", header))
+			fmt.Fprintf(w, "  (missing profile with %d samples)\n\n", countValues(e))
+			continue
+		case !eok:
+			differ = true
+			fmt.Fprintln(w, prefixLines("+ ", header))
+			fmt.Fprintf(w, "  (unexpected profile with %d samples)\n\n", countValues(g))
+			continue
+		}
+
+		var lines []string
+		keys := map[string]bool{}
+		for s := range e {
+			keys[s] = true
+		}
+		for s := range g {
+			keys[s] = true
+		}
+		for _, s := range slices.Sorted(maps.Keys(keys)) {
+			for range e[s] - g[s] {
+				lines = append(lines, prefixLines("- ", s))
+			}
+			for range g[s] - e[s] {
+				lines = append(lines, prefixLines("+ ", s))
+			}
+		}
+		if len(lines) > 0 {
+			differ = true
+			fmt.Fprintln(w, prefixLines("  ", header))
+			fmt.Fprintln(w, strings.Join(lines, "\n"))
+			fmt.Fprintln(w)
+		}
+	}
+	return differ
+}
+
+func prefixLines(prefix, text string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
+
+func countValues(m map[string]int) int {
+	n := 0
+	for _, v := range m {
+		n += v
+	}
+	return n
+}
+
+// runCompare compares a request against a golden file written with -golden-dir. The request
+// is read from a file or, without one, is the first request received. It returns the exit code
+// of the process, 1 if they differ.
+func runCompare(args []string) int {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	normalized := fs.Bool("normalized", true, "the golden file was written with -golden-normalize")
+	var opts goldenOptions
+	fs.BoolVar(&opts.ignoreTimestamps, "ignore-timestamps", false, "ignore profile times and sample timestamps")
+	fs.BoolVar(&opts.ignoreProfileIDs, "ignore-profile-ids", false, "ignore profile IDs, for golden files written with -golden-normalize=false")
+	fs.BoolVar(&opts.ignoreAddresses, "ignore-addresses", false, "ignore the addresses of unsymbolized frames")
+	port := fs.Int("port", 4137, "port to listen on without an input file, ignored if -listen is set")
+	listen := fs.String("listen", "", "host:port to listen on without an input file (default 127.0.0.1:<port>)")
+	timeout := fs.Duration("timeout", 60*time.Second, "time to wait for a request without an input file")
+	var limits grpcLimits
+	limits.registerFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s compare [flags] <golden> [input]\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "input is an OTLP JSON file if its extension is .json, protobuf otherwise. Without input, the")
+		fmt.Fprintln(fs.Output(), "first request received via gRPC is compared.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+	golden, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading %s: %v\n", fs.Arg(0), err)
+		return 2
+	}
+
+	var pd pprofile.Profiles
+	if fs.NArg() == 2 {
+		pd, err = readProfilesFile(fs.Arg(1))
+	} else {
+		pd, err = receiveProfiles(listenAddress(*listen, *port), limits, *timeout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	var actual strings.Builder
+	if err := renderGolden(&actual, pd, *normalized); err != nil {
+		fmt.Fprintf(os.Stderr, "error rendering request: %v\n", err)
+		return 2
+	}
+	if diffGolden(os.Stdout, parseGolden(string(golden), opts), parseGolden(actual.String(), opts)) {
+		fmt.Println("request differs from golden file")
+		return 1
+	}
+	fmt.Println("request matches golden file")
+	return 0
+}
+
+// readProfilesFile reads an OTLP JSON or protobuf export request.
+func readProfilesFile(path string) (pprofile.Profiles, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return pprofile.Profiles{}, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	request := pprofileotlp.NewExportRequest()
+	if filepath.Ext(path) == ".json" {
+		err = request.UnmarshalJSON(data)
+	} else {
+		err = request.UnmarshalProto(data)
+	}
+	if err != nil {
+		return pprofile.Profiles{}, fmt.Errorf("error decoding %s: %w", path, err)
+	}
+	return request.Profiles(), nil
+}
+
+// receiveProfiles serves gRPC on addr until the first request is received.
+func receiveProfiles(addr string, limits grpcLimits, timeout time.Duration) (pprofile.Profiles, error) {
+	received := make(chan pprofile.Profiles, 1)
+	srv := newProfilesServer(Config{})
+	srv.dumpDisabled = true
+	srv.forwarders = append(srv.forwarders, newForwarder("compare", 1, func(pd pprofile.Profiles) {
+		select {
+		case received <- pd:
+		default:
+		}
+	}))
+
+	s := grpc.NewServer(append(limits.serverOptions(), grpc.StatsHandler(&requestInfoHandler{}))...)
+	registerServices(s, srv)
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return pprofile.Profiles{}, fmt.Errorf("error creating listener: %w", err)
+	}
+	go s.Serve(lis)
+	defer s.Stop()
+	fmt.Fprintln(os.Stderr, "GRPC server started at ", lis.Addr().String())
+
+	select {
+	case pd := <-received:
+		return pd, nil
+	case <-time.After(timeout):
+		return pprofile.Profiles{}, fmt.Errorf("no request received within %v", timeout)
+	}
+}
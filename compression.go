@@ -0,0 +1,113 @@
+package main
+
+import (
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+// The gzip codec is registered by importing google.golang.org/grpc/encoding/gzip, zstd and
+// snappy are not part of grpc-go, so we bring our own.
+func init() {
+	encoding.RegisterCompressor(&zstdCompressor{})
+	encoding.RegisterCompressor(&snappyCompressor{})
+}
+
+type zstdCompressor struct {
+	encoders sync.Pool
+	decoders sync.Pool
+}
+
+func (c *zstdCompressor) Name() string {
+	return "zstd"
+}
+
+func (c *zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	if enc, ok := c.encoders.Get().(*zstd.Encoder); ok {
+		enc.Reset(w)
+		return &zstdWriteCloser{Encoder: enc, pool: &c.encoders}, nil
+	}
+
+	enc, err := zstd.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	return &zstdWriteCloser{Encoder: enc, pool: &c.encoders}, nil
+}
+
+func (c *zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	if dec, ok := c.decoders.Get().(*zstd.Decoder); ok {
+		if err := dec.Reset(r); err != nil {
+			return nil, err
+		}
+		return newZstdReader(dec, &c.decoders), nil
+	}
+
+	// With the default concurrency every Reset starts a goroutine, which keeps running for
+	// decoders that are never returned to the pool.
+	dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return newZstdReader(dec, &c.decoders), nil
+}
+
+type zstdWriteCloser struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+func (w *zstdWriteCloser) Close() error {
+	err := w.Encoder.Close()
+	w.pool.Put(w.Encoder)
+	return err
+}
+
+// zstdReader returns the decoder to the pool once the stream has been fully consumed. gRPC
+// doesn't close decompressed readers, the decoder of a stream abandoned early, e.g. at the
+// message size limit or on an error, is closed once the reader is garbage collected instead.
+type zstdReader struct {
+	*zstd.Decoder
+	pool    *sync.Pool
+	cleanup runtime.Cleanup
+	done    bool
+}
+
+func newZstdReader(dec *zstd.Decoder, pool *sync.Pool) *zstdReader {
+	r := &zstdReader{Decoder: dec, pool: pool}
+	r.cleanup = runtime.AddCleanup(r, (*zstd.Decoder).Close, dec)
+	return r
+}
+
+func (r *zstdReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, io.EOF
+	}
+	n, err := r.Decoder.Read(p)
+	if err == io.EOF {
+		r.done = true
+		r.cleanup.Stop()
+		r.pool.Put(r.Decoder)
+	}
+	return n, err
+}
+
+// snappyCompressor uses the framed snappy format, which is what the OpenTelemetry collector
+// uses for gRPC.
+type snappyCompressor struct{}
+
+func (c *snappyCompressor) Name() string {
+	return "snappy"
+}
+
+func (c *snappyCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return snappy.NewBufferedWriter(w), nil
+}
+
+func (c *snappyCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	return snappy.NewReader(r), nil
+}
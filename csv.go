@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// csvConfig configures writing the samples of every request to a CSV file.
+type csvConfig struct {
+	Dir string
+	// Attributes are the sample or resource attributes written as additional columns.
+	Attributes []string
+}
+
+func (c *csvConfig) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Dir, "csv-dir", "", "directory to write the samples of every request to as a CSV file (disabled if empty)")
+	fs.Var((*stringSliceFlag)(&c.Attributes), "csv-attr", "sample or resource attribute to add as a column to the CSV files (repeatable)")
+}
+
+// csvColumns are the columns written for every sample, followed by the configured attributes.
+var csvColumns = []string{"service.name", "host.name", "container.id", "profile_id", "sample_type", "sample_unit", "value", "timestamps", "leaf_function"}
+
+// csvWriter writes one CSV file per request, with a row per sample.
+type csvWriter struct {
+	log    *slog.Logger
+	cfg    csvConfig
+	config func() Config
+
+	seq atomic.Int64
+}
+
+func newCSVWriter(log *slog.Logger, cfg csvConfig, config func() Config) (*csvWriter, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &csvWriter{log: log, cfg: cfg, config: func() Config {
+		config := config()
+		config.ExportStackFrames = true
+		return config
+	}}, nil
+}
+
+func (w *csvWriter) forward(pd pprofile.Profiles) {
+	name := fmt.Sprintf("%s-%06d.csv", time.Now().UTC().Format("20060102T150405"), w.seq.Add(1))
+	path := filepath.Join(w.cfg.Dir, name)
+	if err := w.write(path, pd); err != nil {
+		w.log.Error("error writing CSV", slog.String("path", path), slog.Any("error", err.Error()))
+	}
+}
+
+func (w *csvWriter) write(path string, pd pprofile.Profiles) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(f)
+	cw.Write(slices.Concat(csvColumns, w.cfg.Attributes))
+
+	for _, view := range resolveProfiles(w.config(), pd) {
+		resource := view.Resource.Attributes
+		for _, sample := range view.Profile.Samples {
+			timestamps := make([]string, 0, len(sample.Timestamps))
+			for _, ts := range sample.Timestamps {
+				timestamps = append(timestamps, ts.UTC().Format(time.RFC3339Nano))
+			}
+			var leaf string
+			if len(sample.Frames) > 0 {
+				leaf = frameName(sample.Frames[0])
+			}
+
+			row := []string{
+				resource["service.name"], resource["host.name"], resource["container.id"],
+				view.Profile.ProfileID, view.Profile.SampleType, view.Profile.SampleUnit,
+				strconv.FormatInt(sample.total(), 10), strings.Join(timestamps, ";"), leaf,
+			}
+			for _, key := range w.cfg.Attributes {
+				v, ok := sample.Attributes[key]
+				if !ok {
+					v = resource[key]
+				}
+				row = append(row, v)
+			}
+			cw.Write(row)
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+)
+
+// newDebugHandler returns the handler serving the Go pprof and expvar endpoints, to profile the
+// server itself. The server counters are published as the expvar profiles_server.
+func newDebugHandler(srv *profilesServer) http.Handler {
+	expvar.Publish("profiles_server", expvar.Func(func() any { return srv.serverStats() }))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
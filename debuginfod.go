@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// debuginfodSymbols downloads debug info by build ID from debuginfod servers into an on-disk
+// cache. Downloads happen in the background, as debug info can be hundreds of megabytes, so
+// frames of a build ID are symbolized once its download finished.
+type debuginfodSymbols struct {
+	log      *slog.Logger
+	urls     []string
+	cacheDir string
+	client   *http.Client
+
+	mu sync.Mutex
+	// requested holds the build IDs that are being or have been downloaded.
+	requested map[string]bool
+}
+
+func newDebuginfodSymbols(log *slog.Logger, urls []string, cacheDir string) (*debuginfodSymbols, error) {
+	if cacheDir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		cacheDir = filepath.Join(dir, "otel-profiles-debug-server", "debuginfod")
+	}
+	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+		return nil, err
+	}
+	return &debuginfodSymbols{
+		log:       log,
+		urls:      urls,
+		cacheDir:  cacheDir,
+		client:    &http.Client{},
+		requested: map[string]bool{},
+	}, nil
+}
+
+func (d *debuginfodSymbols) find(buildID, filename string) (string, bool) {
+	if !isHex(buildID) {
+		return "", false
+	}
+	path := filepath.Join(d.cacheDir, buildID, "debuginfo")
+	if _, err := os.Stat(path); err == nil {
+		return path, true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.requested[buildID] {
+		d.requested[buildID] = true
+		go d.download(buildID, filename, path)
+	}
+	return "", false
+}
+
+func (d *debuginfodSymbols) download(buildID, filename, path string) {
+	for _, u := range d.urls {
+		err := d.fetch(strings.TrimSuffix(u, "/")+"/buildid/"+buildID+"/debuginfo", path)
+		if err == nil {
+			d.log.Info("downloaded debug info", slog.String("build_id", buildID), slog.String("file", filename))
+			return
+		}
+		d.log.Debug("error downloading debug info", slog.String("url", u), slog.String("build_id", buildID),
+			slog.Any("error", err.Error()))
+	}
+	d.log.Warn("no debug info found on any debuginfod server", slog.String("build_id", buildID), slog.String("file", filename))
+}
+
+func (d *debuginfodSymbols) fetch(url, path string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so partial downloads never end up in the cache.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "debuginfo-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// functionValues are the aggregated values of a function, flat when it's the leaf of the
+// stack, cum when it's anywhere on the stack.
+type functionValues struct {
+	flat, cum int64
+}
+
+// runDiff compares the functions of two captured profiles, pprof -diff_base style. It returns
+// the exit code of the process.
+func runDiff(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	dbPath := fs.String("db", "profiles.db", "SQLite database written with -sqlite, to look up profile IDs in")
+	sampleType := fs.String("sample-type", "", "only compare profiles of this sample type (default all)")
+	top := fs.Int("top", 20, "number of functions to print")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s diff [flags] <base> <new>\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "base and new are either OTLP JSON or protobuf files, or profile IDs stored with -sqlite.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	var sides [2]map[string]int64
+	for i, arg := range fs.Args() {
+		stacks, err := loadDiffStacks(arg, *dbPath, *sampleType)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error loading %s: %v\n", arg, err)
+			return 1
+		}
+		sides[i] = stacks
+	}
+
+	base, baseTotal := aggregateFunctions(sides[0])
+	next, nextTotal := aggregateFunctions(sides[1])
+
+	names := map[string]bool{}
+	for name := range base {
+		names[name] = true
+	}
+	for name := range next {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	delta := func(name string) int64 { return next[name].flat - base[name].flat }
+	slices.SortFunc(sorted, func(a, b string) int {
+		return cmp.Or(cmp.Compare(abs64(delta(b)), abs64(delta(a))), cmp.Compare(a, b))
+	})
+
+	fmt.Printf("Total: %d -> %d (%+d)\n", baseTotal, nextTotal, nextTotal-baseTotal)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "flat base\tflat new\tflat delta\tdelta%\tcum delta\t function")
+	for _, name := range sorted[:min(len(sorted), *top)] {
+		b, n := base[name], next[name]
+		fmt.Fprintf(tw, "%d\t%d\t%+d\t%s\t%+d\t %s\n", b.flat, n.flat, n.flat-b.flat,
+			diffPercent(n.flat-b.flat, baseTotal), n.cum-b.cum, name)
+	}
+	tw.Flush()
+	return 0
+}
+
+// loadDiffStacks returns the summed values by folded stack, root first, of a file or of a
+// profile ID from the store.
+func loadDiffStacks(arg, dbPath, sampleType string) (map[string]int64, error) {
+	data, err := os.ReadFile(arg)
+	if errors.Is(err, os.ErrNotExist) {
+		return loadStoredStacks(arg, dbPath, sampleType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	request := pprofileotlp.NewExportRequest()
+	if filepath.Ext(arg) == ".json" {
+		err = request.UnmarshalJSON(data)
+	} else {
+		err = request.UnmarshalProto(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decoding profiles: %w", err)
+	}
+
+	config := Config{Config: dump.Config{ExportStackFrames: true}}
+	if sampleType != "" {
+		config.FilterSampleTypes = []string{sampleType}
+	}
+	stacks := map[string]int64{}
+	for _, view := range resolveProfiles(config, request.Profiles()) {
+		for _, sample := range view.Profile.Samples {
+			if len(sample.Values) > 0 {
+				stacks[foldFrames(sample.Frames)] += sample.total()
+			}
+		}
+	}
+	return stacks, nil
+}
+
+func loadStoredStacks(profileID, dbPath, sampleType string) (map[string]int64, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("no such file and no database to look up the profile ID in: %w", err)
+	}
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT st.folded, SUM(s.value) FROM samples s
+		JOIN profiles p ON p.id = s.profile_id
+		JOIN stacks st ON st.id = s.stack_id
+		WHERE p.profile_id = ? AND (? = '' OR p.sample_type = ?)
+		GROUP BY st.folded`, profileID, sampleType, sampleType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stacks := map[string]int64{}
+	for rows.Next() {
+		var folded string
+		var value int64
+		if err := rows.Scan(&folded, &value); err != nil {
+			return nil, err
+		}
+		stacks[folded] += value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(stacks) == 0 {
+		return nil, fmt.Errorf("no samples of profile %s in %s", profileID, dbPath)
+	}
+	return stacks, nil
+}
+
+// aggregateFunctions sums the values of the folded stacks by function.
+func aggregateFunctions(stacks map[string]int64) (map[string]functionValues, int64) {
+	functions := map[string]functionValues{}
+	var total int64
+	for folded, value := range stacks {
+		total += value
+		frames := strings.Split(folded, ";")
+
+		seen := map[string]bool{}
+		for i, name := range frames {
+			fv := functions[name]
+			if i == len(frames)-1 {
+				fv.flat += value
+			}
+			// Recursive functions are only counted once per stack.
+			if !seen[name] {
+				seen[name] = true
+				fv.cum += value
+			}
+			functions[name] = fv
+		}
+	}
+	return functions, total
+}
+
+func diffPercent(delta, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.2f%%", float64(delta)/float64(total)*100)
+}
+
+func abs64(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// droppedDataTracker sums up the dropped counts senders report on resources, scopes and
+// profiles. Any of them being non-zero means the sender lost data before exporting it, which
+// is warned about on every request and summarized per resource at shutdown.
+type droppedDataTracker struct {
+	mu        sync.Mutex
+	resources map[string]*droppedCounts
+}
+
+// droppedCounts are the dropped attributes of a resource, its scopes and its profiles.
+type droppedCounts struct {
+	Resource int64 `json:"resource_attributes"`
+	Scope    int64 `json:"scope_attributes"`
+	Profile  int64 `json:"profile_attributes"`
+}
+
+func (c droppedCounts) total() int64 {
+	return c.Resource + c.Scope + c.Profile
+}
+
+func newDroppedDataTracker() *droppedDataTracker {
+	return &droppedDataTracker{resources: map[string]*droppedCounts{}}
+}
+
+func (t *droppedDataTracker) check(log *slog.Logger, pd pprofile.Profiles) {
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rp := rps.At(i)
+		counts := droppedCounts{Resource: int64(rp.Resource().DroppedAttributesCount())}
+		sps := rp.ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			counts.Scope += int64(sps.At(j).Scope().DroppedAttributesCount())
+			pcs := sps.At(j).Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				counts.Profile += int64(pcs.At(k).DroppedAttributesCount())
+			}
+		}
+		if counts.total() == 0 {
+			continue
+		}
+
+		resource := resourceName(mapAttributes(rp.Resource().Attributes()))
+		log.Warn("sender dropped data",
+			slog.String("resource", resource),
+			slog.Int64("resource_attributes", counts.Resource),
+			slog.Int64("scope_attributes", counts.Scope),
+			slog.Int64("profile_attributes", counts.Profile))
+		t.record(resource, counts)
+	}
+}
+
+func (t *droppedDataTracker) record(resource string, counts droppedCounts) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	rc, ok := t.resources[resource]
+	if !ok {
+		rc = &droppedCounts{}
+		t.resources[resource] = rc
+	}
+	rc.Resource += counts.Resource
+	rc.Scope += counts.Scope
+	rc.Profile += counts.Profile
+}
+
+// snapshot returns the dropped counts by resource.
+func (t *droppedDataTracker) snapshot() map[string]droppedCounts {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make(map[string]droppedCounts, len(t.resources))
+	for name, rc := range t.resources {
+		out[name] = *rc
+	}
+	return out
+}
+
+func (t *droppedDataTracker) printSummary(w io.Writer) {
+	resources := t.snapshot()
+	if len(resources) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "------------------ Dropped data -------------------")
+	fmt.Fprintln(w, "  WARNING: senders reported data loss")
+	for _, name := range slices.Sorted(maps.Keys(resources)) {
+		rc := resources[name]
+		fmt.Fprintf(w, "  %s: resource attributes=%d scope attributes=%d profile attributes=%d\n",
+			name, rc.Resource, rc.Scope, rc.Profile)
+	}
+	fmt.Fprintln(w, "---------------------------------------------------")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// profileIDTracker remembers the profile IDs received within a window and warns when an ID
+// arrives again, which hints at retries or duplication in the sender. All-zero IDs are
+// reported as well, as they are not valid.
+type profileIDTracker struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	seen map[pprofile.ProfileID]time.Time
+	// order holds the IDs in the order they were first seen, to expire them.
+	order []profileIDSeen
+}
+
+type profileIDSeen struct {
+	id pprofile.ProfileID
+	at time.Time
+}
+
+func newProfileIDTracker(window time.Duration) *profileIDTracker {
+	return &profileIDTracker{
+		window: window,
+		seen:   map[pprofile.ProfileID]time.Time{},
+	}
+}
+
+func (t *profileIDTracker) check(log *slog.Logger, now time.Time, pd pprofile.Profiles) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.expire(now)
+
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rp := rps.At(i)
+		sps := rp.ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			pcs := sps.At(j).Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				id := pcs.At(k).ProfileID()
+				if id.IsEmpty() {
+					log.Warn("received profile with all-zero profile ID",
+						slog.String("resource", resourceName(mapAttributes(rp.Resource().Attributes()))))
+					continue
+				}
+
+				if first, ok := t.seen[id]; ok {
+					log.Warn("received duplicate profile ID",
+						slog.String("resource", resourceName(mapAttributes(rp.Resource().Attributes()))),
+						slog.String("profile_id", id.String()),
+						slog.Duration("since_first", now.Sub(first)))
+					continue
+				}
+				t.seen[id] = now
+				t.order = append(t.order, profileIDSeen{id: id, at: now})
+			}
+		}
+	}
+}
+
+// expire forgets the IDs first seen before the window.
+func (t *profileIDTracker) expire(now time.Time) {
+	n := 0
+	for n < len(t.order) && now.Sub(t.order[n].at) > t.window {
+		delete(t.seen, t.order[n].id)
+		n++
+	}
+	t.order = t.order[n:]
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// resourceEnricher adds attributes to received resources, e.g. metadata resolved from the
+// container.id. Attributes already set by the sender are never overwritten.
+type resourceEnricher interface {
+	enrich(attrs pcommon.Map)
+}
+
+// enrichResources runs all enrichers on every resource of the request. As this happens before
+// any output, all outputs get to see the additional attributes.
+func enrichResources(enrichers []resourceEnricher, pd pprofile.Profiles) {
+	if len(enrichers) == 0 {
+		return
+	}
+
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		attrs := rps.At(i).Resource().Attributes()
+		for _, e := range enrichers {
+			e.enrich(attrs)
+		}
+	}
+}
+
+// tagTenant sets the tenant the request was sent for as resource attribute on every resource,
+// so outputs can tell tenants apart and -split-output-by can split by it.
+func tagTenant(pd pprofile.Profiles, attribute, tenant string) {
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rps.At(i).Resource().Attributes().PutStr(attribute, tenant)
+	}
+}
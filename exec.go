@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// execConfig configures running an external command for every received profile or request.
+type execConfig struct {
+	Command string
+	// Format is json or pprof. Whole requests are passed as OTLP JSON.
+	Format string
+	// Per is profile or request.
+	Per         string
+	Concurrency int
+	Timeout     time.Duration
+}
+
+func (c *execConfig) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Command, "exec", "", "shell command to run for every received profile, which gets passed on stdin")
+	fs.StringVar(&c.Format, "exec-format", "json", "format passed to -exec (json, pprof)")
+	fs.StringVar(&c.Per, "exec-per", "profile", "run -exec per profile or per export request (profile, request), requests are passed as OTLP JSON")
+	fs.IntVar(&c.Concurrency, "exec-concurrency", 1, "number of -exec commands running in parallel")
+	fs.DurationVar(&c.Timeout, "exec-timeout", 30*time.Second, "time after which a -exec command is killed")
+}
+
+func (c execConfig) validate() error {
+	switch c.Per {
+	case "profile":
+		if c.Format != "json" && c.Format != "pprof" {
+			return fmt.Errorf("unknown exec format %q, expected json or pprof", c.Format)
+		}
+	case "request":
+		if c.Format != "json" {
+			return fmt.Errorf("requests can only be passed as json, not %q", c.Format)
+		}
+	default:
+		return fmt.Errorf("unknown exec unit %q, expected profile or request", c.Per)
+	}
+	if c.Concurrency < 1 {
+		return fmt.Errorf("exec concurrency must be at least 1")
+	}
+	return nil
+}
+
+// execHook passes received profiles to an external command. The profile ID and sample type
+// are also set as PROFILE_ID and PROFILE_SAMPLE_TYPE in the environment of the command.
+type execHook struct {
+	log    *slog.Logger
+	cfg    execConfig
+	config func() Config
+}
+
+func (e *execHook) forward(pd pprofile.Profiles) {
+	if e.cfg.Per == "request" {
+		input, err := (&pprofile.JSONMarshaler{}).MarshalProfiles(pd)
+		if err != nil {
+			e.log.Error("error encoding request for exec", slog.Any("error", err.Error()))
+			return
+		}
+		if err := e.run(input, nil); err != nil {
+			e.log.Error("error running exec command", slog.Any("error", err.Error()))
+		}
+		return
+	}
+
+	for _, view := range resolveProfiles(e.config(), pd) {
+		input, err := e.encode(view)
+		if err != nil {
+			e.log.Error("error encoding profile for exec",
+				slog.String("profile_id", view.Profile.ProfileID),
+				slog.Any("error", err.Error()))
+			continue
+		}
+		env := []string{
+			"PROFILE_ID=" + view.Profile.ProfileID,
+			"PROFILE_SAMPLE_TYPE=" + view.Profile.SampleType,
+		}
+		if err := e.run(input, env); err != nil {
+			e.log.Error("error running exec command",
+				slog.String("profile_id", view.Profile.ProfileID),
+				slog.Any("error", err.Error()))
+		}
+	}
+}
+
+func (e *execHook) encode(view profileView) ([]byte, error) {
+	if e.cfg.Format == "pprof" {
+		var b bytes.Buffer
+		if err := toPprof(view).Write(&b); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	}
+	return json.Marshal(view)
+}
+
+func (e *execHook) run(input []byte, env []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.cfg.Timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", e.cfg.Command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), env...)
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var faultCodes = map[string]codes.Code{
+	"unavailable":        codes.Unavailable,
+	"resource-exhausted": codes.ResourceExhausted,
+	"deadline-exceeded":  codes.DeadlineExceeded,
+	"internal":           codes.Internal,
+	"invalid-argument":   codes.InvalidArgument,
+}
+
+// faultConfig controls the injection of errors into Export, to test the retry behavior of
+// exporters.
+type faultConfig struct {
+	// Code is the gRPC status code returned for failed requests.
+	Code string
+	// Rate is the percentage of requests failing at random.
+	Rate float64
+	// BurstLength requests fail in a row at the start of every BurstEvery requests.
+	BurstLength int
+	BurstEvery  int
+	// RetryDelay is sent as RetryInfo detail with every failure, if set.
+	RetryDelay time.Duration
+}
+
+func (c *faultConfig) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Code, "fault-code", "unavailable", "gRPC status code of injected failures (unavailable, resource-exhausted, deadline-exceeded, internal, invalid-argument)")
+	fs.Float64Var(&c.Rate, "fault-rate", 0, "percentage of export requests failing at random (0-100)")
+	fs.IntVar(&c.BurstLength, "fault-burst", 0, "number of export requests failing in a row at the start of every -fault-burst-every requests")
+	fs.IntVar(&c.BurstEvery, "fault-burst-every", 10, "length of the cycle -fault-burst failures are injected in")
+	fs.DurationVar(&c.RetryDelay, "fault-retry-delay", 0, "retry delay sent as RetryInfo detail with injected failures (0 omits the detail)")
+}
+
+func (c faultConfig) enabled() bool {
+	return c.Rate > 0 || c.BurstLength > 0
+}
+
+// faultInjector decides for every request, whether it fails.
+type faultInjector struct {
+	cfg  faultConfig
+	code codes.Code
+
+	mu       sync.Mutex
+	requests int
+}
+
+func newFaultInjector(cfg faultConfig) (*faultInjector, error) {
+	code, ok := faultCodes[cfg.Code]
+	if !ok {
+		return nil, fmt.Errorf("unknown fault code %q", cfg.Code)
+	}
+	if cfg.Rate < 0 || cfg.Rate > 100 {
+		return nil, fmt.Errorf("fault rate %v is not within 0-100", cfg.Rate)
+	}
+	if cfg.BurstLength > 0 && cfg.BurstEvery < cfg.BurstLength {
+		return nil, fmt.Errorf("fault burst of %d does not fit into a cycle of %d requests", cfg.BurstLength, cfg.BurstEvery)
+	}
+	return &faultInjector{
+		cfg:  cfg,
+		code: code,
+	}, nil
+}
+
+// inject returns the error to fail the current request with, or nil.
+func (fi *faultInjector) inject() error {
+	fi.mu.Lock()
+	n := fi.requests
+	fi.requests++
+	fi.mu.Unlock()
+
+	inBurst := fi.cfg.BurstLength > 0 && n%fi.cfg.BurstEvery < fi.cfg.BurstLength
+	if !inBurst && rand.Float64()*100 >= fi.cfg.Rate {
+		return nil
+	}
+
+	st := status.New(fi.code, "injected failure")
+	if fi.cfg.RetryDelay > 0 {
+		if withDetails, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(fi.cfg.RetryDelay)}); err == nil {
+			st = withDetails
+		}
+	}
+	return st.Err()
+}
+
+// delayConfig delays every Export response, to reproduce a slow backend.
+type delayConfig struct {
+	Delay time.Duration
+	// Jitter adds a random duration of up to this much to Delay.
+	Jitter time.Duration
+}
+
+func (c *delayConfig) registerFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&c.Delay, "delay", 0, "time to wait before responding to an export request")
+	fs.DurationVar(&c.Jitter, "delay-jitter", 0, "random duration of up to this much added to -delay")
+}
+
+// wait blocks for the configured delay. It returns the status error to respond with, if the
+// request is canceled or its deadline is exceeded in the meantime.
+func (c delayConfig) wait(ctx context.Context) error {
+	d := c.Delay
+	if c.Jitter > 0 {
+		d += rand.N(c.Jitter)
+	}
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+)
+
+// fileWatchConfig configures tailing the files written by the collector's file exporter.
+type fileWatchConfig struct {
+	Dir string
+	// Format is json or proto, named like the file exporter setting.
+	Format string
+	// Compression is none or zstd.
+	Compression string
+	Interval    time.Duration
+	// FromBeginning also reads what's already in the files at startup.
+	FromBeginning bool
+}
+
+// fileWatcher polls a directory and feeds every new entry appended to its files into the
+// Export pipeline. JSON without compression is written one request per line by the file
+// exporter, everything else as messages prefixed by their length as big endian uint32.
+type fileWatcher struct {
+	log     *slog.Logger
+	srv     *profilesServer
+	cfg     fileWatchConfig
+	decoder *zstd.Decoder
+	// offsets is the position up to which each file has been read.
+	offsets map[string]int64
+}
+
+func newFileWatcher(log *slog.Logger, srv *profilesServer, cfg fileWatchConfig) (*fileWatcher, error) {
+	if cfg.Format != "json" && cfg.Format != "proto" {
+		return nil, fmt.Errorf("unknown file format %q, expected json or proto", cfg.Format)
+	}
+	w := &fileWatcher{
+		log:     log,
+		srv:     srv,
+		cfg:     cfg,
+		offsets: map[string]int64{},
+	}
+	switch cfg.Compression {
+	case "", "none":
+	case "zstd":
+		decoder, err := zstd.NewReader(nil)
+		if err != nil {
+			return nil, err
+		}
+		w.decoder = decoder
+	default:
+		return nil, fmt.Errorf("unknown file compression %q, expected none or zstd", cfg.Compression)
+	}
+
+	if !cfg.FromBeginning {
+		files, err := w.files()
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range files {
+			if fi, err := os.Stat(path); err == nil {
+				w.offsets[path] = fi.Size()
+			}
+		}
+	}
+	return w, nil
+}
+
+// run polls the directory until ctx is done.
+func (w *fileWatcher) run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		files, err := w.files()
+		if err != nil {
+			w.log.Error("error listing watched files", slog.String("dir", w.cfg.Dir), slog.Any("error", err.Error()))
+		}
+		for _, path := range files {
+			if err := w.read(ctx, path); err != nil {
+				w.log.Error("error reading watched file", slog.String("path", path), slog.Any("error", err.Error()))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *fileWatcher) files() ([]string, error) {
+	entries, err := os.ReadDir(w.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			files = append(files, filepath.Join(w.cfg.Dir, e.Name()))
+		}
+	}
+	return files, nil
+}
+
+// read exports all complete entries appended to the file since the last read. Incomplete
+// entries are left for the next poll.
+func (w *fileWatcher) read(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	offset := w.offsets[path]
+	if fi.Size() < offset {
+		// The file got truncated or replaced, start over.
+		offset = 0
+	}
+	if fi.Size() == offset {
+		return nil
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	for {
+		entry, n := w.next(data)
+		if n == 0 {
+			break
+		}
+		data = data[n:]
+		offset += int64(n)
+		if len(bytes.TrimSpace(entry)) == 0 {
+			continue
+		}
+		if err := w.export(ctx, path, entry); err != nil {
+			w.log.Error("error processing watched file entry", slog.String("path", path), slog.Any("error", err.Error()))
+		}
+	}
+	w.offsets[path] = offset
+	return nil
+}
+
+// next returns the first complete entry of data and the number of bytes it takes up, which
+// is zero if there is no complete entry.
+func (w *fileWatcher) next(data []byte) ([]byte, int) {
+	if w.cfg.Format == "json" && w.decoder == nil {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return nil, 0
+		}
+		return data[:i], i + 1
+	}
+
+	if len(data) < 4 {
+		return nil, 0
+	}
+	size := int(binary.BigEndian.Uint32(data))
+	if len(data) < 4+size {
+		return nil, 0
+	}
+	return data[4 : 4+size], 4 + size
+}
+
+func (w *fileWatcher) export(ctx context.Context, path string, entry []byte) error {
+	size := len(entry)
+	if w.decoder != nil {
+		var err error
+		entry, err = w.decoder.DecodeAll(entry, nil)
+		if err != nil {
+			return fmt.Errorf("error decompressing entry: %w", err)
+		}
+	}
+
+	request := pprofileotlp.NewExportRequest()
+	var err error
+	if w.cfg.Format == "json" {
+		err = request.UnmarshalJSON(entry)
+	} else {
+		err = request.UnmarshalProto(entry)
+	}
+	if err != nil {
+		ext := ".pb"
+		if w.cfg.Format == "json" {
+			ext = ".json"
+		}
+		return w.srv.decodeError(err, entry, ext)
+	}
+
+	var payload []byte
+	if w.cfg.Format != "json" {
+		payload = entry
+	}
+	ctx = context.WithValue(ctx, requestInfoKey{}, &requestInfo{
+		compression:      w.cfg.Compression,
+		peer:             "file://" + path,
+		compressedSize:   size,
+		uncompressedSize: len(entry),
+		payload:          payload,
+	})
+	_, err = w.srv.Export(ctx, request)
+	return err
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// forwardQueueSize is the number of requests buffered per forwarder, before new ones are
+// dropped.
+const forwardQueueSize = 100
+
+// forwarder sends received profiles to another backend. Forwarding happens in the background,
+// so a slow backend doesn't hold up the exporter.
+type forwarder struct {
+	name  string
+	queue *dumpQueue
+}
+
+func newForwarder(name string, workers int, forward func(pprofile.Profiles)) *forwarder {
+	return &forwarder{
+		name:  name,
+		queue: newDumpQueue(forwardQueueSize, workers, forward),
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// generatorConfig controls the shape of synthetic profiles.
+type generatorConfig struct {
+	SampleTypes     []string
+	FrameTypes      []string
+	ContainerIDs    []string
+	ServiceName     string
+	ExecutableNames []string
+	StackDepth      int
+	Samples         int
+}
+
+// profileGenerator builds synthetic profiles. Every generated request carries its own
+// dictionary, just like requests sent by real profilers.
+type profileGenerator struct {
+	cfg generatorConfig
+	rnd *rand.Rand
+}
+
+func newProfileGenerator(cfg generatorConfig, seed uint64) *profileGenerator {
+	return &profileGenerator{
+		cfg: cfg,
+		rnd: rand.New(rand.NewPCG(seed, seed)),
+	}
+}
+
+func (g *profileGenerator) generate(now time.Time) pprofile.Profiles {
+	pd := pprofile.NewProfiles()
+	dict := pd.Dictionary()
+
+	// Index 0 of every table is reserved for the zero value.
+	dict.StringTable().Append("")
+	dict.MappingTable().AppendEmpty()
+	dict.LocationTable().AppendEmpty()
+	dict.FunctionTable().AppendEmpty()
+	dict.LinkTable().AppendEmpty()
+	dict.StackTable().AppendEmpty()
+	dict.AttributeTable().AppendEmpty()
+
+	containerIDs := g.cfg.ContainerIDs
+	if len(containerIDs) == 0 {
+		containerIDs = []string{""}
+	}
+
+	for _, containerID := range containerIDs {
+		rp := pd.ResourceProfiles().AppendEmpty()
+		attrs := rp.Resource().Attributes()
+		if g.cfg.ServiceName != "" {
+			attrs.PutStr("service.name", g.cfg.ServiceName)
+		}
+		if containerID != "" {
+			attrs.PutStr("container.id", containerID)
+		}
+		if hostname, err := os.Hostname(); err == nil {
+			attrs.PutStr("host.name", hostname)
+		}
+
+		sp := rp.ScopeProfiles().AppendEmpty()
+		sp.Scope().SetName("otel-profiles-debug-server/generate")
+
+		for _, sampleType := range g.cfg.SampleTypes {
+			g.generateProfile(dict, sp.Profiles().AppendEmpty(), sampleType, now)
+		}
+	}
+
+	return pd
+}
+
+func (g *profileGenerator) generateProfile(dict pprofile.ProfilesDictionary, profile pprofile.Profile, sampleType string, now time.Time) {
+	var profileID pprofile.ProfileID
+	for i := range profileID {
+		profileID[i] = byte(g.rnd.UintN(256))
+	}
+	profile.SetProfileID(profileID)
+	profile.SetTime(pcommon.NewTimestampFromTime(now))
+	profile.SetDurationNano(uint64(5 * time.Second))
+	profile.SampleType().SetTypeStrindex(g.str(dict, sampleType))
+	profile.SampleType().SetUnitStrindex(g.str(dict, "count"))
+	profile.PeriodType().SetTypeStrindex(g.str(dict, "cpu"))
+	profile.PeriodType().SetUnitStrindex(g.str(dict, "nanoseconds"))
+	profile.SetPeriod(int64(50 * time.Millisecond))
+
+	for range g.cfg.Samples {
+		sample := profile.Samples().AppendEmpty()
+		sample.Values().Append(1)
+		sample.TimestampsUnixNano().Append(uint64(now.Add(-time.Duration(g.rnd.Int64N(int64(5 * time.Second)))).UnixNano()))
+
+		if len(g.cfg.ExecutableNames) > 0 {
+			executableName := g.cfg.ExecutableNames[g.rnd.IntN(len(g.cfg.ExecutableNames))]
+			sample.AttributeIndices().Append(g.attr(dict, "process.executable.name", executableName))
+		}
+		sample.AttributeIndices().Append(g.attr(dict, "thread.name", fmt.Sprintf("thread-%d", g.rnd.IntN(4))))
+
+		stack := pprofile.NewStack()
+		for depth := range g.cfg.StackDepth {
+			frameType := g.cfg.FrameTypes[g.rnd.IntN(len(g.cfg.FrameTypes))]
+			stack.LocationIndices().Append(g.location(dict, frameType, depth))
+		}
+		stackIndex, _ := pprofile.SetStack(dict.StackTable(), stack)
+		sample.SetStackIndex(stackIndex)
+	}
+}
+
+func (g *profileGenerator) location(dict pprofile.ProfilesDictionary, frameType string, depth int) int32 {
+	location := pprofile.NewLocation()
+	location.AttributeIndices().Append(g.attr(dict, "profile.frame.type", frameType))
+
+	switch frameType {
+	case "native", "kernel":
+		mapping := pprofile.NewMapping()
+		filename := "/usr/lib/libsynthetic.so"
+		if frameType == "kernel" {
+			filename = "vmlinux"
+		}
+		mapping.SetFilenameStrindex(g.str(dict, filename))
+		mapping.SetMemoryStart(0x1000)
+		mapping.SetMemoryLimit(0x100000)
+		mappingIndex, _ := pprofile.SetMapping(dict.MappingTable(), mapping)
+		location.SetMappingIndex(mappingIndex)
+		location.SetAddress(0x1000 + uint64(g.rnd.IntN(16))*0x10 + uint64(depth)*0x100)
+	default:
+		function := pprofile.NewFunction()
+		function.SetNameStrindex(g.str(dict, fmt.Sprintf("%s_func_%d_%d", frameType, depth, g.rnd.IntN(4))))
+		function.SetFilenameStrindex(g.str(dict, fmt.Sprintf("%s/file_%d", frameType, depth)))
+		functionIndex, _ := pprofile.SetFunction(dict.FunctionTable(), function)
+		line := location.Lines().AppendEmpty()
+		line.SetFunctionIndex(functionIndex)
+		line.SetLine(int64(10 + depth))
+	}
+
+	locationIndex, _ := pprofile.SetLocation(dict.LocationTable(), location)
+	return locationIndex
+}
+
+func (g *profileGenerator) str(dict pprofile.ProfilesDictionary, s string) int32 {
+	idx, _ := pprofile.SetString(dict.StringTable(), s)
+	return idx
+}
+
+func (g *profileGenerator) attr(dict pprofile.ProfilesDictionary, key, value string) int32 {
+	attr := pprofile.NewKeyValueAndUnit()
+	attr.SetKeyStrindex(g.str(dict, key))
+	attr.Value().SetStr(value)
+	idx, _ := pprofile.SetAttribute(dict.AttributeTable(), attr)
+	return idx
+}
+
+type exportFunc func(ctx context.Context, request pprofileotlp.ExportRequest) error
+
+// newHTTPExporter returns an exportFunc posting protobuf encoded requests to the given OTLP/HTTP
+// profiles URL.
+func newHTTPExporter(url string, compression string) exportFunc {
+	return func(ctx context.Context, request pprofileotlp.ExportRequest) error {
+		data, err := request.MarshalProto()
+		if err != nil {
+			return fmt.Errorf("error marshalling request: %w", err)
+		}
+
+		var body bytes.Buffer
+		switch compression {
+		case "gzip":
+			w := gzip.NewWriter(&body)
+			w.Write(data)
+			w.Close()
+		case "zstd":
+			w, err := zstd.NewWriter(&body)
+			if err != nil {
+				return err
+			}
+			w.Write(data)
+			w.Close()
+		default:
+			compression = ""
+			body.Write(data)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentTypeProtobuf)
+		if compression != "" {
+			req.Header.Set("Content-Encoding", compression)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			msg, _ := io.ReadAll(resp.Body)
+			return fmt.Errorf("unexpected status %s: %s", resp.Status, bytes.TrimSpace(msg))
+		}
+		return nil
+	}
+}
+
+// runGenerate builds synthetic profiles and exports them to the given endpoint. It returns
+// the exit code of the process.
+func runGenerate(args []string) int {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	endpoint := fs.String("endpoint", "127.0.0.1:4137", "OTLP endpoint to export profiles to, either a gRPC target or an http(s):// URL for OTLP/HTTP")
+	requests := fs.Int("requests", 1, "number of export requests to send")
+	interval := fs.Duration("interval", time.Second, "time to wait between requests")
+	compression := fs.String("compression", "gzip", "compression to use (gzip, zstd, snappy, none)")
+	seed := fs.Uint64("seed", uint64(time.Now().UnixNano()), "seed for the random generator")
+	cfg := generatorConfig{
+		SampleTypes: []string{"events"},
+		FrameTypes:  []string{"native", "kernel", "go"},
+	}
+	fs.Var((*stringSliceFlag)(&cfg.ContainerIDs), "container-ids", "container IDs to generate a resource profile for (repeatable)")
+	fs.Var((*stringSliceFlag)(&cfg.ExecutableNames), "executable-names", "process.executable.name values to attach to samples (repeatable)")
+	sampleTypes := stringSliceFlag{}
+	fs.Var(&sampleTypes, "sample-types", "sample types to generate a profile for (repeatable, default events, the type the server dumps)")
+	frameTypes := stringSliceFlag{}
+	fs.Var(&frameTypes, "frame-types", "frame types to use for generated frames (repeatable, default native,kernel,go)")
+	fs.StringVar(&cfg.ServiceName, "service-name", "synthetic", "service.name resource attribute")
+	fs.IntVar(&cfg.StackDepth, "stack-depth", 8, "number of frames per stack")
+	fs.IntVar(&cfg.Samples, "samples", 10, "number of samples per profile")
+	fs.Parse(args)
+
+	if len(sampleTypes) > 0 {
+		cfg.SampleTypes = sampleTypes
+	}
+	if len(frameTypes) > 0 {
+		cfg.FrameTypes = frameTypes
+	}
+
+	var export exportFunc
+	if strings.HasPrefix(*endpoint, "http://") || strings.HasPrefix(*endpoint, "https://") {
+		switch *compression {
+		case "gzip", "zstd", "none", "":
+		default:
+			fmt.Fprintf(os.Stderr, "unsupported compression %q for OTLP/HTTP\n", *compression)
+			return 2
+		}
+		export = newHTTPExporter(strings.TrimSuffix(*endpoint, "/")+otlpHTTPProfilesPath, *compression)
+	} else {
+		var callOpts []grpc.CallOption
+		switch *compression {
+		case "gzip", "zstd", "snappy":
+			callOpts = append(callOpts, grpc.UseCompressor(*compression))
+		case "none", "":
+		default:
+			fmt.Fprintf(os.Stderr, "unsupported compression %q\n", *compression)
+			return 2
+		}
+
+		conn, err := grpc.NewClient(*endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error creating client: %v\n", err)
+			return 1
+		}
+		defer conn.Close()
+		client := pprofileotlp.NewGRPCClient(conn)
+		export = func(ctx context.Context, request pprofileotlp.ExportRequest) error {
+			_, err := client.Export(ctx, request, callOpts...)
+			return err
+		}
+	}
+
+	gen := newProfileGenerator(cfg, *seed)
+	for i := range *requests {
+		if i > 0 {
+			time.Sleep(*interval)
+		}
+
+		pd := gen.generate(time.Now())
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := export(ctx, pprofileotlp.NewExportRequestFromProfiles(pd))
+		cancel()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error exporting request %d: %v\n", i+1, err)
+			return 1
+		}
+		fmt.Printf("sent request %d/%d (%d profiles, %d samples)\n", i+1, *requests, pd.ResourceProfiles().Len()*len(cfg.SampleTypes), pd.SampleCount())
+	}
+
+	return 0
+}
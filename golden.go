@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// goldenConfig is the dump configuration of golden files: everything is resolved, nothing is
+// filtered.
+var goldenConfig = Config{Config: dump.Config{ExportLocationAttributes: true}}
+
+// renderGolden writes a canonical text rendering of a request for golden file comparisons.
+// Attributes are sorted by key, profiles and samples by their rendering, so the output only
+// depends on the content of the request and not on the order or the dictionary layout the
+// sender chose. With normalize, profile IDs are left out and timestamps are rendered relative
+// to the time of their profile, so recordings of different runs compare equal.
+func renderGolden(w io.Writer, pd pprofile.Profiles, normalize bool) error {
+	var profiles []string
+	for _, view := range resolveProfiles(goldenConfig, pd) {
+		profiles = append(profiles, renderGoldenProfile(view, normalize))
+	}
+	slices.Sort(profiles)
+	_, err := io.WriteString(w, strings.Join(profiles, "\n"))
+	return err
+}
+
+func renderGoldenProfile(view profileView, normalize bool) string {
+	var b strings.Builder
+	b.WriteString("resource\n")
+	if view.Resource.SchemaURL != "" {
+		fmt.Fprintf(&b, "  schema_url %s\n", view.Resource.SchemaURL)
+	}
+	writeGoldenAttributes(&b, "  ", view.Resource.Attributes, nil)
+	fmt.Fprintf(&b, "scope %q version %q\n", view.Scope.Name, view.Scope.Version)
+	if view.Scope.SchemaURL != "" {
+		fmt.Fprintf(&b, "  schema_url %s\n", view.Scope.SchemaURL)
+	}
+
+	p := view.Profile
+	fmt.Fprintf(&b, "profile %s [%s]\n", p.SampleType, p.SampleUnit)
+	fmt.Fprintf(&b, "  period %d %s [%s]\n", p.Period, p.PeriodType, p.PeriodUnit)
+	if !normalize {
+		fmt.Fprintf(&b, "  profile_id %s\n", p.ProfileID)
+		fmt.Fprintf(&b, "  time %d\n", p.Time.UnixNano())
+	}
+	fmt.Fprintf(&b, "  duration %s\n", p.Duration)
+	if p.DroppedAttributesCount > 0 {
+		fmt.Fprintf(&b, "  dropped_attributes_count %d\n", p.DroppedAttributesCount)
+	}
+	writeGoldenAttributes(&b, "  ", p.Attributes, p.AttributeUnits)
+
+	samples := make([]string, len(p.Samples))
+	for i, sample := range p.Samples {
+		var s strings.Builder
+		fmt.Fprintf(&s, "  sample values %v\n", sample.Values)
+		for _, ts := range sample.Timestamps {
+			if normalize {
+				fmt.Fprintf(&s, "    timestamp %+d\n", ts.Sub(p.Time).Nanoseconds())
+			} else {
+				fmt.Fprintf(&s, "    timestamp %d\n", ts.UnixNano())
+			}
+		}
+		if sample.TraceID != "" {
+			fmt.Fprintf(&s, "    link trace_id %s span_id %s\n", sample.TraceID, sample.SpanID)
+		}
+		writeGoldenAttributes(&s, "    ", sample.Attributes, sample.AttributeUnits)
+		for _, frame := range sample.Frames {
+			fmt.Fprintf(&s, "    frame %s %s", frame.Type, goldenFrame(frame))
+			if frame.Inlined {
+				s.WriteString(" inlined")
+			}
+			s.WriteString("\n")
+			writeGoldenAttributes(&s, "      ", frame.Attributes, nil)
+		}
+		samples[i] = s.String()
+	}
+	slices.Sort(samples)
+	for _, s := range samples {
+		b.WriteString(s)
+	}
+	return b.String()
+}
+
+// goldenFrame renders a frame by function and source position, or address and mapping if it's
+// not symbolized.
+func goldenFrame(frame frameView) string {
+	if frame.Function == "" {
+		return fmt.Sprintf("%#x %s", frame.Address, strconv.Quote(frame.Mapping))
+	}
+	return fmt.Sprintf("%q %s:%d:%d", frame.Function, frame.File, frame.Line, frame.Column)
+}
+
+func writeGoldenAttributes(b *strings.Builder, indent string, attrs, units map[string]string) {
+	for _, k := range slices.Sorted(maps.Keys(attrs)) {
+		fmt.Fprintf(b, "%sattr %s=%q", indent, k, attrs[k])
+		if unit := units[k]; unit != "" {
+			fmt.Fprintf(b, " [%s]", unit)
+		}
+		b.WriteString("\n")
+	}
+}
+
+// goldenWriter writes the canonical rendering of every received request to its own file.
+// Files are numbered by arrival only, so recordings of different runs have the same names.
+type goldenWriter struct {
+	log       *slog.Logger
+	dir       string
+	normalize bool
+
+	seq atomic.Int64
+}
+
+func newGoldenWriter(log *slog.Logger, dir string, normalize bool) (*goldenWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &goldenWriter{log: log, dir: dir, normalize: normalize}, nil
+}
+
+func (w *goldenWriter) forward(pd pprofile.Profiles) {
+	path := filepath.Join(w.dir, fmt.Sprintf("request-%06d.golden", w.seq.Add(1)))
+	f, err := os.Create(path)
+	if err == nil {
+		err = renderGolden(f, pd, w.normalize)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		w.log.Error("error writing golden file", slog.String("path", path), slog.Any("error", err.Error()))
+	}
+}
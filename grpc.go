@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/proto"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/mem"
+	"google.golang.org/grpc/reflection"
+)
+
+// grpcLimits holds the tunables of the gRPC server. Zero values keep the grpc-go defaults.
+type grpcLimits struct {
+	MaxRecvMsgSize           int
+	MaxConcurrentStreams     uint
+	KeepaliveTime            time.Duration
+	KeepaliveTimeout         time.Duration
+	KeepaliveMinTime         time.Duration
+	KeepalivePermitNoStreams bool
+}
+
+func (l *grpcLimits) registerFlags(fs *flag.FlagSet) {
+	fs.IntVar(&l.MaxRecvMsgSize, "grpc-max-recv-msg-size", 16<<20, "maximum size in bytes of a received gRPC message or OTLP/HTTP body, compressed or not")
+	fs.UintVar(&l.MaxConcurrentStreams, "grpc-max-concurrent-streams", 0, "maximum number of concurrent streams per gRPC connection (0 means no limit)")
+	fs.DurationVar(&l.KeepaliveTime, "grpc-keepalive-time", 0, "ping clients after this duration of inactivity (0 keeps the grpc default)")
+	fs.DurationVar(&l.KeepaliveTimeout, "grpc-keepalive-timeout", 0, "close connections if a keepalive ping is not answered within this duration (0 keeps the grpc default)")
+	fs.DurationVar(&l.KeepaliveMinTime, "grpc-keepalive-min-time", 0, "minimum time clients must wait between keepalive pings (0 keeps the grpc default)")
+	fs.BoolVar(&l.KeepalivePermitNoStreams, "grpc-keepalive-permit-without-stream", false, "allow client keepalive pings without active streams")
+}
+
+// maxRecvMsgSize returns the effective maximum size of a received message, which OTLP/HTTP
+// requests are held to as well.
+func (l grpcLimits) maxRecvMsgSize() int {
+	if l.MaxRecvMsgSize > 0 {
+		return l.MaxRecvMsgSize
+	}
+	// The grpc-go default.
+	return 4 << 20
+}
+
+func (l grpcLimits) serverOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+
+	if l.MaxRecvMsgSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(l.MaxRecvMsgSize))
+	}
+	if l.MaxConcurrentStreams > 0 {
+		opts = append(opts, grpc.MaxConcurrentStreams(uint32(l.MaxConcurrentStreams)))
+	}
+	if l.KeepaliveTime > 0 || l.KeepaliveTimeout > 0 {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    l.KeepaliveTime,
+			Timeout: l.KeepaliveTimeout,
+		}))
+	}
+	if l.KeepaliveMinTime > 0 || l.KeepalivePermitNoStreams {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             l.KeepaliveMinTime,
+			PermitWithoutStream: l.KeepalivePermitNoStreams,
+		}))
+	}
+
+	return opts
+}
+
+const profilesServiceName = "opentelemetry.proto.collector.profiles.v1development.ProfilesService"
+
+// registerServices registers the profiles service along with the standard health and
+// reflection services on the given server.
+func registerServices(s *grpc.Server, srv *profilesServer) *health.Server {
+	s.RegisterService(&profilesServiceDesc, srv)
+
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(profilesServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, healthServer)
+
+	reflection.Register(s)
+
+	return healthServer
+}
+
+// profilesServiceDesc is the profiles service of pprofileotlp.RegisterGRPCServer, except that
+// requests are decoded by profilesExportHandler instead of the codec. It requires the server to
+// use serverCodec.
+var profilesServiceDesc = grpc.ServiceDesc{
+	ServiceName: profilesServiceName,
+	HandlerType: (*pprofileotlp.GRPCServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Export",
+		Handler:    profilesExportHandler,
+	}},
+	Metadata: "opentelemetry/proto/collector/profiles/v1development/profiles_service.proto",
+}
+
+// profilesExportHandler decodes export requests and applies the error policy to the ones that
+// fail to decode, which only affects the profiles service. grpc-go responds with Internal to
+// any error of the codec, the policy rejects them with InvalidArgument.
+func profilesExportHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	var data rawMessage
+	if err := dec(&data); err != nil {
+		return nil, err
+	}
+	f := srv.(*profilesServer)
+	request := pprofileotlp.NewExportRequest()
+	if err := request.UnmarshalProto(data); err != nil {
+		if err := f.decodeError(err, data, ".pb"); err != nil {
+			return nil, err
+		}
+		return pprofileotlp.NewExportResponse(), nil
+	}
+
+	if interceptor == nil {
+		return f.Export(ctx, request)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + profilesServiceName + "/Export",
+	}
+	return interceptor(ctx, request, info, func(ctx context.Context, req any) (any, error) {
+		return f.Export(ctx, req.(pprofileotlp.ExportRequest))
+	})
+}
+
+// rawMessage is a gRPC message passed through encoded by serverCodec.
+type rawMessage []byte
+
+// serverCodec is the proto codec of the gRPC server. It passes raw messages through and encodes
+// the responses of the profiles service, see profilesServiceDesc.
+type serverCodec struct {
+	encoding.CodecV2
+}
+
+func newServerCodec() serverCodec {
+	return serverCodec{CodecV2: encoding.GetCodecV2(proto.Name)}
+}
+
+func (c serverCodec) Marshal(v any) (mem.BufferSlice, error) {
+	switch v := v.(type) {
+	case *rawMessage:
+		return mem.BufferSlice{mem.SliceBuffer(*v)}, nil
+	case pprofileotlp.ExportResponse:
+		data, err := v.MarshalProto()
+		if err != nil {
+			return nil, err
+		}
+		return mem.BufferSlice{mem.SliceBuffer(data)}, nil
+	}
+	return c.CodecV2.Marshal(v)
+}
+
+func (c serverCodec) Unmarshal(data mem.BufferSlice, v any) error {
+	if m, ok := v.(*rawMessage); ok {
+		*m = data.Materialize()
+		return nil
+	}
+	return c.CodecV2.Unmarshal(data, v)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	otlpHTTPProfilesPath = "/v1development/profiles"
+
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+// newOTLPHTTPHandler returns a handler implementing the OTLP/HTTP profiles endpoint, feeding
+// the very same pipeline as the gRPC service. Bodies larger than maxSize bytes, compressed or
+// not, are rejected like gRPC messages exceeding it.
+func newOTLPHTTPHandler(srv *profilesServer, maxSize int) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+otlpHTTPProfilesPath, func(w http.ResponseWriter, r *http.Request) {
+		contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || (contentType != contentTypeProtobuf && contentType != contentTypeJSON) {
+			http.Error(w, fmt.Sprintf("unsupported content type %q", r.Header.Get("Content-Type")), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		received := time.Now()
+		encoding := r.Header.Get("Content-Encoding")
+		compressed := &countingReader{r: http.MaxBytesReader(w, r.Body, int64(maxSize))}
+		body, err := decompressHTTPBody(encoding, compressed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer body.Close()
+		data, err := readBody(body, maxSize)
+		if _, ok := status.FromError(err); err != nil && ok {
+			srv.log.Warn("rejecting export request", slog.Any("error", err.Error()),
+				slog.Int64("rejected", srv.stats.requestsRejected.Add(1)))
+			writeExportError(w, err)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error reading body: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		request := pprofileotlp.NewExportRequest()
+		if contentType == contentTypeJSON {
+			err = request.UnmarshalJSON(data)
+		} else {
+			err = request.UnmarshalProto(data)
+		}
+		if err != nil {
+			ext := ".pb"
+			if contentType == contentTypeJSON {
+				ext = ".json"
+			}
+			if err := srv.decodeError(err, data, ext); err != nil {
+				writeExportError(w, err)
+				return
+			}
+			writeExportResponse(w, contentType, pprofileotlp.NewExportResponse())
+			return
+		}
+
+		md := metadata.MD{}
+		for k, v := range r.Header {
+			md.Append(k, v...)
+		}
+		var payload []byte
+		if contentType != contentTypeJSON {
+			payload = data
+		}
+		ctx := context.WithValue(r.Context(), requestInfoKey{}, &requestInfo{
+			compression:      encoding,
+			peer:             r.RemoteAddr,
+			metadata:         md,
+			compressedSize:   compressed.n,
+			uncompressedSize: len(data),
+			received:         received,
+			decoded:          time.Now(),
+			payload:          payload,
+		})
+		response, err := srv.Export(ctx, request)
+		if err != nil {
+			writeExportError(w, err)
+			return
+		}
+
+		writeExportResponse(w, contentType, response)
+	})
+
+	srv.registerHealthHandlers(mux)
+
+	return mux
+}
+
+func writeExportResponse(w http.ResponseWriter, contentType string, response pprofileotlp.ExportResponse) {
+	var out []byte
+	var err error
+	if contentType == contentTypeJSON {
+		out, err = response.MarshalJSON()
+	} else {
+		out, err = response.MarshalProto()
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error encoding response: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+// writeExportError maps the gRPC status returned by Export to the status code OTLP/HTTP
+// exporters expect. A RetryInfo detail is sent as Retry-After header.
+func writeExportError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	for _, d := range st.Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(ri.GetRetryDelay().AsDuration().Seconds()))))
+		}
+	}
+
+	code := http.StatusInternalServerError
+	switch st.Code() {
+	case codes.Unavailable:
+		code = http.StatusServiceUnavailable
+	case codes.ResourceExhausted:
+		code = http.StatusTooManyRequests
+	case codes.DeadlineExceeded:
+		code = http.StatusGatewayTimeout
+	case codes.InvalidArgument:
+		code = http.StatusBadRequest
+	}
+	http.Error(w, st.Message(), code)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// readBody reads a request body, stopping at limit bytes instead of decompressing the rest of
+// it. Exceeding the limit returns a status error.
+func readBody(r io.Reader, limit int) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if maxBytesErr := (*http.MaxBytesError)(nil); errors.As(err, &maxBytesErr) {
+		return nil, status.Errorf(codes.ResourceExhausted, "request body exceeds the limit of %d bytes", limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > limit {
+		return nil, status.Errorf(codes.ResourceExhausted, "request exceeds the limit of %d bytes", limit)
+	}
+	return data, nil
+}
+
+func decompressHTTPBody(encoding string, body io.Reader) (io.ReadCloser, error) {
+	switch encoding {
+	case "", "identity":
+		return io.NopCloser(body), nil
+	case "gzip":
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, fmt.Errorf("error creating gzip reader: %w", err)
+		}
+		return r, nil
+	case "zstd":
+		r, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("error creating zstd reader: %w", err)
+		}
+		return r.IOReadCloser(), nil
+	case "snappy":
+		return io.NopCloser(snappy.NewReader(body)), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// k8sRefreshInterval rate limits pod list refreshes triggered by unknown container IDs. It
+	// exceeds the client timeout, so refreshes don't overlap.
+	k8sRefreshInterval = 10 * time.Second
+)
+
+type k8sContainerInfo struct {
+	podName       string
+	podUID        string
+	namespace     string
+	nodeName      string
+	containerName string
+	workloadKind  string
+	workloadName  string
+}
+
+// k8sEnricher resolves container IDs to pods, by listing the pods running on the node either
+// from the kubelet or the API server.
+type k8sEnricher struct {
+	log     *slog.Logger
+	client  *http.Client
+	podsURL string
+	token   string
+
+	mu          sync.Mutex
+	containers  map[string]k8sContainerInfo
+	lastRefresh time.Time
+}
+
+type k8sEnricherConfig struct {
+	// Source is either kubelet or apiserver.
+	Source             string
+	KubeletURL         string
+	NodeName           string
+	InsecureSkipVerify bool
+}
+
+func newK8sEnricher(log *slog.Logger, cfg k8sEnricherConfig) (*k8sEnricher, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify}
+	if ca, err := os.ReadFile(serviceAccountDir + "/ca.crt"); err == nil && !cfg.InsecureSkipVerify {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM(ca)
+		tlsConfig.RootCAs = pool
+	}
+
+	var podsURL string
+	switch cfg.Source {
+	case "kubelet":
+		podsURL = strings.TrimSuffix(cfg.KubeletURL, "/") + "/pods"
+	case "apiserver":
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, fmt.Errorf("KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT must be set for -k8s-enrich apiserver")
+		}
+		podsURL = "https://" + net.JoinHostPort(host, port) + "/api/v1/pods"
+		if cfg.NodeName != "" {
+			podsURL += "?fieldSelector=" + url.QueryEscape("spec.nodeName="+cfg.NodeName)
+		}
+	default:
+		return nil, fmt.Errorf("unknown kubernetes metadata source %q, expected kubelet or apiserver", cfg.Source)
+	}
+
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		log.Warn("no service account token found, querying pods unauthenticated", slog.Any("error", err.Error()))
+	}
+
+	e := &k8sEnricher{
+		log: log,
+		client: &http.Client{
+			Timeout:   5 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+		podsURL:     podsURL,
+		token:       strings.TrimSpace(string(token)),
+		containers:  map[string]k8sContainerInfo{},
+		lastRefresh: time.Now(),
+	}
+	// List the pods right away, so the first requests are enriched already.
+	go e.refresh()
+	return e, nil
+}
+
+func (e *k8sEnricher) enrich(attrs pcommon.Map) {
+	containerID, ok := attrs.Get("container.id")
+	if !ok || containerID.AsString() == "" {
+		return
+	}
+
+	info, ok := e.lookup(containerID.AsString())
+	if !ok {
+		return
+	}
+
+	putMissing(attrs, "k8s.pod.name", info.podName)
+	putMissing(attrs, "k8s.pod.uid", info.podUID)
+	putMissing(attrs, "k8s.namespace.name", info.namespace)
+	putMissing(attrs, "k8s.node.name", info.nodeName)
+	putMissing(attrs, "k8s.container.name", info.containerName)
+	if info.workloadKind != "" {
+		putMissing(attrs, "k8s."+strings.ToLower(info.workloadKind)+".name", info.workloadName)
+	}
+}
+
+// lookup returns the pod of the container. Unknown container IDs trigger a refresh of the pod
+// list in the background, so they are only resolved in later requests, without holding up the
+// export of this one.
+func (e *k8sEnricher) lookup(containerID string) (k8sContainerInfo, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if info, ok := e.containers[containerID]; ok {
+		return info, true
+	}
+	if time.Since(e.lastRefresh) < k8sRefreshInterval {
+		return k8sContainerInfo{}, false
+	}
+
+	e.lastRefresh = time.Now()
+	go e.refresh()
+	return k8sContainerInfo{}, false
+}
+
+func (e *k8sEnricher) refresh() {
+	containers, err := e.listContainers()
+	if err != nil {
+		e.log.Error("error listing pods", slog.Any("error", err.Error()))
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.containers = containers
+}
+
+type k8sPodList struct {
+	Items []struct {
+		Metadata struct {
+			Name            string `json:"name"`
+			Namespace       string `json:"namespace"`
+			UID             string `json:"uid"`
+			OwnerReferences []struct {
+				Kind       string `json:"kind"`
+				Name       string `json:"name"`
+				Controller bool   `json:"controller"`
+			} `json:"ownerReferences"`
+		} `json:"metadata"`
+		Spec struct {
+			NodeName string `json:"nodeName"`
+		} `json:"spec"`
+		Status struct {
+			ContainerStatuses          []k8sContainerStatus `json:"containerStatuses"`
+			InitContainerStatuses      []k8sContainerStatus `json:"initContainerStatuses"`
+			EphemeralContainerStatuses []k8sContainerStatus `json:"ephemeralContainerStatuses"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+type k8sContainerStatus struct {
+	Name        string `json:"name"`
+	ContainerID string `json:"containerID"`
+}
+
+func (e *k8sEnricher) listContainers() (map[string]k8sContainerInfo, error) {
+	req, err := http.NewRequest(http.MethodGet, e.podsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if e.token != "" {
+		req.Header.Set("Authorization", "Bearer "+e.token)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s from %s", resp.Status, e.podsURL)
+	}
+
+	var pods k8sPodList
+	if err := json.NewDecoder(resp.Body).Decode(&pods); err != nil {
+		return nil, fmt.Errorf("error decoding pod list: %w", err)
+	}
+
+	containers := map[string]k8sContainerInfo{}
+	for _, pod := range pods.Items {
+		var workloadKind, workloadName string
+		for _, owner := range pod.Metadata.OwnerReferences {
+			if !owner.Controller {
+				continue
+			}
+			workloadKind, workloadName = owner.Kind, owner.Name
+			// Pods of a deployment are owned by a replica set named <deployment>-<hash>.
+			if owner.Kind == "ReplicaSet" {
+				if idx := strings.LastIndex(owner.Name, "-"); idx > 0 {
+					workloadKind, workloadName = "Deployment", owner.Name[:idx]
+				}
+			}
+		}
+
+		statuses := append(append(pod.Status.ContainerStatuses, pod.Status.InitContainerStatuses...), pod.Status.EphemeralContainerStatuses...)
+		for _, status := range statuses {
+			if status.ContainerID == "" {
+				continue
+			}
+			// Container IDs are reported as <runtime>://<id>.
+			_, id, ok := strings.Cut(status.ContainerID, "://")
+			if !ok {
+				id = status.ContainerID
+			}
+			containers[id] = k8sContainerInfo{
+				podName:       pod.Metadata.Name,
+				podUID:        pod.Metadata.UID,
+				namespace:     pod.Metadata.Namespace,
+				nodeName:      pod.Spec.NodeName,
+				containerName: status.Name,
+				workloadKind:  workloadKind,
+				workloadName:  workloadName,
+			}
+		}
+	}
+
+	return containers, nil
+}
+
+func putMissing(attrs pcommon.Map, key, value string) {
+	if value == "" {
+		return
+	}
+	if _, ok := attrs.Get(key); ok {
+		return
+	}
+	attrs.PutStr(key, value)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"google.golang.org/grpc/metadata"
+)
+
+// kafkaSourceConfig configures consuming profiles from a Kafka topic, as written by the
+// collector's kafka exporter.
+type kafkaSourceConfig struct {
+	Brokers []string
+	Topic   string
+	// Group is the consumer group to join. Without a group, all partitions are consumed and
+	// no offsets are committed.
+	Group string
+	// Encoding is otlp_proto or otlp_json, named like the kafka exporter setting.
+	Encoding string
+	// FromBeginning starts consuming at the oldest instead of the newest offset.
+	FromBeginning bool
+}
+
+// consumeKafka feeds every message of the topic into the Export pipeline until ctx is done.
+func consumeKafka(ctx context.Context, log *slog.Logger, srv *profilesServer, cfg kafkaSourceConfig) error {
+	if cfg.Encoding != "otlp_proto" && cfg.Encoding != "otlp_json" {
+		return fmt.Errorf("unknown kafka encoding %q, expected otlp_proto or otlp_json", cfg.Encoding)
+	}
+
+	offset := kgo.NewOffset().AtEnd()
+	if cfg.FromBeginning {
+		offset = kgo.NewOffset().AtStart()
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(cfg.Brokers...),
+		kgo.ConsumeTopics(cfg.Topic),
+		kgo.ConsumeResetOffset(offset),
+	}
+	if cfg.Group != "" {
+		opts = append(opts, kgo.ConsumerGroup(cfg.Group))
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return fmt.Errorf("error creating kafka client: %w", err)
+	}
+	defer client.Close()
+
+	for {
+		fetches := client.PollFetches(ctx)
+		if fetches.IsClientClosed() || ctx.Err() != nil {
+			return nil
+		}
+		fetches.EachError(func(topic string, partition int32, err error) {
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			log.Error("error fetching from kafka",
+				slog.String("topic", topic),
+				slog.Int("partition", int(partition)),
+				slog.Any("error", err.Error()))
+		})
+		fetches.EachRecord(func(r *kgo.Record) {
+			if err := exportKafkaRecord(ctx, srv, cfg.Encoding, r); err != nil {
+				log.Error("error processing kafka message",
+					slog.String("topic", r.Topic),
+					slog.Int("partition", int(r.Partition)),
+					slog.Int64("offset", r.Offset),
+					slog.Any("error", err.Error()))
+			}
+		})
+	}
+}
+
+func exportKafkaRecord(ctx context.Context, srv *profilesServer, encoding string, r *kgo.Record) error {
+	request := pprofileotlp.NewExportRequest()
+	var err error
+	if encoding == "otlp_json" {
+		err = request.UnmarshalJSON(r.Value)
+	} else {
+		err = request.UnmarshalProto(r.Value)
+	}
+	if err != nil {
+		ext := ".pb"
+		if encoding == "otlp_json" {
+			ext = ".json"
+		}
+		return srv.decodeError(err, r.Value, ext)
+	}
+
+	md := metadata.MD{}
+	for _, h := range r.Headers {
+		md.Append(h.Key, string(h.Value))
+	}
+	var payload []byte
+	if encoding != "otlp_json" {
+		payload = r.Value
+	}
+	ctx = context.WithValue(ctx, requestInfoKey{}, &requestInfo{
+		peer:             fmt.Sprintf("kafka://%s/%d@%d", r.Topic, r.Partition, r.Offset),
+		metadata:         md,
+		compressedSize:   len(r.Value),
+		uncompressedSize: len(r.Value),
+		payload:          payload,
+	})
+	_, err = srv.Export(ctx, request)
+	return err
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// listenUnix creates a listener on the unix domain socket at the given path. A stale socket
+// left behind by a previous run gets removed first, any other file at that path is an error.
+func listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("removing stale socket: %w", err)
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation.
+const listenFDsStart = 3
+
+// activatedListener is a socket passed in by systemd socket activation. The name is set with
+// FileDescriptorName= in the socket unit: "http" sockets serve OTLP/HTTP, "api" sockets the
+// HTTP API and all others gRPC.
+type activatedListener struct {
+	name string
+	net.Listener
+}
+
+// systemdListeners returns the sockets passed by systemd socket activation, or none if the
+// process wasn't started that way. The LISTEN_* environment variables are unset, so that child
+// processes don't pick up the sockets.
+func systemdListeners() ([]activatedListener, error) {
+	pid, fds, names := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q: %w", fds, err)
+	}
+	fdNames := strings.Split(names, ":")
+
+	var listeners []activatedListener
+	for i := 0; i < n; i++ {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := "grpc"
+		if i < len(fdNames) && fdNames[i] != "" {
+			name = fdNames[i]
+		}
+
+		f := os.NewFile(uintptr(fd), name)
+		lis, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket %d (%s) is not a listening socket: %w", fd, name, err)
+		}
+		listeners = append(listeners, activatedListener{name: name, Listener: lis})
+	}
+	return listeners, nil
+}
@@ -2,242 +2,1241 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
-	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
 	"go.opentelemetry.io/collector/pdata/pprofile"
 	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
 	"google.golang.org/grpc"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
 	// The latest profiler sends the data gzip encoded.
 	_ "google.golang.org/grpc/encoding/gzip"
 )
 
 func newProfilesServer(cfg Config) *profilesServer {
 	return &profilesServer{
-		config: cfg,
+		log:          slog.Default(),
+		dumpLog:      slog.New(dump.NewPlainHandler(os.Stdout, slog.LevelInfo)),
+		out:          os.Stdout,
+		stream:       newProfileStream(),
+		config:       cfg,
+		stats:        newRunStats(),
+		dropped:      newDroppedDataTracker(),
+		resources:    dump.NewResourceCache(),
+		limitReached: make(chan struct{}),
 	}
 }
 
 type Config struct {
-	ExportResourceAttributes         bool
-	ExportProfileAttributes          bool
-	ExportSampleAttributes           bool
-	ExportStackFrames                bool
-	ExportStackFrameTypes            []string
-	IgnoreProfilesWithoutContainerID bool
-	FilterSampleTypes                []string
-	FilterExecutableNames            []string
+	dump.Config
+	// ExitAfterProfiles signals the server to stop once this many profiles have been
+	// received. Zero means no limit.
+	ExitAfterProfiles int64
 }
 
 type profilesServer struct {
 	pprofileotlp.UnimplementedGRPCServer
-	config Config
+	log *slog.Logger
+	// dumpLog receives the dump of all received profiles. Dump lines are logged at info, skip
+	// notices at warn level.
+	dumpLog *slog.Logger
+	// template replaces the regular dump, if set. Its output goes to out.
+	template *profileTemplate
+	// perfScript writes the profiles to out in the format of perf script instead of the regular dump.
+	perfScript bool
+	out        io.Writer
+	// stream publishes received profiles to live subscribers of the HTTP API.
+	stream *profileStream
+	// enrichers add metadata to received resources before anything else happens.
+	enrichers []resourceEnricher
+	// symbolizer resolves the names of address-only frames after enrichment, if set.
+	symbolizer *symbolizer
+	// redactor hides sensitive attribute values right after enrichment.
+	redactor *redactor
+	// anonymizer pseudonymizes identifying values after redaction.
+	anonymizer *anonymizer
+	// rates periodically prints per-resource rates, if set.
+	rates *rateDashboard
+	// topTalkers periodically prints the resources sending the most, if set.
+	topTalkers *topTalkers
+	// resources logs every resource the first time it's seen, by fingerprint.
+	resources *dump.ResourceCache
+	// dropped warns about and sums up the data senders report as dropped.
+	dropped *droppedDataTracker
+	// skew warns about profiles whose time drifts from the receive time, if set.
+	skew *clockSkewDetector
+	// profileIDs warns about duplicate and all-zero profile IDs, if set.
+	profileIDs *profileIDTracker
+	// schema warns about missing or unexpected schema URLs, if set.
+	schema *schemaChecker
+	// semconv checks attributes against the semantic conventions, if set.
+	semconv *semconvLinter
+	// attributeStats records the attribute keys seen at every level, if set.
+	attributeStats *attributeStats
+	// cardinality warns about attribute keys with too many distinct values, if set.
+	cardinality *cardinalityDetector
+	// unsymbolized warns about profiles with too many address-only frames, if set.
+	unsymbolized *unsymbolizedChecker
+	// ring keeps recently received profiles in memory for the HTTP API, if set.
+	ring *profileRing
+	// traces maps the trace IDs of recently received samples to the samples, if set.
+	traces *traceIndex
+	// rollups aggregates received samples into per service and function time series, if set.
+	rollups *rollups
+	// split dumps every resource into its own file instead of dumpLog, if set.
+	split *splitOutput
+	// queue dumps requests asynchronously, if set.
+	queue *dumpQueue
+	// forwarders send requests to other backends.
+	forwarders []*forwarder
+	// memory rejects oversized requests and requests exceeding the memory budget, if set.
+	memory *memoryGuard
+	// onError decides what happens to requests that fail to decode or process.
+	onError errorPolicy
+	// faults fails requests on purpose, if set.
+	faults *faultInjector
+	// delay is waited before every response.
+	delay delayConfig
+	// partialSuccess is returned for every request, if enabled.
+	partialSuccess partialSuccessConfig
+	// configMu guards config, which the admin API changes at runtime.
+	configMu sync.RWMutex
+	config   Config
+	// logRequestMetadata adds the peer, user agent and request metadata to the request log.
+	logRequestMetadata bool
+	// reportRequests adds the size and decode time to the request log and logs the time it took
+	// to dump every request.
+	reportRequests bool
+	// rawFormat prints every request as encoded on the wire before the dump, if set.
+	rawFormat string
+
+	stats        *runStats
+	limitReached chan struct{}
+	limitOnce    sync.Once
+
+	// tenantHeader is the request metadata key holding the tenant, tenantAttribute the
+	// resource attribute the tenant is added as.
+	tenantHeader    string
+	tenantAttribute string
+	// paused stops dumping while set, toggled by SIGUSR1 and the admin API.
+	paused atomic.Bool
+	// ready is set once all listeners are accepting and cleared on shutdown, for /readyz.
+	ready atomic.Bool
+	// adminAPI enables the /admin endpoints of the HTTP API.
+	adminAPI bool
+	// assertion is checked against every received request, if set.
+	assertion    *assertion
+	dumpDisabled bool
+}
+
+func (f *profilesServer) Export(ctx context.Context, request pprofileotlp.ExportRequest) (response pprofileotlp.ExportResponse, err error) {
+	defer f.recoverExport(request, &response, &err)
+
+	info := requestInfoFromContext(ctx)
+	attrs := []slog.Attr{
+		slog.String("compression", info.Compression()),
+		slog.Int("resource_profiles", request.Profiles().ResourceProfiles().Len()),
+	}
+	totals := f.stats.recordCompression(info.Compression(), info.CompressedSize(), info.UncompressedSize())
+	if f.reportRequests {
+		attrs = append(attrs, info.SizeAttrs()...)
+		attrs = append(attrs, slog.Group("compression_totals",
+			slog.Int64("requests", totals.Requests),
+			slog.Int64("compressed_bytes", totals.CompressedBytes),
+			slog.Int64("uncompressed_bytes", totals.UncompressedBytes)))
+	}
+	if f.logRequestMetadata {
+		attrs = append(attrs, info.LogAttrs()...)
+	}
+	tenant := ""
+	if f.tenantHeader != "" {
+		tenant = info.Metadata(f.tenantHeader)
+		if tenant == "" {
+			tenant = "unknown"
+		}
+		attrs = append(attrs, slog.String("tenant", tenant))
+	}
+	// With -follow, requests without the followed workload are processed silently.
+	followed := f.followed(request.Profiles())
+	if followed {
+		f.log.LogAttrs(ctx, slog.LevelInfo, "received export request", attrs...)
+	}
+	if f.rawFormat != "" && followed && !f.dumpDisabled && !f.paused.Load() {
+		if err := printRaw(f.out, f.rawFormat, info, request); err != nil {
+			f.log.Error("error printing raw request", slog.Any("error", err.Error()))
+		}
+	}
+
+	// The reservation is only checked once the request is decoded, gRPC requests exceeding
+	// the request size limit are rejected before by -grpc-max-recv-msg-size.
+	var res *reservation
+	if f.memory != nil {
+		res, err = f.memory.acquire(requestSize(info, request.Profiles()))
+		if err != nil {
+			f.log.Warn("rejecting export request", slog.Any("error", err.Error()),
+				slog.Int64("rejected", f.stats.requestsRejected.Add(1)))
+			return pprofileotlp.NewExportResponse(), err
+		}
+		defer res.done()
+	}
+
+	if err := f.delay.wait(ctx); err != nil {
+		f.log.Warn("request ended during delay", slog.Any("error", err.Error()))
+		return pprofileotlp.NewExportResponse(), err
+	}
+	if f.faults != nil {
+		if err := f.faults.inject(); err != nil {
+			f.log.Warn("injecting failure", slog.Any("error", err.Error()))
+			return pprofileotlp.NewExportResponse(), err
+		}
+	}
+
+	// Lint before enriching, so only what the sender sent is checked.
+	if f.semconv != nil {
+		f.semconv.check(f.log, request.Profiles())
+	}
+	if f.schema != nil {
+		f.schema.check(f.log, request.Profiles())
+	}
+	if report := dump.CheckReferences(request.Profiles()); !report.Empty() {
+		f.stats.corruptRequests.Add(1)
+		if err := f.processingError("request contains invalid dictionary references", errors.New(report.String()), request); err != nil {
+			return pprofileotlp.NewExportResponse(), err
+		}
+	}
+	if report := dump.CheckStringTable(request.Profiles().Dictionary()); !report.Empty() {
+		f.stats.stringTableIssues.Add(1)
+		f.log.Warn("string table issues", slog.String("issues", report.String()),
+			slog.Int("strings", request.Profiles().Dictionary().StringTable().Len()))
+	}
+	if tenant != "" {
+		tagTenant(request.Profiles(), f.tenantAttribute, tenant)
+	}
+	enrichResources(f.enrichers, request.Profiles())
+	if f.symbolizer != nil {
+		f.symbolizer.symbolize(request.Profiles())
+	}
+	if f.redactor != nil {
+		f.redactor.redact(request.Profiles())
+	}
+	if f.anonymizer != nil {
+		f.anonymizer.anonymize(request.Profiles())
+	}
+	// The example values must not reveal what -redact-attr and -anonymize hide.
+	if f.attributeStats != nil {
+		f.attributeStats.record(request.Profiles())
+	}
+	if f.cardinality != nil {
+		f.cardinality.check(f.log, request.Profiles())
+	}
+	f.recordStats(tenant, request.Profiles())
+	f.logNewResources(request.Profiles())
+	f.dropped.check(f.log, request.Profiles())
+	if f.rates != nil {
+		f.rates.record(info.CompressedSize(), request.Profiles())
+	}
+	if f.topTalkers != nil {
+		f.topTalkers.record(info.CompressedSize(), request.Profiles())
+	}
+	if f.skew != nil {
+		f.skew.check(f.log, time.Now(), request.Profiles())
+	}
+	if f.profileIDs != nil {
+		f.profileIDs.check(f.log, time.Now(), request.Profiles())
+	}
+	if f.unsymbolized != nil {
+		f.unsymbolized.check(f.log, request.Profiles())
+	}
+	switch {
+	case f.dumpDisabled, f.paused.Load():
+	case f.queue != nil:
+		if !f.queue.enqueue(request.Profiles(), res) {
+			f.log.Warn("dump queue is full, dropping request", slog.Int64("dropped", f.stats.dumpsDropped.Add(1)))
+		}
+	default:
+		f.dump(request.Profiles())
+	}
+	for _, fw := range f.forwarders {
+		if !fw.queue.enqueue(request.Profiles(), res) {
+			f.log.Warn("forward queue is full, dropping request", slog.String("forwarder", fw.name))
+		}
+	}
+	if f.assertion != nil {
+		f.assertion.observe(request.Profiles())
+	}
+	config := f.currentConfig()
+	if subscribed := f.stream.hasSubscribers(); subscribed || f.ring != nil {
+		views := resolveProfiles(config, request.Profiles())
+		if subscribed {
+			f.stream.publish(views)
+		}
+		if f.ring != nil {
+			f.ring.add(time.Now(), views)
+		}
+	}
+	if f.traces != nil {
+		f.traces.add(time.Now(), request.Profiles())
+	}
+	if f.rollups != nil {
+		// Backends aggregate everything they receive, regardless of the dump filters.
+		f.rollups.add(time.Now(), resolveProfiles(Config{}, request.Profiles()))
+	}
+
+	if config.ExitAfterProfiles > 0 && f.stats.profiles.Load() >= config.ExitAfterProfiles {
+		f.limitOnce.Do(func() {
+			close(f.limitReached)
+		})
+	}
+
+	response = pprofileotlp.NewExportResponse()
+	if f.partialSuccess.enabled() {
+		f.partialSuccess.apply(f.log, response, request.Profiles())
+	}
+	return response, nil
+}
+
+// dump writes the request to the configured output.
+func (f *profilesServer) dump(pd pprofile.Profiles) {
+	if f.reportRequests {
+		start := time.Now()
+		defer func() {
+			f.log.Info("dumped export request",
+				slog.Int("resource_profiles", pd.ResourceProfiles().Len()),
+				slog.Duration("dump_time", time.Since(start)))
+		}()
+	}
+
+	config := f.currentConfig()
+	switch {
+	case f.template != nil:
+		if err := f.template.render(f.out, config, pd); err != nil {
+			f.log.Error("error rendering template", slog.Any("error", err.Error()))
+		}
+	case f.perfScript:
+		if err := writePerfScript(f.out, resolveProfiles(config, pd)); err != nil {
+			f.log.Error("error writing perf script output", slog.Any("error", err.Error()))
+		}
+	case f.split != nil:
+		if err := f.split.dump(config, pd); err != nil {
+			f.log.Error("error writing split output", slog.Any("error", err.Error()))
+		}
+	default:
+		dump.Profiles(f.dumpLog, config.Config, pd)
+	}
 }
 
-func (f *profilesServer) Export(ctx context.Context, request pprofileotlp.ExportRequest) (pprofileotlp.ExportResponse, error) {
-	dumpProfile(f.config, request.Profiles())
+// currentConfig returns the configuration, which can be changed at runtime via the admin API.
+func (f *profilesServer) currentConfig() Config {
+	f.configMu.RLock()
+	defer f.configMu.RUnlock()
+	return f.config
+}
 
-	return pprofileotlp.NewExportResponse(), nil
+// LimitReached returns a channel that is closed once the configured amount of profiles
+// has been received.
+func (f *profilesServer) LimitReached() <-chan struct{} {
+	return f.limitReached
 }
 
-func dumpProfile(config Config, pd pprofile.Profiles) {
-	mappingTable := pd.Dictionary().MappingTable()
-	locationTable := pd.Dictionary().LocationTable()
-	attributeTable := pd.Dictionary().AttributeTable()
-	functionTable := pd.Dictionary().FunctionTable()
-	stringTable := pd.Dictionary().StringTable()
+// recordStats counts the request, and its profiles by tenant if the tenant is set.
+func (f *profilesServer) recordStats(tenant string, pd pprofile.Profiles) {
+	f.stats.requests.Add(1)
+
 	rps := pd.ResourceProfiles()
+	f.stats.resourceProfiles.Add(int64(rps.Len()))
 	for i := 0; i < rps.Len(); i++ {
-		rp := rps.At(i)
-
-		if config.IgnoreProfilesWithoutContainerID {
-			containerID, ok := rp.Resource().Attributes().Get("container.id")
-			if !ok || containerID.AsString() == "" {
-				fmt.Println("--------------- New Resource Profile --------------")
-				fmt.Println("              SKIPPED (no container.id)")
-				fmt.Printf("-------------- End Resource Profile ---------------\n\n")
-				continue
+		sps := rps.At(i).ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			pcs := sps.At(j).Profiles()
+			f.stats.profiles.Add(int64(pcs.Len()))
+			if tenant != "" {
+				f.stats.mu.Lock()
+				f.stats.tenantProfiles[tenant] += int64(pcs.Len())
+				f.stats.mu.Unlock()
+			}
+			for k := 0; k < pcs.Len(); k++ {
+				f.stats.samples.Add(int64(pcs.At(k).Samples().Len()))
 			}
 		}
+	}
+}
 
-		fmt.Println("--------------- New Resource Profile --------------")
-		if config.ExportResourceAttributes {
-			if rp.Resource().Attributes().Len() > 0 {
-				rp.Resource().Attributes().Range(func(k string, v pcommon.Value) bool {
-					fmt.Printf("  %s: %v\n", k, v.AsString())
-					return true
-				})
-			}
+// followed returns whether the request contains a resource selected by -follow, which is
+// true for all requests if it's not set.
+func (f *profilesServer) followed(pd pprofile.Profiles) bool {
+	config := f.currentConfig()
+	if len(config.Follow) == 0 {
+		return true
+	}
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		if dump.IncludeResource(config.Config, rps.At(i).Resource().Attributes()) {
+			return true
 		}
+	}
+	return false
+}
 
-		sps := rp.ScopeProfiles()
-		for j := 0; j < sps.Len(); j++ {
-			pcs := sps.At(j).Profiles()
-			for k := 0; k < pcs.Len(); k++ {
-				profile := pcs.At(k)
-				sampleType := stringTable.At(int(profile.SampleType().TypeStrindex()))
+// logNewResources logs the full attributes of every resource the first time it's seen.
+func (f *profilesServer) logNewResources(pd pprofile.Profiles) {
+	config := f.currentConfig()
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		attrs := rps.At(i).Resource().Attributes()
+		fingerprint, seen := f.resources.See(attrs)
+		if seen || !dump.IncludeResource(config.Config, attrs) {
+			continue
+		}
+		resource := mapAttributes(attrs)
+		var group []any
+		for _, k := range slices.Sorted(maps.Keys(resource)) {
+			group = append(group, slog.String(k, resource[k]))
+		}
+		f.log.Info("NEW RESOURCE", slog.String("fingerprint", fingerprint), slog.Group("resource", group...))
+	}
+}
 
-				if len(config.FilterSampleTypes) > 0 && !slices.Contains(config.FilterSampleTypes, sampleType) {
-					continue
-				}
+// listenAddress returns the address to listen on. An explicit listen address takes precedence
+// over the port, which is only ever bound on localhost.
+func listenAddress(listen string, port int) string {
+	if listen != "" {
+		return listen
+	}
+	return net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+}
 
-				fmt.Println("------------------- New Profile -------------------")
-				fmt.Printf("  ProfileID: %x\n", [16]byte(profile.ProfileID()))
-				fmt.Printf("  Time: %v\n", profile.Time().AsTime())
-				fmt.Printf("  Duration: %v\n", time.Duration(profile.DurationNano()*uint64(time.Nanosecond)))
-				fmt.Printf("  PeriodType: [%v, %v]\n",
-					stringTable.At(int(profile.PeriodType().TypeStrindex())),
-					stringTable.At(int(profile.PeriodType().UnitStrindex())))
-
-				fmt.Printf("  Period: %v\n", profile.Period())
-				fmt.Printf("  Dropped attributes count: %d\n", profile.DroppedAttributesCount())
-				fmt.Printf("  SampleType: %s\n", sampleType)
-
-				profileAttrs := profile.AttributeIndices()
-				if profileAttrs.Len() > 0 {
-					for n := 0; n < profileAttrs.Len(); n++ {
-						attr := attributeTable.At(int(profileAttrs.At(n)))
-						fmt.Printf("  %s: %s\n", stringTable.At(int(attr.KeyStrindex())), attr.Value().AsString())
-					}
-					fmt.Println("~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~")
-				}
+// handleOutputSignals reopens the output on SIGHUP and periodically flushes it, if the output
+// supports it.
+func handleOutputSignals(log *slog.Logger, out any) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	flushTicker := time.NewTicker(time.Second)
+	defer flushTicker.Stop()
 
-				samples := profile.Samples()
-
-				for l := 0; l < samples.Len(); l++ {
-					sample := samples.At(l)
-					executableName := getAttributeValue(sample.AttributeIndices(), attributeTable, stringTable, "process.executable.name")
-					if len(config.FilterExecutableNames) > 0 && !slices.Contains(config.FilterExecutableNames, executableName) {
-						continue
-					}
-
-					fmt.Println("------------------- New Sample --------------------")
-
-					for t := 0; t < sample.TimestampsUnixNano().Len(); t++ {
-						sampleTimestampUnixNano := sample.TimestampsUnixNano().At(t)
-						sampleTimestampNano := time.Unix(0, int64(sampleTimestampUnixNano))
-						fmt.Printf("  Timestamp[%d]: %d (%s)\n", t,
-							sampleTimestampUnixNano,
-							sampleTimestampNano)
-					}
-
-					if config.ExportSampleAttributes {
-						sampleAttrs := sample.AttributeIndices()
-						for n := 0; n < sampleAttrs.Len(); n++ {
-							attr := attributeTable.At(int(sampleAttrs.At(n)))
-							fmt.Printf("  %s: %s\n", stringTable.At(int(attr.KeyStrindex())), attr.Value().AsString())
-						}
-						fmt.Println("---------------------------------------------------")
-					}
-
-					profileLocationsIndices := pd.Dictionary().StackTable().At(int(sample.StackIndex())).LocationIndices()
-
-					if config.ExportStackFrames {
-						for m := 0; m < profileLocationsIndices.Len(); m++ {
-							location := locationTable.At(int(profileLocationsIndices.At(int(m))))
-							locationAttrs := location.AttributeIndices()
-
-							unwindType := "unknown"
-							for la := 0; la < locationAttrs.Len(); la++ {
-								attr := attributeTable.At(int(locationAttrs.At(la)))
-								if stringTable.At(int(attr.KeyStrindex())) == "profile.frame.type" {
-									unwindType = attr.Value().AsString()
-									break
-								}
-							}
-
-							if len(config.ExportStackFrameTypes) > 0 &&
-								!slices.Contains(config.ExportStackFrameTypes, unwindType) {
-								continue
-							}
-
-							locationLine := location.Lines()
-							if locationLine.Len() == 0 {
-								filename := "<unknown>"
-								if location.MappingIndex() > 0 {
-									mapping := mappingTable.At(int(location.MappingIndex()))
-									filename = stringTable.At(int(mapping.FilenameStrindex()))
-								}
-								fmt.Printf("Instrumentation: %s: Function: %#04x, File: %s\n", unwindType, location.Address(), filename)
-							}
-
-							for n := 0; n < locationLine.Len(); n++ {
-								line := locationLine.At(n)
-								function := functionTable.At(int(line.FunctionIndex()))
-								functionName := stringTable.At(int(function.NameStrindex()))
-								fileName := stringTable.At(int(function.FilenameStrindex()))
-								fmt.Printf("Instrumentation: %s, Function: %s, File: %s, Line: %d, Column: %d\n",
-									unwindType, functionName, fileName, line.Line(), line.Column())
-							}
-						}
-					}
-
-					fmt.Println("------------------- End Sample --------------------")
+	for {
+		select {
+		case <-hup:
+			if r, ok := out.(interface{ Reopen() error }); ok {
+				if err := r.Reopen(); err != nil {
+					log.Error("error reopening output", slog.Any("error", err.Error()))
+					continue
+				}
+				log.Info("reopened output")
+			}
+		case <-flushTicker.C:
+			if f, ok := out.(interface{ Flush() error }); ok {
+				if err := f.Flush(); err != nil {
+					log.Error("error flushing output", slog.Any("error", err.Error()))
 				}
-				fmt.Println("------------------- End Profile -------------------")
 			}
 		}
-
-		fmt.Printf("-------------- End Resource Profile ---------------\n\n")
 	}
 }
 
-func getAttributeValue(attrs pcommon.Int32Slice, attrTable pprofile.KeyValueAndUnitSlice, stringTable pcommon.StringSlice, key string) string {
-	for _, idx := range attrs.All() {
-		attr := attrTable.At(int(idx))
-
-		if stringTable.At(int(attr.KeyStrindex())) != key {
-			continue
+// handlePauseSignal toggles dumping on SIGUSR1. Requests are still accepted, counted and
+// forwarded while dumping is paused.
+func handlePauseSignal(log *slog.Logger, srv *profilesServer) {
+	usr1 := make(chan os.Signal, 1)
+	signal.Notify(usr1, syscall.SIGUSR1)
+	for range usr1 {
+		paused := !srv.paused.Load()
+		srv.paused.Store(paused)
+		if paused {
+			log.Info("paused dumping")
+		} else {
+			log.Info("resumed dumping")
 		}
-
-		return attr.Value().AsString()
 	}
+}
 
-	return ""
+// gracefulStop stops s after the pending RPCs finished, or forcefully once ctx is done.
+func gracefulStop(ctx context.Context, log *slog.Logger, s *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Warn("shutdown timeout elapsed, closing remaining grpc connections")
+		s.Stop()
+		<-stopped
+	}
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "assert":
+			os.Exit(runAssert(os.Args[2:]))
+		case "generate", "send":
+			os.Exit(runGenerate(os.Args[2:]))
+		case "query":
+			os.Exit(runQuery(os.Args[2:]))
+		case "diff":
+			os.Exit(runDiff(os.Args[2:]))
+		case "trim":
+			os.Exit(runTrim(os.Args[2:]))
+		case "compare":
+			os.Exit(runCompare(os.Args[2:]))
+		}
+	}
+
 	log := slog.Default()
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	// exitCode is set when a listener fails. It's deferred first to run last, after the
+	// output has been flushed and closed.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
 	defer cancel()
 
-	port := flag.Int("port", 4137, "port to listen on")
+	port := flag.Int("port", 4137, "port to listen on, ignored if -listen is set")
+	var listens, listenUnixPaths, listenHTTPs stringSliceFlag
+	flag.Var(&listens, "listen", "host:port to serve gRPC on, e.g. 0.0.0.0:4137 or [::]:4137 (repeatable, default 127.0.0.1:<port>)")
+	flag.Var(&listenUnixPaths, "listen-unix", "path of a unix domain socket to additionally serve gRPC on (repeatable)")
+	flag.Var(&listenHTTPs, "listen-http", "host:port to additionally serve OTLP/HTTP and the /healthz and /readyz probes on (repeatable)")
+	apiListen := flag.String("api-listen", "", "host:port to serve the HTTP API on, e.g. the live stream at /api/stream, and the /healthz and /readyz probes")
+	debugListen := flag.String("debug-listen", "", "host:port to serve the Go pprof and expvar endpoints of the server itself on, at /debug/pprof/ and /debug/vars")
+	adminAPI := flag.Bool("api-admin", false, "serve /admin endpoints on the HTTP API to change filters, pause and resume dumping and rotate the output at runtime")
+	retainProfiles := flag.Int("retain-profiles", 1000, "number of profiles kept in memory for the HTTP API (0 means no limit)")
+	rollupInterval := flag.Duration("rollup-interval", 0, "interval to aggregate received samples into per service and function time series for /api/rollups of the HTTP API, like a backend would (0 disables)")
+	rollupWindow := flag.Duration("rollup-window", time.Hour, "time the -rollup-interval time series are kept for")
+	traceIndexWindow := flag.Duration("trace-index-window", 5*time.Minute, "time the trace IDs of received samples are kept for /api/traces of the HTTP API (0 disables)")
+	retainDuration := flag.Duration("retain-duration", 0, "time profiles are kept in memory for the HTTP API (0 means no limit)")
+	exitAfterProfiles := flag.Int64("exit-after-profiles", 0, "exit after receiving this many profiles (0 means no limit)")
+	exitAfterDuration := flag.Duration("exit-after-duration", 0, "exit after the given duration has elapsed (0 means no limit)")
+	dumpQueueSize := flag.Int("dump-queue-size", 1000, "number of requests buffered for dumping before new ones get dropped (0 dumps synchronously)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "time to wait for in-flight requests on shutdown before closing the remaining connections (0 waits indefinitely)")
+	dumpWorkers := flag.Int("dump-workers", 1, "number of workers dumping queued requests, output of concurrent requests may interleave with more than one")
+	var limits grpcLimits
+	limits.registerFlags(flag.CommandLine)
+	var faults faultConfig
+	faults.registerFlags(flag.CommandLine)
+	var memory memoryConfig
+	memory.registerFlags(flag.CommandLine)
+	var onError errorPolicy
+	onError.registerFlags(flag.CommandLine)
+	logRequestMetadata := flag.Bool("log-request-metadata", false, "log the peer address, user agent and metadata headers of every export request")
+	var kafkaConfig kafkaSourceConfig
+	var kafkaBrokers stringSliceFlag
+	flag.Var(&kafkaBrokers, "kafka-brokers", "Kafka brokers to consume profiles from, in addition to the listeners (repeatable)")
+	flag.StringVar(&kafkaConfig.Topic, "kafka-topic", "otlp_profiles", "Kafka topic to consume profiles from")
+	flag.StringVar(&kafkaConfig.Group, "kafka-group", "", "Kafka consumer group to join (default consumes all partitions without committing offsets)")
+	flag.StringVar(&kafkaConfig.Encoding, "kafka-encoding", "otlp_proto", "encoding of the Kafka messages (otlp_proto, otlp_json)")
+	flag.BoolVar(&kafkaConfig.FromBeginning, "kafka-from-beginning", false, "consume the topic from the oldest instead of the newest message")
+	var watchConfig fileWatchConfig
+	flag.StringVar(&watchConfig.Dir, "watch-dir", "", "directory written by the collector file exporter to tail for profiles, in addition to the listeners")
+	flag.StringVar(&watchConfig.Format, "watch-format", "json", "format of the watched files (json, proto)")
+	flag.StringVar(&watchConfig.Compression, "watch-compression", "none", "compression of the watched files (none, zstd)")
+	flag.DurationVar(&watchConfig.Interval, "watch-interval", time.Second, "interval the watched directory is polled in")
+	flag.BoolVar(&watchConfig.FromBeginning, "watch-from-beginning", false, "also process what is already in the watched files at startup")
+	var pyroscope pyroscopeConfig
+	flag.StringVar(&pyroscope.URL, "pyroscope-url", "", "Pyroscope server to forward received profiles to, e.g. http://localhost:4040")
+	flag.StringVar(&pyroscope.AppName, "pyroscope-app-name", "otel-profiles", "Pyroscope application name of resources without service.name")
+	flag.StringVar(&pyroscope.TenantID, "pyroscope-tenant-id", "", "tenant sent as X-Scope-OrgID to Pyroscope")
+	flag.StringVar(&pyroscope.Username, "pyroscope-username", "", "basic auth user for Pyroscope")
+	flag.StringVar(&pyroscope.Password, "pyroscope-password", os.Getenv("PYROSCOPE_PASSWORD"), "basic auth password for Pyroscope")
+	var parca parcaConfig
+	flag.StringVar(&parca.Address, "parca-address", "", "Parca gRPC address to write received profiles to, e.g. localhost:7070")
+	flag.BoolVar(&parca.Insecure, "parca-insecure", false, "connect to Parca without TLS")
+	flag.StringVar(&parca.BearerToken, "parca-bearer-token", os.Getenv("PARCA_BEARER_TOKEN"), "bearer token sent to Parca")
+	acceptTraces := flag.Bool("accept-traces", false, "additionally accept and dump OTLP traces via gRPC, e.g. to correlate spans with profile sample links")
+	acceptLogs := flag.Bool("accept-logs", false, "additionally accept and dump OTLP logs via gRPC")
+	binaryLogPath := flag.String("grpc-binary-log", "", "file to write a gRPC binary log of all RPCs to, OTLP/HTTP requests are not included")
+	rawFormat := flag.String("raw-format", "", "print every request as encoded on the wire before the dump, one of "+strings.Join(rawFormats, ", ")+", not with -redact-attr or -anonymize (disabled if empty)")
+	reportRequests := flag.Bool("report-requests", false, "log the size, decode and dump time of every export request")
+	var delay delayConfig
+	delay.registerFlags(flag.CommandLine)
+	var execCfg execConfig
+	execCfg.registerFlags(flag.CommandLine)
+	var webhook webhookConfig
+	webhook.registerFlags(flag.CommandLine)
+	var capture captureConfig
+	capture.registerFlags(flag.CommandLine)
+	var merge mergeConfig
+	merge.registerFlags(flag.CommandLine)
+	chromeTraceDir := flag.String("chrome-trace-dir", "", "directory to write the timestamped samples of every request to as a Chrome trace event file for about://tracing or Perfetto (disabled if empty)")
+	goldenDir := flag.String("golden-dir", "", "directory to write a canonical, stable-ordered text rendering of every received request to, for golden file comparisons (disabled if empty)")
+	goldenNormalize := flag.Bool("golden-normalize", true, "leave profile IDs out of -golden-dir files and write timestamps relative to their profile")
+	otlpJSONDir := flag.String("otlp-json-dir", "", "directory to write every received profile to as a standalone OTLP JSON file with a trimmed dictionary (disabled if empty)")
+	var csvCfg csvConfig
+	csvCfg.registerFlags(flag.CommandLine)
+	var parquetCfg parquetConfig
+	parquetCfg.registerFlags(flag.CommandLine)
+	var clickhouse clickhouseConfig
+	clickhouse.registerFlags(flag.CommandLine)
+	var partialSuccess partialSuccessConfig
+	partialSuccess.registerFlags(flag.CommandLine)
+	output := flag.String("output", "stdout", "destination of the dump output (stdout, stderr, file); server logs always go to stderr")
+	outputFile := flag.String("output-file", "", "file to append the dump output to, implies -output file")
+	var rotation rotationConfig
+	flag.Int64Var(&rotation.MaxSize, "output-file-max-size", 0, "rotate the output file once it exceeds this many bytes (0 disables rotation)")
+	flag.IntVar(&rotation.MaxFiles, "output-file-max-files", 5, "number of rotated output files to keep")
+	flag.BoolVar(&rotation.Compress, "output-file-compress", false, "gzip rotated output files")
+	splitOutputBy := flag.String("split-output-by", "", "resource attribute, e.g. container.id, to split the dump output by into one file per value")
+	splitOutputDir := flag.String("split-output-dir", ".", "directory the files of -split-output-by are written to")
+	splitMaxOpenFiles := flag.Int("split-max-open-files", 128, "number of -split-output-by files kept open, less recently used ones are closed until they are written to again")
+	colorMode := flag.String("color", "auto", "colorize the plain dump output (always, never, auto)")
+	sqlitePath := flag.String("sqlite", "", "SQLite database to persist received profiles to, unfiltered by the dump flags, see the query subcommand")
+	var k8sConfig k8sEnricherConfig
+	flag.StringVar(&k8sConfig.Source, "k8s-enrich", "", "resolve container.id to kubernetes pod metadata via the kubelet or apiserver")
+	flag.StringVar(&k8sConfig.KubeletURL, "k8s-kubelet-url", "https://127.0.0.1:10250", "kubelet URL used by -k8s-enrich kubelet")
+	flag.StringVar(&k8sConfig.NodeName, "k8s-node-name", os.Getenv("NODE_NAME"), "node to list pods of for -k8s-enrich apiserver")
+	flag.BoolVar(&k8sConfig.InsecureSkipVerify, "k8s-insecure-skip-verify", false, "skip TLS verification when talking to the kubelet or apiserver")
+	var runtimeConfig runtimeEnricherConfig
+	var runtimeNamespaces stringSliceFlag
+	flag.StringVar(&runtimeConfig.Runtime, "runtime-enrich", "", "resolve container.id to container and image names via the local docker or containerd socket")
+	flag.StringVar(&runtimeConfig.Socket, "runtime-socket", "", "socket of the container runtime (default /var/run/docker.sock or /run/containerd/containerd.sock)")
+	flag.Var(&runtimeNamespaces, "runtime-containerd-namespaces", "containerd namespaces to search for containers (repeatable, default k8s.io,moby,default)")
+	symbolize := flag.Bool("symbolize", false, "resolve the function names of address-only native frames from local ELF files")
+	var symbolDirs stringSliceFlag
+	flag.Var(&symbolDirs, "symbol-dir", "directory to look up -symbolize files in, by build ID (.build-id/xx/yyyy.debug) or mapping file name (repeatable, default the mapped file itself)")
+	var debuginfodURLs stringSliceFlag
+	flag.Var(&debuginfodURLs, "debuginfod-url", "debuginfod server to download -symbolize debug info from by build ID (repeatable, default $DEBUGINFOD_URLS)")
+	debuginfodCache := flag.String("debuginfod-cache", "", "directory to cache debug info downloaded from debuginfod in (default in the user cache directory)")
+	var redactAttrs stringSliceFlag
+	hideRepeatedResources := flag.Bool("hide-repeated-resource-attrs", false, "print the attributes of a resource only when they change, and the fingerprint of the resource otherwise")
+	var follow stringSliceFlag
+	flag.Var(&follow, "follow", "key=pattern resource attribute selecting the only workload to dump and log requests of, e.g. service.name=checkout or k8s.pod.name=checkout-* (repeatable, all must match)")
+	var sampleTypes stringSliceFlag
+	flag.Var(&sampleTypes, "filter-sample-type", "sample type of the profiles to dump, e.g. off_cpu or wall (repeatable, default events)")
+	var scopeNames stringSliceFlag
+	flag.Var(&scopeNames, "filter-scope-name", "path.Match pattern of the instrumentation scope names to dump, e.g. go.opentelemetry.io/ebpf-profiler, or to skip when prefixed with ! (repeatable)")
+	flag.Var(&redactAttrs, "redact-attr", "attribute key pattern, e.g. process.command_args or *.env.*, whose values are redacted from all output and forwards (repeatable)")
+	redactMode := flag.String("redact-mode", "replace", "how -redact-attr values are redacted (replace: [REDACTED], hash: sha256 prefix)")
+	anonymize := flag.Bool("anonymize", false, "pseudonymize host names, container and pod identifiers and file paths with a keyed hash, to make dumps shareable")
+	anonymizeKey := flag.String("anonymize-key", os.Getenv("ANONYMIZE_KEY"), "key of the -anonymize hash, keeps pseudonyms stable across runs (default random)")
+	maxAttrLength := flag.Int("max-attr-length", 0, "truncate attribute values longer than this many bytes in the dump output (0 disables truncation)")
+	maxStackDepth := flag.Int("max-stack-depth", 0, "dump at most this many frames per sample (0 dumps all)")
+	groupByProcess := flag.Bool("group-by-process", false, "dump samples grouped by process.executable.name and process.pid with per-process subtotals")
+	threadTopStacks := flag.Int("thread-top-stacks", 0, "dump the sample count, value and this many top stacks per thread.name of every profile (0 disables)")
+	locationAttributes := flag.Bool("location-attributes", false, "dump all location attributes besides profile.frame.type with every frame")
+	splitKernel := flag.Bool("split-kernel", false, "separate the kernel and user space frames of every stack and dump the kernel/user sample ratio of every profile")
+	frameTypeHistogram := flag.Bool("frame-type-histogram", false, "dump the distribution of frame types and the share of unsymbolized native frames of every profile")
+	tenantHeader := flag.String("tenant-header", "", "request metadata key or HTTP header holding the tenant, e.g. x-scope-orgid; the tenant is logged, counted and added as resource attribute, see -tenant-attribute")
+	tenantAttribute := flag.String("tenant-attribute", "tenant.id", "resource attribute the tenant of -tenant-header is added as, e.g. to split the output by it with -split-output-by")
+	topTalkerCount := flag.Int("top-talkers", 0, "periodically print the top K resources by samples and bytes per second with their identifying attributes (0 disables)")
+	topTalkerInterval := flag.Duration("top-talkers-interval", 30*time.Second, "interval to print the -top-talkers at")
+	rateInterval := flag.Duration("rate-interval", 0, "print profiles, samples and bytes per second and unique stacks per service and container at this interval, e.g. 10s (0 disables)")
+	dictionaryStats := flag.Bool("dictionary-stats", false, "dump the size of the dictionary tables, string bytes and the stack dedup ratio of every request")
+	expectedSemconvVersion := flag.String("expected-semconv-version", "", "warn about resource and scope schema URLs that are missing or refer to another semantic conventions version than this, e.g. 1.34.0, and log the profiles proto version of the payloads")
+	attributeStatsEnabled := flag.Bool("attribute-stats", false, "record every resource, profile, sample and location attribute key with its occurrences and example values, printed at shutdown and served at /api/attributes of the HTTP API")
+	cardinalityThreshold := flag.Int("cardinality-threshold", 0, "warn about attribute keys with more than this many distinct values, e.g. a UUID per sample (0 disables)")
+	lintSemconv := flag.Bool("lint-semconv", false, "check resource, sample, location and mapping attributes against the semantic conventions and report unknown or misnamed keys and invalid values")
+	duplicateWindow := flag.Duration("duplicate-window", 5*time.Minute, "warn about profile IDs received again within this window, and about all-zero IDs (0 disables)")
+	warnUnsymbolizedRatio := flag.Float64("warn-unsymbolized-ratio", 0, "warn about profiles in which the share of address-only frames exceeds this ratio, e.g. 0.5 (0 disables)")
+	maxClockSkew := flag.Duration("max-clock-skew", 0, "warn about profiles whose time drifts from the receive time by more than this, and print a per-resource skew summary (0 disables)")
+	templateText := flag.String("template", "", "Go text/template rendering each profile instead of the regular dump, or @file to read it from a file")
+	outputFormat := flag.String("output-format", "plain", "format of the dump output: plain, text or json records per profile and sample, or perf-script (plain, text, json, perf-script)")
+	var outputLevel slog.Level
+	flag.TextVar(&outputLevel, "output-level", slog.LevelInfo, "minimum level of the dump output (debug, info, warn, error); skip notices are logged at warn")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\nFlags not given on the command line are read from environment variables prefixed with %s,\ne.g. %s for -listen-http.\n", envPrefix, envName("listen-http"))
+	}
 	flag.Parse()
+	if err := setFlagsFromEnv(flag.CommandLine); err != nil {
+		log.Error("invalid flag environment variable", slog.Any("error", err.Error()))
+		os.Exit(2)
+	}
+	// $DEBUGINFOD_URLS is only the default, -debuginfod-url replaces it instead of adding to it.
+	if len(debuginfodURLs) == 0 {
+		debuginfodURLs.Set(strings.Join(strings.Fields(os.Getenv("DEBUGINFOD_URLS")), ","))
+	}
 
-	var opts []grpc.ServerOption
-	s := grpc.NewServer(opts...)
-	pprofileotlp.RegisterGRPCServer(s, newProfilesServer(Config{
-		ExportResourceAttributes:         true,
-		ExportProfileAttributes:          true,
-		ExportSampleAttributes:           true,
-		ExportStackFrames:                true,
-		IgnoreProfilesWithoutContainerID: false,
-		FilterSampleTypes:                []string{"events"},
-		FilterExecutableNames:            []string{},
-	}))
-
-	lis, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", *port))
+	if *outputFile != "" {
+		*output = "file"
+	}
+	rotation.Log = log
+	out, err := openOutput(*output, *outputFile, rotation)
 	if err != nil {
-		log.Error("error creating listener", slog.Any("error", err.Error()))
+		log.Error("error opening output", slog.Any("error", err.Error()))
 		os.Exit(1)
 	}
+	defer out.Close()
+	go handleOutputSignals(log, out)
 
-	go func() {
-		err = s.Serve(lis)
-	}()
+	dumpHandler, err := newHandler(*outputFormat, out, outputLevel)
+	if err != nil {
+		log.Error("invalid output configuration", slog.Any("error", err.Error()))
+		os.Exit(1)
+	}
+	color, err := colorEnabled(*colorMode, out)
+	if err != nil {
+		log.Error("invalid output configuration", slog.Any("error", err.Error()))
+		os.Exit(1)
+	}
+	if *outputFormat != "plain" && *outputFormat != "perf-script" {
+		color = false
+		// Keep server logs in the same structured format, so they can be told apart by level.
+		logHandler, _ := newHandler(*outputFormat, os.Stderr, slog.LevelInfo)
+		log = slog.New(logHandler)
+		slog.SetDefault(log)
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(&requestInfoHandler{}),
+	}
+	if *binaryLogPath != "" {
+		binaryLog, err := newBinaryLogHandler(log, *binaryLogPath)
+		if err != nil {
+			log.Error("error opening binary log", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		defer binaryLog.Close()
+		opts = append(opts, grpc.StatsHandler(binaryLog))
+	}
+	// grpc-go checks the size limit after decompression but before decoding.
+	if memory.MaxRequestSize > 0 && (limits.MaxRecvMsgSize <= 0 || limits.MaxRecvMsgSize > memory.MaxRequestSize) {
+		limits.MaxRecvMsgSize = memory.MaxRequestSize
+	}
+	opts = append(opts, limits.serverOptions()...)
+	followAttrs := map[string]string{}
+	for _, selector := range follow {
+		key, pattern, ok := strings.Cut(selector, "=")
+		if _, err := path.Match(pattern, ""); !ok || err != nil {
+			log.Error("invalid follow selector, expected key=pattern", slog.String("selector", selector))
+			os.Exit(1)
+		}
+		followAttrs[key] = pattern
+	}
+	if len(sampleTypes) == 0 {
+		sampleTypes = []string{"events"}
+	}
+	var resources *dump.ResourceCache
+	if *hideRepeatedResources {
+		resources = dump.NewResourceCache()
+	}
+	srv := newProfilesServer(Config{
+		Config: dump.Config{
+			ExportResourceAttributes:         true,
+			ExportProfileAttributes:          true,
+			ExportSampleAttributes:           true,
+			ExportStackFrames:                true,
+			IgnoreProfilesWithoutContainerID: false,
+			FilterSampleTypes:                sampleTypes,
+			FilterExecutableNames:            []string{},
+			FilterScopeNames:                 scopeNames,
+			Follow:                           followAttrs,
+			Color:                            color,
+			MaxAttributeLength:               *maxAttrLength,
+			MaxStackDepth:                    *maxStackDepth,
+			ExportLocationAttributes:         *locationAttributes,
+			ExportFrameTypeHistogram:         *frameTypeHistogram,
+			SplitKernelFrames:                *splitKernel,
+			ExportDictionaryStats:            *dictionaryStats,
+			GroupByProcess:                   *groupByProcess,
+			ThreadTopStacks:                  *threadTopStacks,
+			Resources:                        resources,
+		},
+		ExitAfterProfiles: *exitAfterProfiles,
+	})
+	if err := dump.ValidateScopePatterns(scopeNames); err != nil {
+		log.Error("invalid scope filter", slog.Any("error", err.Error()))
+		os.Exit(1)
+	}
+	srv.log = log
+	srv.dumpLog = slog.New(dumpHandler)
+	srv.out = out
+	srv.partialSuccess = partialSuccess
+	srv.delay = delay
+	srv.logRequestMetadata = *logRequestMetadata
+	if *rawFormat != "" && !slices.Contains(rawFormats, *rawFormat) {
+		log.Error("invalid raw format", slog.String("format", *rawFormat))
+		os.Exit(1)
+	}
+	// Raw requests are printed as received, before anything is redacted or anonymized.
+	if *rawFormat != "" && (len(redactAttrs) > 0 || *anonymize) {
+		log.Error("-raw-format can't be combined with -redact-attr or -anonymize")
+		os.Exit(1)
+	}
+	srv.rawFormat = *rawFormat
+	srv.perfScript = *outputFormat == "perf-script"
+	srv.reportRequests = *reportRequests
+	srv.tenantHeader = *tenantHeader
+	srv.adminAPI = *adminAPI
+	go handlePauseSignal(log, srv)
+	srv.tenantAttribute = *tenantAttribute
+	if *splitOutputBy != "" {
+		newSplitHandler := func(w io.Writer) slog.Handler {
+			h, _ := newHandler(*outputFormat, w, outputLevel)
+			return h
+		}
+		srv.split, err = newSplitOutput(*splitOutputBy, *splitOutputDir, rotation, *splitMaxOpenFiles, newSplitHandler, srv.dumpLog)
+		if err != nil {
+			log.Error("error setting up split output", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		defer srv.split.Close()
+		go handleOutputSignals(log, srv.split)
+	}
+	if k8sConfig.Source != "" {
+		enricher, err := newK8sEnricher(log, k8sConfig)
+		if err != nil {
+			log.Error("error setting up kubernetes enrichment", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		srv.enrichers = append(srv.enrichers, enricher)
+	}
+	if runtimeConfig.Runtime != "" {
+		runtimeConfig.Namespaces = []string{"k8s.io", "moby", "default"}
+		if len(runtimeNamespaces) > 0 {
+			runtimeConfig.Namespaces = runtimeNamespaces
+		}
+		enricher, err := newRuntimeEnricher(log, runtimeConfig)
+		if err != nil {
+			log.Error("error setting up container runtime enrichment", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		srv.enrichers = append(srv.enrichers, enricher)
+	}
+	if *symbolize {
+		sources := []symbolSource{localSymbols{dirs: symbolDirs}}
+		if len(debuginfodURLs) > 0 {
+			debuginfod, err := newDebuginfodSymbols(log, debuginfodURLs, *debuginfodCache)
+			if err != nil {
+				log.Error("error setting up debuginfod", slog.Any("error", err.Error()))
+				os.Exit(1)
+			}
+			sources = append(sources, debuginfod)
+		}
+		srv.symbolizer = newSymbolizer(log, sources...)
+	}
+	if len(redactAttrs) > 0 {
+		srv.redactor, err = newRedactor(redactAttrs, *redactMode)
+		if err != nil {
+			log.Error("invalid redaction configuration", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+	}
+	if *expectedSemconvVersion != "" {
+		srv.schema = &schemaChecker{expected: *expectedSemconvVersion}
+	}
+	if *lintSemconv {
+		srv.semconv = newSemconvLinter()
+	}
+	if *attributeStatsEnabled {
+		srv.attributeStats = newAttributeStats()
+	}
+	if *cardinalityThreshold > 0 {
+		srv.cardinality = newCardinalityDetector(*cardinalityThreshold)
+	}
+	if *duplicateWindow > 0 {
+		srv.profileIDs = newProfileIDTracker(*duplicateWindow)
+	}
+	if *warnUnsymbolizedRatio > 0 {
+		srv.unsymbolized = &unsymbolizedChecker{threshold: *warnUnsymbolizedRatio}
+	}
+	if *maxClockSkew > 0 {
+		srv.skew = newClockSkewDetector(*maxClockSkew)
+	}
+	if *anonymize {
+		srv.anonymizer = newAnonymizer(*anonymizeKey)
+	}
+	if *sqlitePath != "" {
+		store, err := openSQLiteStore(log, *sqlitePath)
+		if err != nil {
+			log.Error("error opening sqlite database", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		defer store.Close()
+		srv.forwarders = append(srv.forwarders, newForwarder("sqlite", 1, store.forward))
+	}
+	if *templateText != "" {
+		srv.template, err = parseProfileTemplate(*templateText)
+		if err != nil {
+			log.Error("invalid template", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+	}
+	if err := onError.validate(); err != nil {
+		log.Error("invalid error policy", slog.Any("error", err.Error()))
+		os.Exit(1)
+	}
+	srv.onError = onError
+	if memory.enabled() {
+		srv.memory = &memoryGuard{cfg: memory}
+	}
+	if faults.enabled() {
+		srv.faults, err = newFaultInjector(faults)
+		if err != nil {
+			log.Error("invalid fault injection configuration", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+	}
+	if pyroscope.URL != "" {
+		srv.forwarders = append(srv.forwarders, newForwarder("pyroscope", 1, newPyroscopeForwarder(log, pyroscope, srv.currentConfig).forward))
+	}
+	if parca.Address != "" {
+		forwarder, err := newParcaForwarder(log, parca, srv.currentConfig)
+		if err != nil {
+			log.Error("error setting up parca forwarding", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		defer forwarder.Close()
+		srv.forwarders = append(srv.forwarders, newForwarder("parca", 1, forwarder.forward))
+	}
+	if execCfg.Command != "" {
+		if err := execCfg.validate(); err != nil {
+			log.Error("invalid exec configuration", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		hook := &execHook{log: log, cfg: execCfg, config: srv.currentConfig}
+		srv.forwarders = append(srv.forwarders, newForwarder("exec", execCfg.Concurrency, hook.forward))
+	}
+	if webhook.URL != "" {
+		if err := webhook.validate(); err != nil {
+			log.Error("invalid webhook configuration", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		srv.forwarders = append(srv.forwarders, newForwarder("webhook", 1, newWebhookForwarder(log, webhook, srv.currentConfig).forward))
+	}
+	if capture.URL != "" {
+		uploader, err := newCaptureUploader(log, capture)
+		if err != nil {
+			log.Error("error setting up capture upload", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		srv.forwarders = append(srv.forwarders, newForwarder("capture", capture.Concurrency, uploader.forward))
+	}
+	if csvCfg.Dir != "" {
+		writer, err := newCSVWriter(log, csvCfg, srv.currentConfig)
+		if err != nil {
+			log.Error("error setting up CSV output", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		srv.forwarders = append(srv.forwarders, newForwarder("csv", 1, writer.forward))
+	}
+	if *chromeTraceDir != "" {
+		writer, err := newChromeTraceWriter(log, *chromeTraceDir, srv.currentConfig)
+		if err != nil {
+			log.Error("error setting up Chrome trace output", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		srv.forwarders = append(srv.forwarders, newForwarder("chrome-trace", 1, writer.forward))
+	}
+	if *otlpJSONDir != "" {
+		writer, err := newOTLPJSONWriter(log, *otlpJSONDir)
+		if err != nil {
+			log.Error("error setting up OTLP JSON output", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		srv.forwarders = append(srv.forwarders, newForwarder("otlp-json", 1, writer.forward))
+	}
+	if *goldenDir != "" {
+		writer, err := newGoldenWriter(log, *goldenDir, *goldenNormalize)
+		if err != nil {
+			log.Error("error setting up golden output", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		srv.forwarders = append(srv.forwarders, newForwarder("golden", 1, writer.forward))
+	}
+	var parquetOut *parquetWriter
+	if parquetCfg.File != "" {
+		parquetOut, err = newParquetWriter(log, parquetCfg, srv.currentConfig)
+		if err != nil {
+			log.Error("error setting up Parquet output", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		srv.forwarders = append(srv.forwarders, newForwarder("parquet", 1, parquetOut.forward))
+	}
+	if clickhouse.URL != "" {
+		sink, err := newClickhouseSink(log, clickhouse, srv.currentConfig)
+		if err != nil {
+			log.Error("error setting up ClickHouse", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		srv.forwarders = append(srv.forwarders, newForwarder("clickhouse", 1, sink.forward))
+	}
+	var merger *profileMerger
+	if merge.Window > 0 {
+		if err := merge.validate(); err != nil {
+			log.Error("invalid merge configuration", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		merger, err = newProfileMerger(log, merge, srv.currentConfig)
+		if err != nil {
+			log.Error("error setting up merging", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		srv.forwarders = append(srv.forwarders, newForwarder("merge", 1, merger.forward))
+		go merger.run(ctx)
+	}
+	if *rateInterval > 0 {
+		srv.rates = newRateDashboard(*rateInterval, out)
+		if *tenantHeader != "" {
+			srv.rates.tenantAttribute = *tenantAttribute
+		}
+		go srv.rates.run(ctx)
+	}
+	if *topTalkerCount > 0 {
+		srv.topTalkers = newTopTalkers(*topTalkerCount, *topTalkerInterval, out)
+		go srv.topTalkers.run(ctx)
+	}
+	if *dumpQueueSize > 0 {
+		srv.queue = newDumpQueue(*dumpQueueSize, *dumpWorkers, srv.dump)
+	}
+	if *apiListen != "" {
+		srv.ring = newProfileRing(*retainProfiles, *retainDuration)
+		go srv.ring.runEviction(ctx.Done())
+		if *traceIndexWindow > 0 {
+			srv.traces = newTraceIndex(*traceIndexWindow)
+		}
+		if *rollupInterval > 0 {
+			srv.rollups = newRollups(*rollupInterval, *rollupWindow)
+		}
+	}
+	s := grpc.NewServer(append(opts, grpc.ForceServerCodecV2(newServerCodec()))...)
+	healthServer := registerServices(s, srv)
+	if *acceptTraces {
+		ptraceotlp.RegisterGRPCServer(s, &tracesServer{log: log, dumpLog: srv.dumpLog, config: srv.currentConfig})
+	}
+	if *acceptLogs {
+		plogotlp.RegisterGRPCServer(s, &logsServer{log: log, dumpLog: srv.dumpLog, config: srv.currentConfig})
+	}
+
+	activated, err := systemdListeners()
+	if err != nil {
+		log.Error("error using systemd sockets", slog.Any("error", err.Error()))
+		os.Exit(1)
+	}
+	var grpcListeners, httpListeners []net.Listener
+	var apiLis net.Listener
+	for _, lis := range activated {
+		switch lis.name {
+		case "http":
+			httpListeners = append(httpListeners, lis)
+		case "api":
+			if apiLis != nil || *apiListen != "" {
+				log.Error("more than one api listener", slog.String("addr", lis.Addr().String()))
+				os.Exit(1)
+			}
+			apiLis = lis
+		default:
+			grpcListeners = append(grpcListeners, lis)
+		}
+	}
+
+	// Socket activated gRPC listeners replace the default port.
+	if len(listens) == 0 && len(grpcListeners) == 0 {
+		listens = append(listens, listenAddress("", *port))
+	}
+
+	for _, addr := range listens {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Error("error creating listener", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		grpcListeners = append(grpcListeners, lis)
+	}
+	for _, path := range listenUnixPaths {
+		lis, err := listenUnix(path)
+		if err != nil {
+			log.Error("error creating unix listener", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		grpcListeners = append(grpcListeners, lis)
+	}
+
+	// serveErrs receives the first error of any listener, which shuts the server down.
+	serveErrs := make(chan error, 1)
+	serveFailed := func(err error) {
+		select {
+		case serveErrs <- err:
+		default:
+		}
+	}
+	for _, lis := range grpcListeners {
+		go func() {
+			if err := s.Serve(lis); err != nil {
+				log.Error("error serving", slog.String("addr", lis.Addr().String()), slog.Any("error", err.Error()))
+				serveFailed(err)
+			}
+		}()
+
+		fmt.Fprintln(os.Stderr, "GRPC server started at ", lis.Addr().String())
+	}
+
+	for _, addr := range listenHTTPs {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Error("error creating http listener", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		httpListeners = append(httpListeners, lis)
+	}
+
+	var httpServers []*http.Server
+	for _, lis := range httpListeners {
+		hs := &http.Server{Handler: newOTLPHTTPHandler(srv, limits.maxRecvMsgSize())}
+		httpServers = append(httpServers, hs)
+		go func() {
+			if err := hs.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("error serving http", slog.String("addr", lis.Addr().String()), slog.Any("error", err.Error()))
+				serveFailed(err)
+			}
+		}()
+
+		fmt.Fprintln(os.Stderr, "HTTP server started at ", lis.Addr().String())
+	}
+
+	if *apiListen != "" {
+		apiLis, err = net.Listen("tcp", *apiListen)
+		if err != nil {
+			log.Error("error creating api listener", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+	}
+	if lis := apiLis; lis != nil {
+		hs := &http.Server{
+			Handler: newAPIHandler(srv),
+			// Long-lived streams end once the server is shutting down.
+			BaseContext: func(net.Listener) context.Context { return ctx },
+		}
+		httpServers = append(httpServers, hs)
+		go func() {
+			if err := hs.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("error serving api", slog.String("addr", lis.Addr().String()), slog.Any("error", err.Error()))
+				serveFailed(err)
+			}
+		}()
+
+		fmt.Fprintln(os.Stderr, "API server started at ", lis.Addr().String())
+	}
+
+	if *debugListen != "" {
+		lis, err := net.Listen("tcp", *debugListen)
+		if err != nil {
+			log.Error("error creating debug listener", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+
+		hs := &http.Server{Handler: newDebugHandler(srv)}
+		httpServers = append(httpServers, hs)
+		go func() {
+			if err := hs.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("error serving debug endpoints", slog.String("addr", lis.Addr().String()), slog.Any("error", err.Error()))
+				serveFailed(err)
+			}
+		}()
+
+		fmt.Fprintln(os.Stderr, "Debug server started at ", lis.Addr().String())
+	}
+
+	// sources feed the pipeline outside of the listeners, they must be done before the dump
+	// queue is closed.
+	var sources sync.WaitGroup
+	if len(kafkaBrokers) > 0 {
+		kafkaConfig.Brokers = kafkaBrokers
+		sources.Add(1)
+		go func() {
+			defer sources.Done()
+			if err := consumeKafka(ctx, log, srv, kafkaConfig); err != nil {
+				log.Error("error consuming kafka", slog.Any("error", err.Error()))
+			}
+		}()
+
+		fmt.Fprintln(os.Stderr, "Kafka consumer started for topic ", kafkaConfig.Topic)
+	}
+
+	if watchConfig.Dir != "" {
+		watcher, err := newFileWatcher(log, srv, watchConfig)
+		if err != nil {
+			log.Error("error setting up file watch", slog.Any("error", err.Error()))
+			os.Exit(1)
+		}
+		sources.Add(1)
+		go func() {
+			defer sources.Done()
+			watcher.run(ctx)
+		}()
+
+		fmt.Fprintln(os.Stderr, "Watching files in ", watchConfig.Dir)
+	}
 
-	fmt.Println("GRPC server started at ", lis.Addr().String())
+	var deadline <-chan time.Time
+	if *exitAfterDuration > 0 {
+		deadline = time.After(*exitAfterDuration)
+	}
 
-	fmt.Println("running...")
-	<-ctx.Done()
-	fmt.Println("done...")
-	s.GracefulStop()
+	srv.ready.Store(true)
+	fmt.Fprintln(os.Stderr, "running...")
+	select {
+	case <-ctx.Done():
+	case <-srv.LimitReached():
+		fmt.Fprintf(os.Stderr, "received %d profiles, exiting...\n", srv.stats.profiles.Load())
+	case <-deadline:
+		fmt.Fprintf(os.Stderr, "%v elapsed, exiting...\n", *exitAfterDuration)
+	case <-serveErrs:
+		fmt.Fprintln(os.Stderr, "listener failed, exiting...")
+		exitCode = 1
+	}
+	fmt.Fprintln(os.Stderr, "done...")
+	cancel()
+	srv.ready.Store(false)
+	healthServer.Shutdown()
+	shutdownCtx, cancelShutdown := context.WithCancel(context.Background())
+	if *shutdownTimeout > 0 {
+		shutdownCtx, cancelShutdown = context.WithTimeout(context.Background(), *shutdownTimeout)
+	}
+	defer cancelShutdown()
+	for _, hs := range httpServers {
+		if err := hs.Shutdown(shutdownCtx); err != nil {
+			log.Warn("shutdown timeout elapsed, closing remaining http connections", slog.Any("error", err.Error()))
+			hs.Close()
+		}
+	}
+	gracefulStop(shutdownCtx, log, s)
+	sources.Wait()
+	if srv.queue != nil {
+		srv.queue.close()
+	}
+	for _, fw := range srv.forwarders {
+		fw.queue.close()
+	}
+	if merger != nil {
+		merger.flush()
+	}
+	if parquetOut != nil {
+		parquetOut.close()
+	}
+	srv.stats.printSummary(out, srv.resources.Len())
+	srv.dropped.printSummary(out)
+	if srv.skew != nil {
+		srv.skew.printSummary(out)
+	}
+	if srv.semconv != nil {
+		srv.semconv.printSummary(out)
+	}
+	if srv.attributeStats != nil {
+		srv.attributeStats.printSummary(out)
+	}
+	if srv.cardinality != nil {
+		srv.cardinality.printSummary(out)
+	}
 }
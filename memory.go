@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"sync/atomic"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// memoryConfig limits the memory spent on requests, to survive pathological payloads of
+// malfunctioning agents.
+type memoryConfig struct {
+	// MaxRequestSize is the maximum decoded size of a single request in bytes.
+	MaxRequestSize int
+	// Budget is the maximum decoded size of all requests processed at the same time in bytes.
+	Budget int64
+}
+
+func (c *memoryConfig) registerFlags(fs *flag.FlagSet) {
+	fs.IntVar(&c.MaxRequestSize, "max-request-size", 0, "reject export requests larger than this many bytes after decompression with ResourceExhausted, lowers -grpc-max-recv-msg-size to match (0 means no limit)")
+	fs.Int64Var(&c.Budget, "memory-budget", 0, "reject export requests with ResourceExhausted while the requests being processed or queued exceed this many bytes after decompression (0 means no limit)")
+}
+
+func (c memoryConfig) enabled() bool {
+	return c.MaxRequestSize > 0 || c.Budget > 0
+}
+
+// memoryGuard admits requests within the configured limits. Requests are accounted until
+// Export returns and the dump queue and every forwarder are done with them.
+type memoryGuard struct {
+	cfg memoryConfig
+
+	inFlight atomic.Int64
+}
+
+// acquire reserves size bytes of the budget. It returns the reservation, held once by the
+// caller, or the status error to reject the request with.
+func (g *memoryGuard) acquire(size int) (*reservation, error) {
+	if g.cfg.MaxRequestSize > 0 && size > g.cfg.MaxRequestSize {
+		return nil, status.Errorf(codes.ResourceExhausted, "request of %d bytes exceeds the limit of %d bytes", size, g.cfg.MaxRequestSize)
+	}
+	if inFlight := g.inFlight.Add(int64(size)); g.cfg.Budget > 0 && inFlight > g.cfg.Budget {
+		g.inFlight.Add(-int64(size))
+		return nil, status.Errorf(codes.ResourceExhausted, "memory budget of %d bytes is exhausted by the requests in flight", g.cfg.Budget)
+	}
+	res := &reservation{release: func() { g.inFlight.Add(-int64(size)) }}
+	res.hold()
+	return res, nil
+}
+
+// reservation is memory reserved for a request, released once every holder is done with it.
+// A nil reservation reserves nothing.
+type reservation struct {
+	holders atomic.Int32
+	release func()
+}
+
+func (r *reservation) hold() {
+	if r != nil {
+		r.holders.Add(1)
+	}
+}
+
+func (r *reservation) done() {
+	if r != nil && r.holders.Add(-1) == 0 {
+		r.release()
+	}
+}
+
+// requestSize returns the decoded size of the request, as received or, for sources not
+// reporting it, as encoded again.
+func requestSize(info *requestInfo, pd pprofile.Profiles) int {
+	if size := info.UncompressedSize(); size > 0 {
+		return size
+	}
+	var m pprofile.ProtoMarshaler
+	return m.ProfilesSize(pd)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// mergeConfig configures merging the profiles received within a window.
+type mergeConfig struct {
+	Window time.Duration
+	// By is resource or global.
+	By string
+	// Format is pprof or collapsed.
+	Format string
+	Dir    string
+}
+
+func (c *mergeConfig) registerFlags(fs *flag.FlagSet) {
+	fs.DurationVar(&c.Window, "merge-window", 0, "merge all profiles received within this window into a single profile per sample type (0 disables merging)")
+	fs.StringVar(&c.By, "merge-by", "resource", "merge profiles per resource or globally (resource, global)")
+	fs.StringVar(&c.Format, "merge-format", "pprof", "format of the merged profiles (pprof, collapsed)")
+	fs.StringVar(&c.Dir, "merge-dir", ".", "directory the merged profiles are written to")
+}
+
+func (c mergeConfig) validate() error {
+	if c.By != "resource" && c.By != "global" {
+		return fmt.Errorf("unknown merge grouping %q, expected resource or global", c.By)
+	}
+	if c.Format != "pprof" && c.Format != "collapsed" {
+		return fmt.Errorf("unknown merge format %q, expected pprof or collapsed", c.Format)
+	}
+	return nil
+}
+
+// mergeKey identifies the profiles merged into one.
+type mergeKey struct {
+	resource   string
+	sampleType string
+}
+
+// profileMerger collects received profiles and writes them merged into one file per resource
+// and sample type at the end of every window.
+type profileMerger struct {
+	log    *slog.Logger
+	cfg    mergeConfig
+	config func() Config
+
+	mu      sync.Mutex
+	pending map[mergeKey][]*profile.Profile
+}
+
+func newProfileMerger(log *slog.Logger, cfg mergeConfig, config func() Config) (*profileMerger, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &profileMerger{
+		log:     log,
+		cfg:     cfg,
+		config:  config,
+		pending: map[mergeKey][]*profile.Profile{},
+	}, nil
+}
+
+func (m *profileMerger) forward(pd pprofile.Profiles) {
+	for _, view := range resolveProfiles(m.config(), pd) {
+		key := mergeKey{resource: "global", sampleType: view.Profile.SampleType}
+		if m.cfg.By == "resource" {
+			key.resource = resourceName(view.Resource.Attributes)
+		}
+		prof := toPprof(view)
+
+		m.mu.Lock()
+		m.pending[key] = append(m.pending[key], prof)
+		m.mu.Unlock()
+	}
+}
+
+// run flushes the merged profiles at the end of every window until ctx is done.
+func (m *profileMerger) run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.Window)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.flush()
+		}
+	}
+}
+
+// flush writes the profiles collected since the last flush.
+func (m *profileMerger) flush() {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = map[mergeKey][]*profile.Profile{}
+	m.mu.Unlock()
+
+	now := time.Now().UTC().Format("20060102T150405")
+	for key, profiles := range pending {
+		merged, err := profile.Merge(profiles)
+		if err != nil {
+			m.log.Error("error merging profiles", slog.String("resource", key.resource),
+				slog.String("sample_type", key.sampleType), slog.Any("error", err.Error()))
+			continue
+		}
+
+		name := safeFileName(fmt.Sprintf("%s-%s-%s", now, key.resource, key.sampleType))
+		if err := m.write(filepath.Join(m.cfg.Dir, name), merged); err != nil {
+			m.log.Error("error writing merged profile", slog.String("resource", key.resource),
+				slog.String("sample_type", key.sampleType), slog.Any("error", err.Error()))
+			continue
+		}
+		m.log.Info("wrote merged profile", slog.String("resource", key.resource),
+			slog.String("sample_type", key.sampleType), slog.Int("profiles", len(profiles)),
+			slog.Int("samples", len(merged.Sample)))
+	}
+}
+
+func (m *profileMerger) write(path string, prof *profile.Profile) error {
+	if m.cfg.Format == "collapsed" {
+		return os.WriteFile(path+".folded", []byte(collapse(prof)), 0o644)
+	}
+
+	f, err := os.Create(path + ".pb.gz")
+	if err != nil {
+		return err
+	}
+	if err := prof.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// collapse formats the profile as collapsed stacks, one "root;...;leaf value" line per stack,
+// as consumed by flamegraph tools.
+func collapse(prof *profile.Profile) string {
+	values := map[string]int64{}
+	for _, s := range prof.Sample {
+		var frames []string
+		for i := len(s.Location) - 1; i >= 0; i-- {
+			loc := s.Location[i]
+			if len(loc.Line) == 0 {
+				if loc.Mapping != nil && loc.Mapping.File != "" {
+					frames = append(frames, fmt.Sprintf("%s+%#x", loc.Mapping.File, loc.Address))
+				} else {
+					frames = append(frames, fmt.Sprintf("%#x", loc.Address))
+				}
+				continue
+			}
+			// Lines are ordered from the innermost inlined function outwards.
+			for j := len(loc.Line) - 1; j >= 0; j-- {
+				frames = append(frames, loc.Line[j].Function.Name)
+			}
+		}
+		// toPprof sums up the values of a sample into one, merged profiles keep a single value.
+		stack := strings.Join(frames, ";")
+		for _, v := range s.Value {
+			values[stack] += v
+		}
+	}
+
+	var b strings.Builder
+	for _, stack := range slices.Sorted(maps.Keys(values)) {
+		fmt.Fprintf(&b, "%s %d\n", stack, values[stack])
+	}
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorPolicy is the behavior for requests that fail to decode or process.
+type errorPolicy struct {
+	// Mode is log to log and accept the request, reject to respond with an error status, or
+	// panic to save the payload and exit with status 2.
+	Mode string
+	// Dir is the directory payloads are saved to before exiting.
+	Dir string
+}
+
+func (p *errorPolicy) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&p.Mode, "on-error", "log", "behavior on requests that fail to decode or process, e.g. with invalid dictionary references: log and accept them, reject them with an error status, or save the payload and exit with status 2 (log, reject, panic)")
+	fs.StringVar(&p.Dir, "on-error-dir", ".", "directory the payload is saved to before exiting with -on-error panic")
+}
+
+func (p errorPolicy) validate() error {
+	switch p.Mode {
+	case "log", "reject", "panic":
+		return nil
+	}
+	return fmt.Errorf("unknown error policy %q, expected log, reject or panic", p.Mode)
+}
+
+// decodeError applies the error policy to a payload that failed to decode. It returns the
+// status error to respond with, or nil to accept and skip the payload. ext is the file
+// extension the payload is saved with. gRPC requests are decoded before Export is called, see
+// profilesExportHandler.
+func (f *profilesServer) decodeError(err error, payload []byte, ext string) error {
+	return f.requestError("error decoding request", err, ext, func() ([]byte, error) {
+		return payload, nil
+	})
+}
+
+// processingError applies the error policy to a request that failed to process.
+func (f *profilesServer) processingError(msg string, err error, request pprofileotlp.ExportRequest) error {
+	return f.requestError(msg, err, ".pb", request.MarshalProto)
+}
+
+func (f *profilesServer) requestError(msg string, err error, ext string, payload func() ([]byte, error)) error {
+	switch f.onError.Mode {
+	case "reject":
+		f.log.Warn(msg+", rejecting request", slog.Any("error", err.Error()))
+		return status.Errorf(codes.InvalidArgument, "%s: %v", msg, err)
+	case "panic":
+		path, saveErr := f.onError.save(ext, payload)
+		if saveErr != nil {
+			f.log.Error("error saving payload", slog.Any("error", saveErr.Error()))
+		} else {
+			f.log.Error("saved payload", slog.String("path", path))
+		}
+		// Exit rather than panic, net/http recovers panics of handlers.
+		f.log.Error(msg+", exiting", slog.Any("error", err.Error()))
+		os.Exit(2)
+		return nil
+	default:
+		f.log.Warn(msg, slog.Any("error", err.Error()))
+		return nil
+	}
+}
+
+// recoverExport turns a panic while processing request into an error handled by the error
+// policy, so a single malformed payload does not take the server down. It has to be deferred
+// by Export with its results.
+func (f *profilesServer) recoverExport(request pprofileotlp.ExportRequest, response *pprofileotlp.ExportResponse, err *error) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	f.log.Error("panic processing request", slog.Any("panic", fmt.Sprint(r)), slog.String("stack", string(debug.Stack())))
+	*response = pprofileotlp.NewExportResponse()
+	if policyErr := f.processingError("panic processing request", fmt.Errorf("%v", r), request); policyErr != nil {
+		*err = status.Errorf(codes.Internal, "panic processing request: %v", r)
+	}
+}
+
+func (p errorPolicy) save(ext string, payload func() ([]byte, error)) (string, error) {
+	data, err := payload()
+	if err != nil {
+		return "", err
+	}
+	if len(data) == 0 {
+		return "", errors.New("empty payload")
+	}
+	path := filepath.Join(p.Dir, fmt.Sprintf("payload-%s%s", time.Now().UTC().Format("20060102T150405.000000000"), ext))
+	return path, os.WriteFile(path, data, 0o644)
+}
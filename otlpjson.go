@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// otlpJSONWriter writes every received profile as a standalone OTLP JSON request, with a
+// dictionary trimmed to the entries the profile references.
+type otlpJSONWriter struct {
+	log *slog.Logger
+	dir string
+
+	seq atomic.Int64
+}
+
+func newOTLPJSONWriter(log *slog.Logger, dir string) (*otlpJSONWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &otlpJSONWriter{log: log, dir: dir}, nil
+}
+
+func (w *otlpJSONWriter) forward(pd pprofile.Profiles) {
+	var marshaler pprofile.JSONMarshaler
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		sps := rps.At(i).ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			pcs := sps.At(j).Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				profile := pcs.At(k)
+				name := fmt.Sprintf("%s-%06d-%s.json", time.Now().UTC().Format("20060102T150405"), w.seq.Add(1), profile.ProfileID())
+				path := filepath.Join(w.dir, name)
+
+				data, err := marshaler.MarshalProfiles(dump.ExtractProfile(pd.Dictionary(), rps.At(i), sps.At(j), profile))
+				if err == nil {
+					err = os.WriteFile(path, data, 0o644)
+				}
+				if err != nil {
+					w.log.Error("error writing OTLP JSON", slog.String("path", path), slog.Any("error", err.Error()))
+				}
+			}
+		}
+	}
+}
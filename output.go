@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// newHandler returns a slog.Handler for the given format, which is either plain, text or json.
+func newHandler(format string, w io.Writer, level slog.Leveler) (slog.Handler, error) {
+	switch format {
+	case "plain", "perf-script":
+		// perf-script only replaces the profile dump, everything else is printed as plain.
+		return dump.NewPlainHandler(w, level), nil
+	case "text":
+		return slog.NewTextHandler(w, &slog.HandlerOptions{Level: level}), nil
+	case "json":
+		return slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level}), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q, expected plain, text, json or perf-script", format)
+	}
+}
+
+// openOutput opens the destination of the dump output. Closing stdout or stderr is a no-op.
+func openOutput(kind, path string, rotation rotationConfig) (io.WriteCloser, error) {
+	switch kind {
+	case "stdout":
+		return nopWriteCloser{os.Stdout}, nil
+	case "stderr":
+		return nopWriteCloser{os.Stderr}, nil
+	case "file":
+		if path == "" {
+			return nil, fmt.Errorf("-output file requires -output-file")
+		}
+		return openRotatingFile(path, rotation)
+	default:
+		return nil, fmt.Errorf("unknown output %q, expected stdout, stderr or file", kind)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
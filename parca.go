@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/mem"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const parcaWriteRawMethod = "/parca.profilestore.v1alpha1.ProfileStoreService/WriteRaw"
+
+// parcaConfig configures forwarding to the Parca profile store.
+type parcaConfig struct {
+	Address     string
+	Insecure    bool
+	BearerToken string
+}
+
+// parcaForwarder converts received profiles to pprof and writes them to Parca via
+// ProfileStoreService.WriteRaw. The resource attributes become labels of the series.
+//
+// The request is small enough to be encoded by hand, which saves pulling in the whole Parca
+// module for its generated code.
+type parcaForwarder struct {
+	log    *slog.Logger
+	cfg    parcaConfig
+	config func() Config
+	conn   *grpc.ClientConn
+}
+
+func newParcaForwarder(log *slog.Logger, cfg parcaConfig, config func() Config) (*parcaForwarder, error) {
+	creds := credentials.NewTLS(&tls.Config{})
+	if cfg.Insecure {
+		creds = insecure.NewCredentials()
+	}
+	conn, err := grpc.NewClient(cfg.Address, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &parcaForwarder{
+		log:    log,
+		cfg:    cfg,
+		config: config,
+		conn:   conn,
+	}, nil
+}
+
+func (p *parcaForwarder) Close() error {
+	return p.conn.Close()
+}
+
+func (p *parcaForwarder) forward(pd pprofile.Profiles) {
+	for _, view := range resolveProfiles(p.config(), pd) {
+		if err := p.write(view); err != nil {
+			p.log.Error("error forwarding profile to parca",
+				slog.String("profile_id", view.Profile.ProfileID),
+				slog.Any("error", err.Error()))
+		}
+	}
+}
+
+func (p *parcaForwarder) write(view profileView) error {
+	var raw bytes.Buffer
+	if err := toPprof(view).Write(&raw); err != nil {
+		return fmt.Errorf("error encoding pprof: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if p.cfg.BearerToken != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+p.cfg.BearerToken)
+	}
+
+	var response []byte
+	return p.conn.Invoke(ctx, parcaWriteRawMethod, parcaWriteRawRequest(parcaLabels(view), raw.Bytes()), &response,
+		grpc.ForceCodecV2(rawCodec{}))
+}
+
+// parcaLabels returns the labels of the series, __name__ is the sample type.
+func parcaLabels(view profileView) [][2]string {
+	labels := [][2]string{{"__name__", parcaLabelName(view.Profile.SampleType)}}
+	for _, k := range slices.Sorted(maps.Keys(view.Resource.Attributes)) {
+		labels = append(labels, [2]string{parcaLabelName(k), view.Resource.Attributes[k]})
+	}
+	return labels
+}
+
+// parcaLabelName replaces everything that's not valid in a Prometheus label name.
+func parcaLabelName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// parcaWriteRawRequest encodes a WriteRawRequest with a single series holding a single sample:
+//
+//	WriteRawRequest { repeated RawProfileSeries series = 2; bool normalized = 3; }
+//	RawProfileSeries { LabelSet labels = 1; repeated RawSample samples = 2; }
+//	LabelSet { repeated Label labels = 1; }
+//	Label { string name = 1; string value = 2; }
+//	RawSample { bytes raw_profile = 1; }
+func parcaWriteRawRequest(labels [][2]string, rawProfile []byte) []byte {
+	var labelSet []byte
+	for _, l := range labels {
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, l[0])
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, l[1])
+
+		labelSet = protowire.AppendTag(labelSet, 1, protowire.BytesType)
+		labelSet = protowire.AppendBytes(labelSet, label)
+	}
+
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.BytesType)
+	sample = protowire.AppendBytes(sample, rawProfile)
+
+	var series []byte
+	series = protowire.AppendTag(series, 1, protowire.BytesType)
+	series = protowire.AppendBytes(series, labelSet)
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	series = protowire.AppendBytes(series, sample)
+
+	var request []byte
+	request = protowire.AppendTag(request, 2, protowire.BytesType)
+	request = protowire.AppendBytes(request, series)
+	return request
+}
+
+// rawCodec passes already encoded messages through as is.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) (mem.BufferSlice, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return mem.BufferSlice{mem.SliceBuffer(b)}, nil
+}
+
+func (rawCodec) Unmarshal(data mem.BufferSlice, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	*b = data.Materialize()
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
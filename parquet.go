@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// parquetConfig configures writing the received samples to a Parquet file.
+type parquetConfig struct {
+	File         string
+	RowGroupSize int64
+}
+
+func (c *parquetConfig) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.File, "parquet-file", "", "Parquet file to write all received samples to, one row per sample, finished on shutdown (disabled if empty)")
+	fs.Int64Var(&c.RowGroupSize, "parquet-row-group-size", 100000, "number of samples per Parquet row group")
+}
+
+// parquetRow is a sample flattened with its resource and profile.
+type parquetRow struct {
+	ReceivedAt         time.Time         `parquet:"received_at,timestamp(millisecond)"`
+	ServiceName        string            `parquet:"service_name,dict"`
+	HostName           string            `parquet:"host_name,dict"`
+	ContainerID        string            `parquet:"container_id,dict"`
+	ProfileID          string            `parquet:"profile_id"`
+	ProfileTime        time.Time         `parquet:"profile_time,timestamp(nanosecond)"`
+	SampleType         string            `parquet:"sample_type,dict"`
+	SampleUnit         string            `parquet:"sample_unit,dict"`
+	Value              int64             `parquet:"value"`
+	Timestamps         []int64           `parquet:"timestamps_unix_nano,list"`
+	LeafFunction       string            `parquet:"leaf_function,dict"`
+	Stack              string            `parquet:"stack"`
+	TraceID            string            `parquet:"trace_id,optional"`
+	SpanID             string            `parquet:"span_id,optional"`
+	ResourceAttributes map[string]string `parquet:"resource_attributes"`
+	ProfileAttributes  map[string]string `parquet:"profile_attributes"`
+	SampleAttributes   map[string]string `parquet:"sample_attributes"`
+}
+
+// parquetWriter appends the samples of every request to a single Parquet file. The file is
+// only readable once close wrote the footer.
+type parquetWriter struct {
+	log    *slog.Logger
+	config func() Config
+
+	mu     sync.Mutex
+	file   *os.File
+	writer *parquet.GenericWriter[parquetRow]
+}
+
+func newParquetWriter(log *slog.Logger, cfg parquetConfig, config func() Config) (*parquetWriter, error) {
+	f, err := os.Create(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetWriter{
+		log: log,
+		config: func() Config {
+			config := config()
+			config.ExportStackFrames = true
+			return config
+		},
+		file: f,
+		writer: parquet.NewGenericWriter[parquetRow](f,
+			parquet.Compression(&parquet.Zstd),
+			parquet.MaxRowsPerRowGroup(cfg.RowGroupSize)),
+	}, nil
+}
+
+func (w *parquetWriter) forward(pd pprofile.Profiles) {
+	now := time.Now()
+	var rows []parquetRow
+	for _, view := range resolveProfiles(w.config(), pd) {
+		resource := view.Resource.Attributes
+		for _, sample := range view.Profile.Samples {
+			row := parquetRow{
+				ReceivedAt:         now,
+				ServiceName:        resource["service.name"],
+				HostName:           resource["host.name"],
+				ContainerID:        resource["container.id"],
+				ProfileID:          view.Profile.ProfileID,
+				ProfileTime:        view.Profile.Time,
+				SampleType:         view.Profile.SampleType,
+				SampleUnit:         view.Profile.SampleUnit,
+				Value:              sample.total(),
+				Stack:              foldFrames(sample.Frames),
+				TraceID:            sample.TraceID,
+				SpanID:             sample.SpanID,
+				ResourceAttributes: resource,
+				ProfileAttributes:  view.Profile.Attributes,
+				SampleAttributes:   sample.Attributes,
+			}
+			for _, ts := range sample.Timestamps {
+				row.Timestamps = append(row.Timestamps, ts.UnixNano())
+			}
+			if len(sample.Frames) > 0 {
+				row.LeafFunction = frameName(sample.Frames[0])
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.writer.Write(rows); err != nil {
+		w.log.Error("error writing Parquet rows", slog.Any("error", err.Error()))
+	}
+}
+
+// close writes the remaining rows and the footer.
+func (w *parquetWriter) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.writer.Close(); err != nil {
+		w.log.Error("error finishing Parquet file", slog.Any("error", err.Error()))
+	}
+	if err := w.file.Close(); err != nil {
+		w.log.Error("error closing Parquet file", slog.Any("error", err.Error()))
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+)
+
+// partialSuccessConfig makes Export answer with an OTLP partial success, to test how exporters
+// deal with rejected profiles.
+type partialSuccessConfig struct {
+	// RejectedProfiles is reported as rejected_profiles. It is sent as is, even if the request
+	// contains fewer profiles.
+	RejectedProfiles int64
+	Message          string
+}
+
+func (c *partialSuccessConfig) registerFlags(fs *flag.FlagSet) {
+	fs.Int64Var(&c.RejectedProfiles, "partial-success-rejected", 0, "number of profiles reported as rejected in a partial success response (0 disables partial success)")
+	fs.StringVar(&c.Message, "partial-success-message", "", "error message of partial success responses (default describes the rejected profiles)")
+}
+
+func (c partialSuccessConfig) enabled() bool {
+	return c.RejectedProfiles > 0 || c.Message != ""
+}
+
+// apply sets the partial success on the response and logs which profiles are considered
+// rejected, that is the first RejectedProfiles profiles of the request.
+func (c partialSuccessConfig) apply(log *slog.Logger, response pprofileotlp.ExportResponse, pd pprofile.Profiles) {
+	message := c.Message
+	if message == "" {
+		message = fmt.Sprintf("rejected %d profiles", c.RejectedProfiles)
+	}
+	response.PartialSuccess().SetRejectedProfiles(c.RejectedProfiles)
+	response.PartialSuccess().SetErrorMessage(message)
+
+	var rejected []string
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len() && int64(len(rejected)) < c.RejectedProfiles; i++ {
+		sps := rps.At(i).ScopeProfiles()
+		for j := 0; j < sps.Len() && int64(len(rejected)) < c.RejectedProfiles; j++ {
+			pcs := sps.At(j).Profiles()
+			for k := 0; k < pcs.Len() && int64(len(rejected)) < c.RejectedProfiles; k++ {
+				rejected = append(rejected, pcs.At(k).ProfileID().String())
+			}
+		}
+	}
+
+	log.Warn("responding with partial success",
+		slog.Int64("rejected_profiles", c.RejectedProfiles),
+		slog.String("error_message", message),
+		slog.Any("rejected_profile_ids", rejected))
+}
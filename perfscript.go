@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"time"
+)
+
+// writePerfScript writes resolved profiles in the format of perf script, so tools reading its
+// output, like stackcollapse-perf.pl, work on OTLP profiles. Every timestamp of a sample is an
+// event, samples without timestamps are reported at the time of their profile. The command,
+// process and thread come from the process.executable.name, process.pid, thread.name and
+// thread.id attributes of the sample or its resource.
+func writePerfScript(w io.Writer, views []profileView) error {
+	bw := bufio.NewWriter(w)
+	for _, view := range views {
+		p := view.Profile
+		event := p.SampleType
+		if event == "" {
+			event = "samples"
+		}
+
+		for _, sample := range p.Samples {
+			attr := func(key string) string {
+				if v, ok := sample.Attributes[key]; ok {
+					return v
+				}
+				return view.Resource.Attributes[key]
+			}
+			comm := attr("thread.name")
+			if comm == "" {
+				comm = attr("process.executable.name")
+			}
+			if comm == "" {
+				comm = "[unknown]"
+			}
+			pid, tid := perfScriptID(attr("process.pid")), perfScriptID(attr("thread.id"))
+			if tid == "-1" {
+				tid = pid
+			}
+			cpu := ""
+			if c := attr("cpu.logical_number"); c != "" {
+				cpu = fmt.Sprintf(" [%03s]", c)
+			}
+
+			timestamps := sample.Timestamps
+			if len(timestamps) == 0 {
+				timestamps = []time.Time{p.Time}
+			}
+			for i, ts := range timestamps {
+				fmt.Fprintf(bw, "%s %s/%s%s %d.%06d: %d %s:\n",
+					comm, pid, tid, cpu, ts.Unix(), ts.Nanosecond()/1e3, perfScriptValue(sample.Values, i), event)
+				for _, frame := range sample.Frames {
+					mapping := "[unknown]"
+					if frame.Mapping != "" {
+						mapping = frame.Mapping
+					}
+					function := "[unknown]"
+					if frame.Function != "" {
+						function = frame.Function
+					} else if frame.Mapping != "" {
+						function = fmt.Sprintf("%s+%#x", path.Base(frame.Mapping), frame.Address)
+					}
+					fmt.Fprintf(bw, "\t%16x %s (%s)\n", frame.Address, function, mapping)
+				}
+				fmt.Fprintln(bw)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// perfScriptID returns the pid or tid of an attribute value, or -1 like perf for unknown ones.
+func perfScriptID(v string) string {
+	if v == "" {
+		return "-1"
+	}
+	return v
+}
+
+// perfScriptValue returns the value of the i-th timestamp. Samples with a single value for all
+// timestamps report it for each.
+func perfScriptValue(values []int64, i int) int64 {
+	switch {
+	case i < len(values):
+		return values[i]
+	case len(values) > 0:
+		return values[0]
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,70 @@
+package dump
+
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiBlue    = "\x1b[34m"
+	ansiMagenta = "\x1b[35m"
+	ansiCyan    = "\x1b[36m"
+)
+
+var frameTypeColors = map[string]string{
+	"kernel": ansiRed,
+	"native": ansiYellow,
+	"go":     ansiCyan,
+	"jvm":    ansiGreen,
+	"python": ansiBlue,
+	"ruby":   ansiMagenta,
+	"php":    ansiMagenta,
+	"perl":   ansiBlue,
+	"v8js":   ansiGreen,
+	"dotnet": ansiBlue,
+	"beam":   ansiMagenta,
+	"luajit": ansiCyan,
+}
+
+// Colorizer wraps parts of the dump output in ANSI escape sequences. The zero value does not
+// colorize anything.
+type Colorizer struct {
+	enabled bool
+}
+
+// NewColorizer returns a Colorizer, which only colorizes if enabled is set.
+func NewColorizer(enabled bool) Colorizer {
+	return Colorizer{enabled: enabled}
+}
+
+func (c Colorizer) wrap(code, s string) string {
+	if !c.enabled || code == "" {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+func (c Colorizer) ResourceSeparator(s string) string {
+	return c.wrap(ansiBold+ansiMagenta, s)
+}
+
+func (c Colorizer) ProfileSeparator(s string) string {
+	return c.wrap(ansiBold+ansiBlue, s)
+}
+
+func (c Colorizer) SampleSeparator(s string) string {
+	return c.wrap(ansiDim, s)
+}
+
+func (c Colorizer) Key(s string) string {
+	return c.wrap(ansiBold, s)
+}
+
+func (c Colorizer) FrameType(s string) string {
+	return c.wrap(frameTypeColors[s], s)
+}
+
+func (c Colorizer) Warning(s string) string {
+	return c.wrap(ansiBold+ansiRed, s)
+}
@@ -0,0 +1,87 @@
+package dump
+
+import (
+	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// DictionaryStats describes the size of the dictionary of a request and how well the samples
+// share it.
+type DictionaryStats struct {
+	Strings     int
+	StringBytes int
+	Locations   int
+	Functions   int
+	Mappings    int
+	Stacks      int
+	Attributes  int
+	Links       int
+	// Samples is the number of samples of all profiles, UniqueStacks the number of distinct
+	// stacks they reference.
+	Samples      int
+	UniqueStacks int
+}
+
+// CountDictionary computes the dictionary statistics of a request.
+func CountDictionary(pd pprofile.Profiles) DictionaryStats {
+	dict := pd.Dictionary()
+	stats := DictionaryStats{
+		Strings:    dict.StringTable().Len(),
+		Locations:  dict.LocationTable().Len(),
+		Functions:  dict.FunctionTable().Len(),
+		Mappings:   dict.MappingTable().Len(),
+		Stacks:     dict.StackTable().Len(),
+		Attributes: dict.AttributeTable().Len(),
+		Links:      dict.LinkTable().Len(),
+	}
+	for _, s := range dict.StringTable().All() {
+		stats.StringBytes += len(s)
+	}
+
+	stacks := map[int32]bool{}
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		sps := rps.At(i).ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			pcs := sps.At(j).Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				samples := pcs.At(k).Samples()
+				stats.Samples += samples.Len()
+				for l := 0; l < samples.Len(); l++ {
+					stacks[samples.At(l).StackIndex()] = true
+				}
+			}
+		}
+	}
+	stats.UniqueStacks = len(stacks)
+	return stats
+}
+
+// String formats the statistics on a single line. The dedup ratio is the share of samples
+// reusing a stack of another sample.
+func (s DictionaryStats) String() string {
+	out := fmt.Sprintf("strings=%d (%d bytes), locations=%d, functions=%d, mappings=%d, stacks=%d, attributes=%d, links=%d; samples=%d, unique stacks=%d",
+		s.Strings, s.StringBytes, s.Locations, s.Functions, s.Mappings, s.Stacks, s.Attributes, s.Links, s.Samples, s.UniqueStacks)
+	if s.Samples > 0 {
+		out += fmt.Sprintf(" (dedup ratio %.1f%%)", percent(s.Samples-s.UniqueStacks, s.Samples))
+	}
+	return out
+}
+
+// attrs returns the statistics as attributes of the structured dump.
+func (s DictionaryStats) attrs() []slog.Attr {
+	return []slog.Attr{
+		slog.Int("strings", s.Strings),
+		slog.Int("string_bytes", s.StringBytes),
+		slog.Int("locations", s.Locations),
+		slog.Int("functions", s.Functions),
+		slog.Int("mappings", s.Mappings),
+		slog.Int("stacks", s.Stacks),
+		slog.Int("attributes", s.Attributes),
+		slog.Int("links", s.Links),
+		slog.Int("samples", s.Samples),
+		slog.Int("unique_stacks", s.UniqueStacks),
+	}
+}
@@ -0,0 +1,483 @@
+// Package dump writes OTLP profiles in a human readable form to a slog.Logger. It backs the
+// otel-profiles-debug-server and can be used as an OpenTelemetry Collector exporter, see
+// NewFactory.
+package dump
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// Config controls what gets dumped.
+type Config struct {
+	ExportResourceAttributes         bool     `mapstructure:"export_resource_attributes"`
+	ExportProfileAttributes          bool     `mapstructure:"export_profile_attributes"`
+	ExportSampleAttributes           bool     `mapstructure:"export_sample_attributes"`
+	ExportStackFrames                bool     `mapstructure:"export_stack_frames"`
+	ExportStackFrameTypes            []string `mapstructure:"export_stack_frame_types"`
+	IgnoreProfilesWithoutContainerID bool     `mapstructure:"ignore_profiles_without_container_id"`
+	FilterSampleTypes                []string `mapstructure:"filter_sample_types"`
+	FilterExecutableNames            []string `mapstructure:"filter_executable_names"`
+	// Follow selects the only resources to dump, by attribute key and path.Match pattern of
+	// the value. A resource must match all of them.
+	Follow map[string]string `mapstructure:"follow"`
+	// FilterScopeNames are path.Match patterns of the instrumentation scope names to dump.
+	// Patterns prefixed with ! exclude matching scopes instead.
+	FilterScopeNames []string `mapstructure:"filter_scope_names"`
+	// Color enables ANSI colors in the plain dump output.
+	Color bool `mapstructure:"color"`
+	// MaxAttributeLength truncates longer attribute values, 0 means unlimited.
+	MaxAttributeLength int `mapstructure:"max_attribute_length"`
+	// ExportLocationAttributes adds the attributes of the location, other than
+	// profile.frame.type, to every frame.
+	ExportLocationAttributes bool `mapstructure:"export_location_attributes"`
+	// ExportFrameTypeHistogram adds the distribution of frame types to every profile.
+	ExportFrameTypeHistogram bool `mapstructure:"export_frame_type_histogram"`
+	// SplitKernelFrames separates the kernel and user space frames of every stack and adds the
+	// kernel/user sample ratio to every profile.
+	SplitKernelFrames bool `mapstructure:"split_kernel_frames"`
+	// ExportDictionaryStats adds the size of the dictionary tables and the stack dedup ratio
+	// to every request.
+	ExportDictionaryStats bool `mapstructure:"export_dictionary_stats"`
+	// GroupByProcess dumps the samples grouped by executable name and PID, with subtotals.
+	GroupByProcess bool `mapstructure:"group_by_process"`
+	// ThreadTopStacks adds the sample count, value and this many top stacks per thread.name to
+	// every profile, 0 disables it.
+	ThreadTopStacks int `mapstructure:"thread_top_stacks"`
+	// MaxStackDepth limits the number of dumped frames per sample, 0 means unlimited.
+	MaxStackDepth int `mapstructure:"max_stack_depth"`
+	// Resources, if set, limits the resource attributes to the first time a resource is
+	// dumped, later dumps only refer to its fingerprint.
+	Resources *ResourceCache `mapstructure:"-"`
+}
+
+// Profiles dumps all resource profiles. Dump lines are logged at info, skip notices at warn
+// level. Loggers with a handler other than PlainHandler, like the slog text and JSON handlers,
+// get a record per profile and sample with the fields as attributes instead of dump lines.
+func Profiles(log *slog.Logger, config Config, pd pprofile.Profiles) {
+	if config.ExportDictionaryStats {
+		if isPlain(log) {
+			log.Info(fmt.Sprintf("Dictionary: %s", CountDictionary(pd)))
+		} else {
+			log.LogAttrs(context.Background(), slog.LevelInfo, "dictionary", CountDictionary(pd).attrs()...)
+		}
+	}
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		ResourceProfile(log, config, pd.Dictionary(), rps.At(i))
+	}
+}
+
+// ResourceProfile dumps a single resource profile, resolving references via dict. The output
+// of a PlainHandler is written once per profile, other handlers get structured records.
+func ResourceProfile(logger *slog.Logger, config Config, dict pprofile.ProfilesDictionary, rp pprofile.ResourceProfiles) {
+	if !isPlain(logger) {
+		structuredResourceProfile(logger, config, dict, rp)
+		return
+	}
+	log := newLineLogger(logger)
+	defer log.Close()
+
+	lookup := NewLookup(dict)
+	c := NewColorizer(config.Color)
+
+	if !IncludeResource(config, rp.Resource().Attributes()) {
+		return
+	}
+
+	if config.IgnoreProfilesWithoutContainerID {
+		containerID, ok := rp.Resource().Attributes().Get("container.id")
+		if !ok || containerID.AsString() == "" {
+			log.Warn(c.ResourceSeparator("--------------- New Resource Profile --------------"))
+			log.Warn("              SKIPPED (no container.id)")
+			log.Warn(c.ResourceSeparator("-------------- End Resource Profile ---------------") + "\n")
+			return
+		}
+	}
+
+	log.Info(c.ResourceSeparator("--------------- New Resource Profile --------------"))
+	if config.ExportResourceAttributes {
+		seen := false
+		if config.Resources != nil && rp.Resource().Attributes().Len() > 0 {
+			var fingerprint string
+			fingerprint, seen = config.Resources.See(rp.Resource().Attributes())
+			if seen {
+				log.Info(fmt.Sprintf("  Resource: %s (attributes unchanged)", fingerprint))
+			} else {
+				log.Info(fmt.Sprintf("  Resource: %s (new)", fingerprint))
+			}
+		}
+		if !seen {
+			rp.Resource().Attributes().Range(func(k string, v pcommon.Value) bool {
+				log.Info(fmt.Sprintf("  %s: %v", c.Key(k), Truncate(v.AsString(), config.MaxAttributeLength)))
+				return true
+			})
+		}
+	}
+
+	if rp.SchemaUrl() != "" {
+		log.Info(fmt.Sprintf("  Schema URL: %s", rp.SchemaUrl()))
+	}
+	if dropped := rp.Resource().DroppedAttributesCount(); dropped > 0 {
+		log.Warn(fmt.Sprintf("  Resource dropped attributes count: %d", dropped))
+	}
+
+	sps := rp.ScopeProfiles()
+	for j := 0; j < sps.Len(); j++ {
+		if !IncludeScope(config, sps.At(j).Scope().Name()) {
+			continue
+		}
+		if sp := sps.At(j); sp.SchemaUrl() != "" {
+			log.Info(fmt.Sprintf("  Scope schema URL: %s (%s)", sp.SchemaUrl(), strings.TrimSpace(sp.Scope().Name()+" "+sp.Scope().Version())))
+		}
+		if dropped := sps.At(j).Scope().DroppedAttributesCount(); dropped > 0 {
+			log.Warn(fmt.Sprintf("  Scope dropped attributes count: %d", dropped))
+		}
+		pcs := sps.At(j).Profiles()
+		// Every profile has a single sample type, a scope declares several sample types with
+		// one profile each.
+		if pcs.Len() > 1 {
+			var sampleTypes []string
+			for _, profile := range pcs.All() {
+				sampleTypes = append(sampleTypes, formatValueType(lookup, profile.SampleType()))
+			}
+			log.Info(fmt.Sprintf("  Sample types: %s", strings.Join(sampleTypes, ", ")))
+		}
+		for k := 0; k < pcs.Len(); k++ {
+			profile := pcs.At(k)
+			sampleType := lookup.String(profile.SampleType().TypeStrindex())
+
+			if len(config.FilterSampleTypes) > 0 && !slices.Contains(config.FilterSampleTypes, sampleType) {
+				continue
+			}
+
+			log := log.With(slog.String("profile_id", profile.ProfileID().String()))
+			d := newSampleDumper(log, config, lookup, profile)
+			log.Info(c.ProfileSeparator("------------------- New Profile -------------------"))
+			log.Info(fmt.Sprintf("  ProfileID: %x", [16]byte(profile.ProfileID())))
+			log.Info(fmt.Sprintf("  Time: %v", profile.Time().AsTime()))
+			log.Info(fmt.Sprintf("  Duration: %v", time.Duration(profile.DurationNano()*uint64(time.Nanosecond))))
+			log.Info(fmt.Sprintf("  PeriodType: [%v, %v]",
+				lookup.String(profile.PeriodType().TypeStrindex()),
+				lookup.String(profile.PeriodType().UnitStrindex())))
+
+			log.Info(fmt.Sprintf("  Period: %v", profile.Period()))
+			log.Info(fmt.Sprintf("  Dropped attributes count: %d", profile.DroppedAttributesCount()))
+			log.Info(fmt.Sprintf("  SampleType: %s", formatValueType(lookup, profile.SampleType())))
+			for _, issue := range CheckValues(lookup, profile) {
+				log.Warn(c.Warning(fmt.Sprintf("  Implausible value: %s", issue)))
+			}
+
+			profileAttrs := profile.AttributeIndices()
+			if profileAttrs.Len() > 0 {
+				for _, idx := range profileAttrs.All() {
+					key, value := lookup.KeyValue(idx, config.MaxAttributeLength)
+					log.Info(fmt.Sprintf("  %s: %s", key, value))
+				}
+				log.Info("~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~")
+			}
+
+			if config.ExportFrameTypeHistogram {
+				log.Info(fmt.Sprintf("  Frame types: %s", CountFrames(dict, profile)))
+			}
+
+			if config.SplitKernelFrames {
+				log.Info(fmt.Sprintf("  Kernel/user: %s", CountKernel(dict, profile)))
+			}
+
+			if config.ThreadTopStacks > 0 {
+				dumpThreads(log, config, dict, profile)
+			}
+
+			if d.format != nil {
+				dumpTotal(log, config, lookup, profile, d.format)
+			}
+
+			if d.duration != nil {
+				dumpBlockingFrames(log, config, lookup, profile, d.duration)
+			}
+
+			samples := profile.Samples()
+			if config.GroupByProcess {
+				for _, group := range groupByProcess(config, dict, rp, samples) {
+					log.Info(c.ProfileSeparator(fmt.Sprintf("  Process: %s, PID: %s, Samples: %d, Value: %d",
+						group.executableName, group.pid, len(group.samples), group.value)))
+					for _, sample := range group.samples {
+						d.dump(sample)
+					}
+				}
+			} else {
+				for l := 0; l < samples.Len(); l++ {
+					sample := samples.At(l)
+					if includeSample(config, dict, sample) {
+						d.dump(sample)
+					}
+				}
+			}
+			log.Info(c.ProfileSeparator("------------------- End Profile -------------------"))
+			log.Flush()
+		}
+	}
+
+	log.Info(c.ResourceSeparator("-------------- End Resource Profile ---------------") + "\n")
+}
+
+// sampleDumper dumps the samples of a profile. It caches the formatted frame type and
+// attributes of every location, as the same locations show up in many stacks.
+type sampleDumper struct {
+	log    lineLogger
+	config Config
+	lookup Lookup
+	c      Colorizer
+	// valueType labels the sample values with the sample type and unit of the profile.
+	valueType string
+	// duration converts the sample values of off-CPU and wall-clock profiles to durations.
+	duration func(int64) time.Duration
+	// format formats the sample values in their unit, if it's known.
+	format func(int64) string
+
+	locations []locationInfo
+}
+
+type locationInfo struct {
+	frameType        string
+	coloredFrameType string
+	// attributes are the formatted attributes other than profile.frame.type, if enabled.
+	attributes string
+	kernel     bool
+}
+
+func newSampleDumper(log lineLogger, config Config, lookup Lookup, profile pprofile.Profile) *sampleDumper {
+	valueType := lookup.String(profile.SampleType().TypeStrindex())
+	if unit := lookup.String(profile.SampleType().UnitStrindex()); unit != "" {
+		valueType += ", " + unit
+	}
+	return &sampleDumper{
+		log:       log,
+		config:    config,
+		lookup:    lookup,
+		c:         NewColorizer(config.Color),
+		valueType: valueType,
+		duration:  SampleDuration(lookup, profile),
+		format:    ValueFormatter(lookup, profile),
+		locations: make([]locationInfo, lookup.dict.LocationTable().Len()),
+	}
+}
+
+// formatValueType formats a sample or period type with its unit, if set.
+func formatValueType(lookup Lookup, vt pprofile.ValueType) string {
+	if unit := lookup.String(vt.UnitStrindex()); unit != "" {
+		return fmt.Sprintf("%s [%s]", lookup.String(vt.TypeStrindex()), unit)
+	}
+	return lookup.String(vt.TypeStrindex())
+}
+
+func (d *sampleDumper) location(idx int32, location pprofile.Location) locationInfo {
+	if d.locations[idx].frameType == "" {
+		frameType := FrameType(d.lookup.dict, location)
+		info := locationInfo{
+			frameType:        frameType,
+			coloredFrameType: d.c.FrameType(frameType),
+			kernel:           d.config.SplitKernelFrames && IsKernelFrame(d.lookup, location),
+		}
+		if d.config.ExportLocationAttributes {
+			var attrs []string
+			for _, attrIdx := range location.AttributeIndices().All() {
+				key, value := d.lookup.KeyValue(attrIdx, d.config.MaxAttributeLength)
+				if key != "profile.frame.type" {
+					attrs = append(attrs, d.c.Key(key)+"="+value)
+				}
+			}
+			info.attributes = strings.Join(attrs, ", ")
+		}
+		d.locations[idx] = info
+	}
+	return d.locations[idx]
+}
+
+// dump dumps a single sample.
+func (d *sampleDumper) dump(sample pprofile.Sample) {
+	log, config, lookup, c := d.log, d.config, d.lookup, d.c
+
+	log.Info(c.SampleSeparator("------------------- New Sample --------------------"))
+
+	for t := 0; t < sample.TimestampsUnixNano().Len(); t++ {
+		sampleTimestampUnixNano := sample.TimestampsUnixNano().At(t)
+		sampleTimestampNano := time.Unix(0, int64(sampleTimestampUnixNano))
+		log.Info(fmt.Sprintf("  Timestamp[%d]: %d (%s)", t,
+			sampleTimestampUnixNano,
+			sampleTimestampNano))
+	}
+
+	// Values are either a single aggregated value or one per timestamp.
+	if sample.Values().Len() > 0 && d.format != nil {
+		log.Info(fmt.Sprintf("  Values (%s): %v = %s", d.valueType, sample.Values().AsRaw(),
+			formatValues(sample.Values().AsRaw(), d.format)))
+	} else if sample.Values().Len() > 0 {
+		log.Info(fmt.Sprintf("  Values (%s): %v", d.valueType, sample.Values().AsRaw()))
+	}
+
+	if link, ok := lookup.Link(sample.LinkIndex()); ok {
+		log.Info(fmt.Sprintf("  TraceID: %s, SpanID: %s", link.TraceID(), link.SpanID()))
+	}
+
+	if config.ExportSampleAttributes {
+		for _, idx := range sample.AttributeIndices().All() {
+			key, value := lookup.KeyValue(idx, config.MaxAttributeLength)
+			log.Info(fmt.Sprintf("  %s: %s", key, value))
+		}
+		log.Info("---------------------------------------------------")
+	}
+
+	stack, ok := lookup.Stack(sample.StackIndex())
+	if !ok {
+		log.Info(fmt.Sprintf("Stack: %s", invalidIndex(sample.StackIndex())))
+	}
+	if ok && config.ExportStackFrames {
+		// space is the kernel or user space of the previous frame, to separate them.
+		space := ""
+		profileLocationsIndices := stack.LocationIndices()
+		for m := 0; m < profileLocationsIndices.Len(); m++ {
+			if config.MaxStackDepth > 0 && m >= config.MaxStackDepth {
+				log.Info(fmt.Sprintf("... %d more frames (stack depth %d)", profileLocationsIndices.Len()-m, profileLocationsIndices.Len()))
+				break
+			}
+			locationIdx := profileLocationsIndices.At(m)
+			location, ok := lookup.Location(locationIdx)
+			if !ok {
+				log.Info(fmt.Sprintf("Location: %s", invalidIndex(locationIdx)))
+				continue
+			}
+			info := d.location(locationIdx, location)
+
+			if len(config.ExportStackFrameTypes) > 0 &&
+				!slices.Contains(config.ExportStackFrameTypes, info.frameType) {
+				continue
+			}
+
+			if config.SplitKernelFrames {
+				current := "user space"
+				if info.kernel {
+					current = "kernel"
+				}
+				if current != space {
+					log.Info(c.SampleSeparator(fmt.Sprintf("  ---- %s ----", current)))
+					space = current
+				}
+			}
+
+			locationLine := location.Lines()
+			if locationLine.Len() == 0 {
+				filename := lookup.MappingFile(location.MappingIndex())
+				log.Info(fmt.Sprintf("Instrumentation: %s: Function: %#04x, File: %s", info.coloredFrameType, location.Address(), filename))
+			}
+
+			// Lines are ordered from the innermost inlined function outwards, like the stack. The
+			// last one is the function the others were inlined into, the inlined ones are
+			// indented by their depth in the inline chain.
+			last := locationLine.Len() - 1
+			for n := 0; n <= last; n++ {
+				line := locationLine.At(n)
+				functionName, fileName := invalidIndex(line.FunctionIndex()), ""
+				if function, ok := lookup.Function(line.FunctionIndex()); ok {
+					functionName = lookup.String(function.NameStrindex())
+					fileName = lookup.String(function.FilenameStrindex())
+				}
+				if n == last {
+					log.Info(fmt.Sprintf("Instrumentation: %s, Function: %s, File: %s, Line: %d, Column: %d",
+						info.coloredFrameType, functionName, fileName, line.Line(), line.Column()))
+					continue
+				}
+				log.Info(fmt.Sprintf("%s[inlined] Function: %s, File: %s, Line: %d, Column: %d",
+					strings.Repeat("  ", last-n), functionName, fileName, line.Line(), line.Column()))
+			}
+			if info.attributes != "" {
+				log.Info(fmt.Sprintf("  Location attributes: %s", info.attributes))
+			}
+		}
+	}
+
+	log.Info(c.SampleSeparator("------------------- End Sample --------------------"))
+}
+
+// IncludeResource returns whether the resource is selected by Follow.
+func IncludeResource(config Config, attrs pcommon.Map) bool {
+	for key, pattern := range config.Follow {
+		v, ok := attrs.Get(key)
+		if !ok {
+			return false
+		}
+		if matched, _ := path.Match(pattern, v.AsString()); !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// includeSample returns whether the sample passes the executable name filter.
+func includeSample(config Config, dict pprofile.ProfilesDictionary, sample pprofile.Sample) bool {
+	if len(config.FilterExecutableNames) == 0 {
+		return true
+	}
+	executableName := AttributeValue(sample.AttributeIndices(), dict.AttributeTable(), dict.StringTable(), "process.executable.name")
+	return slices.Contains(config.FilterExecutableNames, executableName)
+}
+
+// Truncate shortens s to max bytes, appending an ellipsis and the original length. A max of 0
+// means unlimited.
+func Truncate(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s… (%d bytes)", s[:cut], len(s))
+}
+
+// FormatAttributeValue formats the value of a dictionary attribute, truncated to max bytes,
+// followed by its unit from the attribute-unit column, if set.
+func FormatAttributeValue(attr pprofile.KeyValueAndUnit, stringTable pcommon.StringSlice, max int) string {
+	value := Truncate(attr.Value().AsString(), max)
+	if unit := AttributeUnit(attr, stringTable); unit != "" {
+		value += " " + unit
+	}
+	return value
+}
+
+// AttributeUnit returns the unit of a dictionary attribute, or an empty string.
+func AttributeUnit(attr pprofile.KeyValueAndUnit, stringTable pcommon.StringSlice) string {
+	idx := int(attr.UnitStrindex())
+	if idx <= 0 || idx >= stringTable.Len() {
+		return ""
+	}
+	return stringTable.At(idx)
+}
+
+// AttributeValue returns the value of the attribute with the given key, or an empty string.
+func AttributeValue(attrs pcommon.Int32Slice, attrTable pprofile.KeyValueAndUnitSlice, stringTable pcommon.StringSlice, key string) string {
+	for _, idx := range attrs.All() {
+		if idx < 0 || int(idx) >= attrTable.Len() {
+			continue
+		}
+		attr := attrTable.At(int(idx))
+
+		if keyIdx := int(attr.KeyStrindex()); keyIdx < 0 || keyIdx >= stringTable.Len() || stringTable.At(keyIdx) != key {
+			continue
+		}
+
+		return attr.Value().AsString()
+	}
+
+	return ""
+}
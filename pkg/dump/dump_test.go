@@ -0,0 +1,126 @@
+package dump
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// testRequest builds a request resembling what the eBPF profiler sends: a resource with a
+// single profile of the given number of samples, each with a thread name and a stack of depth
+// frames mixing native, kernel and interpreted ones.
+func testRequest(samples, depth int) pprofile.Profiles {
+	pd := pprofile.NewProfiles()
+	dict := pd.Dictionary()
+	dict.StringTable().Append("")
+	dict.MappingTable().AppendEmpty()
+	dict.LocationTable().AppendEmpty()
+	dict.FunctionTable().AppendEmpty()
+	dict.LinkTable().AppendEmpty()
+	dict.StackTable().AppendEmpty()
+	dict.AttributeTable().AppendEmpty()
+
+	str := func(s string) int32 {
+		idx, _ := pprofile.SetString(dict.StringTable(), s)
+		return idx
+	}
+	attr := func(key, value string) int32 {
+		kv := pprofile.NewKeyValueAndUnit()
+		kv.SetKeyStrindex(str(key))
+		kv.Value().SetStr(value)
+		idx, _ := pprofile.SetAttribute(dict.AttributeTable(), kv)
+		return idx
+	}
+	frameTypes := []string{"kernel", "native", "native", "python", "jvm"}
+	location := func(frameType string, depth, variant int) int32 {
+		location := pprofile.NewLocation()
+		location.AttributeIndices().Append(attr("profile.frame.type", frameType))
+		switch frameType {
+		case "native", "kernel":
+			mapping := pprofile.NewMapping()
+			mapping.SetFilenameStrindex(str("/usr/lib/libtest.so"))
+			mapping.SetMemoryStart(0x1000)
+			mapping.SetMemoryLimit(0x100000)
+			mappingIndex, _ := pprofile.SetMapping(dict.MappingTable(), mapping)
+			location.SetMappingIndex(mappingIndex)
+			location.SetAddress(0x1000 + uint64(depth)*0x100 + uint64(variant)*0x10)
+		default:
+			function := pprofile.NewFunction()
+			function.SetNameStrindex(str(fmt.Sprintf("%s_func_%d_%d", frameType, depth, variant)))
+			function.SetFilenameStrindex(str(fmt.Sprintf("%s/file_%d.py", frameType, depth)))
+			functionIndex, _ := pprofile.SetFunction(dict.FunctionTable(), function)
+			line := location.Lines().AppendEmpty()
+			line.SetFunctionIndex(functionIndex)
+			line.SetLine(int64(10 + depth))
+		}
+		idx, _ := pprofile.SetLocation(dict.LocationTable(), location)
+		return idx
+	}
+
+	rp := pd.ResourceProfiles().AppendEmpty()
+	rp.Resource().Attributes().PutStr("service.name", "test")
+	rp.Resource().Attributes().PutStr("container.id", "0123456789abcdef")
+	rp.Resource().Attributes().PutStr("host.name", "localhost")
+	sp := rp.ScopeProfiles().AppendEmpty()
+	sp.Scope().SetName("test")
+
+	now := time.Unix(1700000000, 0)
+	profile := sp.Profiles().AppendEmpty()
+	profile.SetProfileID(pprofile.ProfileID{1, 2, 3, 4})
+	profile.SetTime(pcommon.NewTimestampFromTime(now))
+	profile.SetDurationNano(uint64(5 * time.Second))
+	profile.SampleType().SetTypeStrindex(str("events"))
+	profile.SampleType().SetUnitStrindex(str("count"))
+	profile.PeriodType().SetTypeStrindex(str("cpu"))
+	profile.PeriodType().SetUnitStrindex(str("nanoseconds"))
+	profile.SetPeriod(int64(50 * time.Millisecond))
+
+	for i := range samples {
+		sample := profile.Samples().AppendEmpty()
+		sample.Values().Append(1)
+		sample.TimestampsUnixNano().Append(uint64(now.Add(time.Duration(i) * time.Millisecond).UnixNano()))
+		sample.AttributeIndices().Append(attr("thread.name", fmt.Sprintf("thread-%d", i%4)))
+		stack := pprofile.NewStack()
+		for d := range depth {
+			stack.LocationIndices().Append(location(frameTypes[(i+d)%len(frameTypes)], d, i%3))
+		}
+		stackIndex, _ := pprofile.SetStack(dict.StackTable(), stack)
+		sample.SetStackIndex(stackIndex)
+	}
+	return pd
+}
+
+func TestProfilesDictionaryStats(t *testing.T) {
+	var out bytes.Buffer
+	log := slog.New(NewPlainHandler(&out, slog.LevelInfo))
+	pd := testRequest(3, 4)
+	Profiles(log, Config{ExportDictionaryStats: true}, pd)
+
+	want := fmt.Sprintf("Dictionary: %s", CountDictionary(pd))
+	if !strings.Contains(out.String(), want) {
+		t.Errorf("dump output lacks %q:\n%s", want, out.String())
+	}
+}
+
+func BenchmarkProfiles(b *testing.B) {
+	pd := testRequest(200, 32)
+	log := slog.New(NewPlainHandler(io.Discard, slog.LevelInfo))
+	config := Config{
+		ExportResourceAttributes: true,
+		ExportSampleAttributes:   true,
+		ExportStackFrames:        true,
+		FilterSampleTypes:        []string{"events"},
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		Profiles(log, config, pd)
+	}
+}
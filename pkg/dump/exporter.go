@@ -0,0 +1,131 @@
+package dump
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/exporter"
+	"go.opentelemetry.io/collector/exporter/xexporter"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+var componentType = component.MustNewType("profilesdebug")
+
+// ExporterConfig is the configuration of the collector exporter.
+type ExporterConfig struct {
+	Config `mapstructure:",squash"`
+	// Output is stdout, stderr or the path of a file to append to.
+	Output string `mapstructure:"output"`
+	// Format is plain, or text or json for a record per profile and sample.
+	Format string `mapstructure:"format"`
+	// HideRepeatedResourceAttributes prints the attributes of a resource only when they
+	// change, and the fingerprint of the resource otherwise.
+	HideRepeatedResourceAttributes bool `mapstructure:"hide_repeated_resource_attributes"`
+}
+
+// Validate checks the configuration, it is called by the collector.
+func (c *ExporterConfig) Validate() error {
+	switch c.Format {
+	case "plain", "text", "json":
+	default:
+		return fmt.Errorf("unknown format %q, expected plain, text or json", c.Format)
+	}
+	if c.Output == "" {
+		return fmt.Errorf("output must not be empty")
+	}
+	return nil
+}
+
+// NewFactory returns the factory of the profilesdebug exporter, which dumps profiles just
+// like the debug server does. It can be added to collector builds, e.g. via the builder's
+// exporters list.
+func NewFactory() xexporter.Factory {
+	return xexporter.NewFactory(componentType, createDefaultConfig,
+		xexporter.WithProfiles(createProfiles, component.StabilityLevelDevelopment))
+}
+
+func createDefaultConfig() component.Config {
+	return &ExporterConfig{
+		Config: Config{
+			ExportResourceAttributes: true,
+			ExportProfileAttributes:  true,
+			ExportSampleAttributes:   true,
+			ExportStackFrames:        true,
+		},
+		Output: "stdout",
+		Format: "plain",
+	}
+}
+
+func createProfiles(_ context.Context, _ exporter.Settings, cfg component.Config) (xexporter.Profiles, error) {
+	return &profilesExporter{cfg: cfg.(*ExporterConfig)}, nil
+}
+
+type profilesExporter struct {
+	cfg *ExporterConfig
+	out io.WriteCloser
+	log *slog.Logger
+	// resources remembers the dumped resources, if HideRepeatedResourceAttributes is set.
+	resources *ResourceCache
+}
+
+func (e *profilesExporter) Start(context.Context, component.Host) error {
+	switch e.cfg.Output {
+	case "stdout":
+		e.out = nopCloser{os.Stdout}
+	case "stderr":
+		e.out = nopCloser{os.Stderr}
+	default:
+		f, err := os.OpenFile(e.cfg.Output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		e.out = f
+	}
+
+	var h slog.Handler
+	switch e.cfg.Format {
+	case "text":
+		h = slog.NewTextHandler(e.out, nil)
+	case "json":
+		h = slog.NewJSONHandler(e.out, nil)
+	default:
+		h = NewPlainHandler(e.out, slog.LevelInfo)
+	}
+	e.log = slog.New(h)
+	if e.cfg.HideRepeatedResourceAttributes {
+		e.resources = NewResourceCache()
+	}
+	return nil
+}
+
+func (e *profilesExporter) Shutdown(context.Context) error {
+	if e.out == nil {
+		return nil
+	}
+	return e.out.Close()
+}
+
+func (e *profilesExporter) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: false}
+}
+
+func (e *profilesExporter) ConsumeProfiles(_ context.Context, pd pprofile.Profiles) error {
+	config := e.cfg.Config
+	config.Resources = e.resources
+	Profiles(e.log, config, pd)
+	return nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
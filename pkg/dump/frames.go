@@ -0,0 +1,102 @@
+package dump
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// FrameStats counts the frames of all samples of a profile.
+type FrameStats struct {
+	Total int
+	// Types maps the profile.frame.type to the number of frames.
+	Types map[string]int
+	// Native is the number of native frames, UnsymbolizedNative those of them without any
+	// line information.
+	Native             int
+	UnsymbolizedNative int
+	// Unsymbolized is the number of frames without line information by mapping file name.
+	Unsymbolized map[string]int
+}
+
+// CountFrames counts the frames of all samples of the profile.
+func CountFrames(dict pprofile.ProfilesDictionary, profile pprofile.Profile) FrameStats {
+	stats := FrameStats{
+		Types:        map[string]int{},
+		Unsymbolized: map[string]int{},
+	}
+	lookup := NewLookup(dict)
+
+	samples := profile.Samples()
+	for i := 0; i < samples.Len(); i++ {
+		stack, ok := lookup.Stack(samples.At(i).StackIndex())
+		if !ok {
+			continue
+		}
+		for _, locIdx := range stack.LocationIndices().All() {
+			location, ok := lookup.Location(locIdx)
+			if !ok {
+				continue
+			}
+			frameType := FrameType(dict, location)
+			stats.Total++
+			stats.Types[frameType]++
+
+			symbolized := location.Lines().Len() > 0
+			if frameType == "native" {
+				stats.Native++
+				if !symbolized {
+					stats.UnsymbolizedNative++
+				}
+			}
+			if !symbolized {
+				stats.Unsymbolized[lookup.MappingFile(location.MappingIndex())]++
+			}
+		}
+	}
+	return stats
+}
+
+// FrameType returns the profile.frame.type attribute of the location, or unknown.
+func FrameType(dict pprofile.ProfilesDictionary, location pprofile.Location) string {
+	if frameType := AttributeValue(location.AttributeIndices(), dict.AttributeTable(), dict.StringTable(), "profile.frame.type"); frameType != "" {
+		return frameType
+	}
+	return "unknown"
+}
+
+// String formats the frame type distribution, ordered by frame type.
+func (s FrameStats) String() string {
+	if s.Total == 0 {
+		return "no frames"
+	}
+	var parts []string
+	for _, t := range slices.Sorted(maps.Keys(s.Types)) {
+		parts = append(parts, fmt.Sprintf("%s=%d (%.1f%%)", t, s.Types[t], percent(s.Types[t], s.Total)))
+	}
+	out := strings.Join(parts, ", ")
+	if s.Native > 0 {
+		out += fmt.Sprintf("; unsymbolized native: %d/%d (%.1f%%)", s.UnsymbolizedNative, s.Native, percent(s.UnsymbolizedNative, s.Native))
+	}
+	return out
+}
+
+// attrs returns the distribution as attributes of the structured dump.
+func (s FrameStats) attrs() []slog.Attr {
+	attrs := []slog.Attr{slog.Int("total", s.Total)}
+	for _, t := range slices.Sorted(maps.Keys(s.Types)) {
+		attrs = append(attrs, slog.Int(t, s.Types[t]))
+	}
+	if s.Native > 0 {
+		attrs = append(attrs, slog.Int("unsymbolized_native", s.UnsymbolizedNative))
+	}
+	return attrs
+}
+
+func percent(n, total int) float64 {
+	return float64(n) / float64(total) * 100
+}
@@ -0,0 +1,66 @@
+package dump
+
+import (
+	"cmp"
+	"slices"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// processGroup holds the samples of a single process.
+type processGroup struct {
+	executableName string
+	pid            string
+	samples        []pprofile.Sample
+	// value is the sum of all values of the samples.
+	value int64
+}
+
+// groupByProcess groups the samples passing the filters by executable name and PID, taken from
+// the sample attributes or, if missing there, the resource attributes. Groups are ordered by
+// value, largest first.
+func groupByProcess(config Config, dict pprofile.ProfilesDictionary, rp pprofile.ResourceProfiles, samples pprofile.SampleSlice) []*processGroup {
+	resourceAttr := func(key string) string {
+		if v, ok := rp.Resource().Attributes().Get(key); ok {
+			return v.AsString()
+		}
+		return ""
+	}
+	attr := func(sample pprofile.Sample, key string) string {
+		if v := AttributeValue(sample.AttributeIndices(), dict.AttributeTable(), dict.StringTable(), key); v != "" {
+			return v
+		}
+		if v := resourceAttr(key); v != "" {
+			return v
+		}
+		return "<unknown>"
+	}
+
+	groups := map[[2]string]*processGroup{}
+	for i := 0; i < samples.Len(); i++ {
+		sample := samples.At(i)
+		if !includeSample(config, dict, sample) {
+			continue
+		}
+
+		key := [2]string{attr(sample, "process.executable.name"), attr(sample, "process.pid")}
+		g, ok := groups[key]
+		if !ok {
+			g = &processGroup{executableName: key[0], pid: key[1]}
+			groups[key] = g
+		}
+		g.samples = append(g.samples, sample)
+		for _, v := range sample.Values().All() {
+			g.value += v
+		}
+	}
+
+	sorted := make([]*processGroup, 0, len(groups))
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+	slices.SortFunc(sorted, func(a, b *processGroup) int {
+		return cmp.Or(cmp.Compare(b.value, a.value), cmp.Compare(a.executableName, b.executableName), cmp.Compare(a.pid, b.pid))
+	})
+	return sorted
+}
@@ -0,0 +1,153 @@
+package dump
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// bufferPool holds the buffers records and whole profiles are formatted into.
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// PlainHandler is a slog.Handler writing the bare message of every record followed by its
+// attributes, which keeps the classic look of the dump output.
+type PlainHandler struct {
+	mu    *sync.Mutex
+	w     io.Writer
+	level slog.Leveler
+	// buf collects the output instead of w while set, see buffered.
+	buf *bytes.Buffer
+}
+
+// NewPlainHandler returns a PlainHandler writing records of at least the given level to w.
+func NewPlainHandler(w io.Writer, level slog.Leveler) *PlainHandler {
+	return &PlainHandler{
+		mu:    &sync.Mutex{},
+		w:     w,
+		level: level,
+	}
+}
+
+func (h *PlainHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *PlainHandler) Handle(_ context.Context, r slog.Record) error {
+	if h.buf != nil {
+		h.format(h.buf, r)
+		return nil
+	}
+
+	b := bufferPool.Get().(*bytes.Buffer)
+	defer bufferPool.Put(b)
+	b.Reset()
+	h.format(b, r)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(b.Bytes())
+	return err
+}
+
+func (h *PlainHandler) format(b *bytes.Buffer, r slog.Record) {
+	b.WriteString(r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		b.WriteByte(' ')
+		b.WriteString(a.String())
+		return true
+	})
+	b.WriteByte('\n')
+}
+
+// buffered returns a handler collecting the output in a buffer until flush. It must not be
+// used concurrently and has to be released.
+func (h *PlainHandler) buffered() *PlainHandler {
+	b := bufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	return &PlainHandler{mu: h.mu, w: h.w, level: h.level, buf: b}
+}
+
+// flush writes the buffered output in a single write.
+func (h *PlainHandler) flush() error {
+	if h.buf.Len() == 0 {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(h.buf.Bytes())
+	h.buf.Reset()
+	return err
+}
+
+func (h *PlainHandler) release() {
+	bufferPool.Put(h.buf)
+	h.buf = nil
+}
+
+// WithAttrs drops the attributes, they only carry context for structured handlers and would
+// clutter the plain output.
+func (h *PlainHandler) WithAttrs([]slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *PlainHandler) WithGroup(string) slog.Handler {
+	return h
+}
+
+// lineLogger logs the lines of the dump. Unlike slog.Logger it doesn't capture the caller of
+// every line, which is a significant share of the dump time, and it buffers the output of a
+// PlainHandler until Flush.
+type lineLogger struct {
+	h slog.Handler
+	// buffered is the handler owning the buffer, if any.
+	buffered *PlainHandler
+}
+
+func newLineLogger(log *slog.Logger) lineLogger {
+	if ph, ok := log.Handler().(*PlainHandler); ok {
+		bh := ph.buffered()
+		return lineLogger{h: bh, buffered: bh}
+	}
+	return lineLogger{h: log.Handler()}
+}
+
+func (l lineLogger) Info(msg string) {
+	l.log(slog.LevelInfo, msg)
+}
+
+func (l lineLogger) Warn(msg string) {
+	l.log(slog.LevelWarn, msg)
+}
+
+func (l lineLogger) log(level slog.Level, msg string) {
+	ctx := context.Background()
+	if !l.h.Enabled(ctx, level) {
+		return
+	}
+	l.h.Handle(ctx, slog.NewRecord(time.Now(), level, msg, 0))
+}
+
+// With returns a lineLogger adding attrs to every line, sharing the buffer of l.
+func (l lineLogger) With(attrs ...slog.Attr) lineLogger {
+	return lineLogger{h: l.h.WithAttrs(attrs), buffered: l.buffered}
+}
+
+// Flush writes the buffered lines.
+func (l lineLogger) Flush() {
+	if l.buffered != nil {
+		l.buffered.flush()
+	}
+}
+
+// Close flushes the buffered lines and releases the buffer.
+func (l lineLogger) Close() {
+	if l.buffered != nil {
+		l.buffered.flush()
+		l.buffered.release()
+	}
+}
@@ -0,0 +1,100 @@
+package dump
+
+import (
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// IsKernelFrame returns whether the location is in kernel space, by its frame type or, for
+// frames without one, the name of its mapping.
+func IsKernelFrame(lookup Lookup, location pprofile.Location) bool {
+	switch FrameType(lookup.dict, location) {
+	case "kernel":
+		return true
+	case "unknown":
+	default:
+		return false
+	}
+
+	mapping, ok := lookup.Mapping(location.MappingIndex())
+	if !ok {
+		return false
+	}
+	name := path.Base(lookup.String(mapping.FilenameStrindex()))
+	return name == "vmlinux" || strings.HasPrefix(name, "vmlinux-") ||
+		strings.HasPrefix(name, "[kernel") || strings.HasSuffix(name, ".ko")
+}
+
+// KernelStats splits the samples and frames of a profile into kernel and user space.
+type KernelStats struct {
+	Samples int
+	// KernelSamples have at least one kernel frame, UserSamples none.
+	KernelSamples int
+	UserSamples   int
+	Frames        int
+	KernelFrames  int
+}
+
+// CountKernel computes the kernel and user space statistics of a profile.
+func CountKernel(dict pprofile.ProfilesDictionary, profile pprofile.Profile) KernelStats {
+	lookup := NewLookup(dict)
+	kernel := make(map[int32]bool, dict.LocationTable().Len())
+
+	var stats KernelStats
+	for _, sample := range profile.Samples().All() {
+		stack, ok := lookup.Stack(sample.StackIndex())
+		if !ok {
+			continue
+		}
+		stats.Samples++
+		kernelFrames := 0
+		for _, idx := range stack.LocationIndices().All() {
+			isKernel, ok := kernel[idx]
+			if !ok {
+				if location, ok := lookup.Location(idx); ok {
+					isKernel = IsKernelFrame(lookup, location)
+				}
+				kernel[idx] = isKernel
+			}
+			stats.Frames++
+			if isKernel {
+				kernelFrames++
+			}
+		}
+		stats.KernelFrames += kernelFrames
+		if kernelFrames > 0 {
+			stats.KernelSamples++
+		} else {
+			stats.UserSamples++
+		}
+	}
+	return stats
+}
+
+// String formats the statistics on a single line.
+func (s KernelStats) String() string {
+	if s.Samples == 0 {
+		return "no samples"
+	}
+	out := fmt.Sprintf("kernel samples %d (%.1f%%), user-only samples %d (%.1f%%)",
+		s.KernelSamples, percent(s.KernelSamples, s.Samples), s.UserSamples, percent(s.UserSamples, s.Samples))
+	if s.Frames > 0 {
+		out += fmt.Sprintf(", kernel frames %d/%d (%.1f%%)", s.KernelFrames, s.Frames, percent(s.KernelFrames, s.Frames))
+	}
+	return out
+}
+
+// attrs returns the statistics as attributes of the structured dump.
+func (s KernelStats) attrs() []slog.Attr {
+	return []slog.Attr{
+		slog.Int("samples", s.Samples),
+		slog.Int("kernel_samples", s.KernelSamples),
+		slog.Int("user_samples", s.UserSamples),
+		slog.Int("frames", s.Frames),
+		slog.Int("kernel_frames", s.KernelFrames),
+	}
+}
@@ -0,0 +1,221 @@
+package dump
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// Lookup resolves references into the dictionary of a request without panicking on malformed
+// payloads. Invalid string indices resolve to "<invalid index N>", all other invalid indices
+// are reported as not found. Every invalid reference is recorded in the corruption report.
+type Lookup struct {
+	dict   pprofile.ProfilesDictionary
+	report *CorruptionReport
+}
+
+// NewLookup returns a Lookup into dict recording invalid references.
+func NewLookup(dict pprofile.ProfilesDictionary) Lookup {
+	return Lookup{dict: dict, report: &CorruptionReport{}}
+}
+
+// Report returns the invalid references resolved so far.
+func (l Lookup) Report() *CorruptionReport {
+	return l.report
+}
+
+func (l Lookup) String(idx int32) string {
+	if idx < 0 || int(idx) >= l.dict.StringTable().Len() {
+		l.report.record("string", idx)
+		return invalidIndex(idx)
+	}
+	return l.dict.StringTable().At(int(idx))
+}
+
+func (l Lookup) Attribute(idx int32) (pprofile.KeyValueAndUnit, bool) {
+	if idx < 0 || int(idx) >= l.dict.AttributeTable().Len() {
+		l.report.record("attribute", idx)
+		return pprofile.KeyValueAndUnit{}, false
+	}
+	return l.dict.AttributeTable().At(int(idx)), true
+}
+
+func (l Lookup) Stack(idx int32) (pprofile.Stack, bool) {
+	if idx < 0 || int(idx) >= l.dict.StackTable().Len() {
+		l.report.record("stack", idx)
+		return pprofile.Stack{}, false
+	}
+	return l.dict.StackTable().At(int(idx)), true
+}
+
+func (l Lookup) Location(idx int32) (pprofile.Location, bool) {
+	if idx < 0 || int(idx) >= l.dict.LocationTable().Len() {
+		l.report.record("location", idx)
+		return pprofile.Location{}, false
+	}
+	return l.dict.LocationTable().At(int(idx)), true
+}
+
+func (l Lookup) Function(idx int32) (pprofile.Function, bool) {
+	if idx < 0 || int(idx) >= l.dict.FunctionTable().Len() {
+		l.report.record("function", idx)
+		return pprofile.Function{}, false
+	}
+	return l.dict.FunctionTable().At(int(idx)), true
+}
+
+// Mapping returns the mapping at idx. Index 0 means no mapping and is not reported.
+func (l Lookup) Mapping(idx int32) (pprofile.Mapping, bool) {
+	if idx == 0 {
+		return pprofile.Mapping{}, false
+	}
+	if idx < 0 || int(idx) >= l.dict.MappingTable().Len() {
+		l.report.record("mapping", idx)
+		return pprofile.Mapping{}, false
+	}
+	return l.dict.MappingTable().At(int(idx)), true
+}
+
+// Link returns the link at idx. Index 0 means no link and is not reported.
+func (l Lookup) Link(idx int32) (pprofile.Link, bool) {
+	if idx == 0 {
+		return pprofile.Link{}, false
+	}
+	if idx < 0 || int(idx) >= l.dict.LinkTable().Len() {
+		l.report.record("link", idx)
+		return pprofile.Link{}, false
+	}
+	return l.dict.LinkTable().At(int(idx)), true
+}
+
+// MappingFile returns the file name of the mapping at idx, or <unknown>.
+func (l Lookup) MappingFile(idx int32) string {
+	if mapping, ok := l.Mapping(idx); ok {
+		return l.String(mapping.FilenameStrindex())
+	}
+	return "<unknown>"
+}
+
+// Unit returns the unit of a dictionary attribute, or an empty string.
+func (l Lookup) Unit(attr pprofile.KeyValueAndUnit) string {
+	return AttributeUnit(attr, l.dict.StringTable())
+}
+
+// KeyValue returns the key and the value of the attribute at idx, formatted as with
+// FormatAttributeValue.
+func (l Lookup) KeyValue(idx int32, max int) (string, string) {
+	attr, ok := l.Attribute(idx)
+	if !ok {
+		return invalidIndex(idx), ""
+	}
+	return l.String(attr.KeyStrindex()), FormatAttributeValue(attr, l.dict.StringTable(), max)
+}
+
+func invalidIndex(idx int32) string {
+	return fmt.Sprintf("<invalid index %d>", idx)
+}
+
+// CorruptionReport counts the invalid references into the dictionary tables of a request.
+// The nil report records nothing.
+type CorruptionReport struct {
+	// Invalid maps the table to the number of invalid references into it, First to the first
+	// invalid index.
+	Invalid map[string]int
+	First   map[string]int32
+}
+
+func (r *CorruptionReport) record(table string, idx int32) {
+	if r == nil {
+		return
+	}
+	if r.Invalid == nil {
+		r.Invalid = map[string]int{}
+		r.First = map[string]int32{}
+	}
+	if r.Invalid[table] == 0 {
+		r.First[table] = idx
+	}
+	r.Invalid[table]++
+}
+
+// Empty returns whether no invalid reference was recorded.
+func (r *CorruptionReport) Empty() bool {
+	return r == nil || len(r.Invalid) == 0
+}
+
+// String formats the report on a single line, ordered by table.
+func (r *CorruptionReport) String() string {
+	if r.Empty() {
+		return "no invalid references"
+	}
+	var parts []string
+	for _, table := range slices.Sorted(maps.Keys(r.Invalid)) {
+		parts = append(parts, fmt.Sprintf("%s: %d (first index %d)", table, r.Invalid[table], r.First[table]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// CheckReferences resolves every dictionary reference of the request and returns the invalid
+// ones.
+func CheckReferences(pd pprofile.Profiles) *CorruptionReport {
+	l := NewLookup(pd.Dictionary())
+	dict := pd.Dictionary()
+
+	checkAttributes := func(indices pcommon.Int32Slice) {
+		for _, idx := range indices.All() {
+			l.Attribute(idx)
+		}
+	}
+
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		sps := rps.At(i).ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			pcs := sps.At(j).Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				profile := pcs.At(k)
+				l.String(profile.SampleType().TypeStrindex())
+				l.String(profile.SampleType().UnitStrindex())
+				l.String(profile.PeriodType().TypeStrindex())
+				l.String(profile.PeriodType().UnitStrindex())
+				checkAttributes(profile.AttributeIndices())
+				for _, sample := range profile.Samples().All() {
+					l.Stack(sample.StackIndex())
+					l.Link(sample.LinkIndex())
+					checkAttributes(sample.AttributeIndices())
+				}
+			}
+		}
+	}
+
+	for _, stack := range dict.StackTable().All() {
+		for _, idx := range stack.LocationIndices().All() {
+			l.Location(idx)
+		}
+	}
+	for _, location := range dict.LocationTable().All() {
+		l.Mapping(location.MappingIndex())
+		checkAttributes(location.AttributeIndices())
+		for _, line := range location.Lines().All() {
+			l.Function(line.FunctionIndex())
+		}
+	}
+	for _, function := range dict.FunctionTable().All() {
+		l.String(function.NameStrindex())
+		l.String(function.SystemNameStrindex())
+		l.String(function.FilenameStrindex())
+	}
+	for _, mapping := range dict.MappingTable().All() {
+		l.String(mapping.FilenameStrindex())
+		checkAttributes(mapping.AttributeIndices())
+	}
+	for _, attr := range dict.AttributeTable().All() {
+		l.String(attr.KeyStrindex())
+		l.String(attr.UnitStrindex())
+	}
+	return l.Report()
+}
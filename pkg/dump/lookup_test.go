@@ -0,0 +1,131 @@
+package dump
+
+import (
+	"maps"
+	"testing"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+func TestLookup(t *testing.T) {
+	dict := testRequest(1, 2).Dictionary()
+	strings := int32(dict.StringTable().Len())
+
+	tests := []struct {
+		name    string
+		resolve func(l Lookup) bool
+		want    bool
+		table   string
+	}{
+		{"string", func(l Lookup) bool { return l.String(1) == "events" }, true, ""},
+		{"string past the end", func(l Lookup) bool { return l.String(strings) != invalidIndex(strings) }, false, "string"},
+		{"negative string", func(l Lookup) bool { return l.String(-1) != invalidIndex(-1) }, false, "string"},
+		{"attribute", func(l Lookup) bool { _, ok := l.Attribute(1); return ok }, true, ""},
+		{"attribute past the end", func(l Lookup) bool { _, ok := l.Attribute(1000); return ok }, false, "attribute"},
+		{"stack", func(l Lookup) bool { _, ok := l.Stack(1); return ok }, true, ""},
+		{"negative stack", func(l Lookup) bool { _, ok := l.Stack(-5); return ok }, false, "stack"},
+		{"location", func(l Lookup) bool { _, ok := l.Location(1); return ok }, true, ""},
+		{"location past the end", func(l Lookup) bool { _, ok := l.Location(1000); return ok }, false, "location"},
+		{"function past the end", func(l Lookup) bool { _, ok := l.Function(1000); return ok }, false, "function"},
+		{"no mapping", func(l Lookup) bool { _, ok := l.Mapping(0); return ok }, false, ""},
+		{"mapping past the end", func(l Lookup) bool { _, ok := l.Mapping(1000); return ok }, false, "mapping"},
+		{"no link", func(l Lookup) bool { _, ok := l.Link(0); return ok }, false, ""},
+		{"negative link", func(l Lookup) bool { _, ok := l.Link(-1); return ok }, false, "link"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLookup(dict)
+			if got := tt.resolve(l); got != tt.want {
+				t.Errorf("found = %v, want %v", got, tt.want)
+			}
+			want := map[string]int{}
+			if tt.table != "" {
+				want[tt.table] = 1
+			}
+			if got := l.Report().Invalid; !maps.Equal(got, want) {
+				t.Errorf("report = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCheckReferences(t *testing.T) {
+	profile := func(pd pprofile.Profiles) pprofile.Profile {
+		return pd.ResourceProfiles().At(0).ScopeProfiles().At(0).Profiles().At(0)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(pd pprofile.Profiles)
+		want   map[string]int
+		first  map[string]int32
+	}{
+		{
+			name:   "valid",
+			modify: func(pprofile.Profiles) {},
+		},
+		{
+			name: "stack past the end",
+			modify: func(pd pprofile.Profiles) {
+				profile(pd).Samples().At(0).SetStackIndex(1000)
+			},
+			want:  map[string]int{"stack": 1},
+			first: map[string]int32{"stack": 1000},
+		},
+		{
+			name: "negative sample type",
+			modify: func(pd pprofile.Profiles) {
+				profile(pd).SampleType().SetTypeStrindex(-1)
+			},
+			want:  map[string]int{"string": 1},
+			first: map[string]int32{"string": -1},
+		},
+		{
+			name: "location and mapping past the end",
+			modify: func(pd pprofile.Profiles) {
+				dict := pd.Dictionary()
+				dict.StackTable().At(1).LocationIndices().Append(1000, 1001)
+				dict.LocationTable().At(1).SetMappingIndex(1000)
+			},
+			want:  map[string]int{"location": 2, "mapping": 1},
+			first: map[string]int32{"location": 1000, "mapping": 1000},
+		},
+		{
+			name: "attribute key past the end",
+			modify: func(pd pprofile.Profiles) {
+				pd.Dictionary().AttributeTable().At(1).SetKeyStrindex(1000)
+			},
+			want:  map[string]int{"string": 1},
+			first: map[string]int32{"string": 1000},
+		},
+		{
+			name: "empty dictionary",
+			modify: func(pd pprofile.Profiles) {
+				pprofile.NewProfilesDictionary().CopyTo(pd.Dictionary())
+			},
+			// The sample and period type of the profile, and the stack and thread.name
+			// attribute of every sample.
+			want:  map[string]int{"string": 4, "stack": 3, "attribute": 3},
+			first: map[string]int32{"string": 1, "stack": 1, "attribute": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pd := testRequest(3, 4)
+			tt.modify(pd)
+			report := CheckReferences(pd)
+			if report.Empty() != (len(tt.want) == 0) {
+				t.Fatalf("Empty() = %v for %s", report.Empty(), report)
+			}
+			if len(tt.want) == 0 {
+				return
+			}
+			if !maps.Equal(report.Invalid, tt.want) {
+				t.Errorf("Invalid = %v, want %v", report.Invalid, tt.want)
+			}
+			if !maps.Equal(report.First, tt.first) {
+				t.Errorf("First = %v, want %v", report.First, tt.first)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package dump
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// blockingLeafFrames is the number of leaf frames listed for off-CPU and wall-clock profiles.
+const blockingLeafFrames = 10
+
+// IsOffCPUSampleType returns whether the sample type is measured in elapsed time rather than
+// in CPU time or events, like off_cpu or wall.
+func IsOffCPUSampleType(sampleType string) bool {
+	switch strings.NewReplacer("-", "", "_", "", " ", "").Replace(strings.ToLower(sampleType)) {
+	case "offcpu", "offcputime", "wall", "walltime", "wallclock", "blocked", "blocking":
+		return true
+	}
+	return false
+}
+
+// timeUnit returns the duration of one unit of a time unit.
+func timeUnit(unit string) (time.Duration, bool) {
+	switch strings.ToLower(unit) {
+	case "nanoseconds", "nanosecond", "ns":
+		return time.Nanosecond, true
+	case "microseconds", "microsecond", "us":
+		return time.Microsecond, true
+	case "milliseconds", "millisecond", "ms":
+		return time.Millisecond, true
+	case "seconds", "second", "s":
+		return time.Second, true
+	}
+	return 0, false
+}
+
+// SampleDuration returns the converter of the sample values of an off-CPU or wall-clock
+// profile into durations, or nil for other profiles. Values in a time unit are converted
+// directly, counts are multiplied by the period if the period has a time unit.
+func SampleDuration(lookup Lookup, profile pprofile.Profile) func(int64) time.Duration {
+	if !IsOffCPUSampleType(lookup.String(profile.SampleType().TypeStrindex())) {
+		return nil
+	}
+	if unit, ok := timeUnit(lookup.String(profile.SampleType().UnitStrindex())); ok {
+		return func(v int64) time.Duration { return time.Duration(v) * unit }
+	}
+	unit, ok := timeUnit(lookup.String(profile.PeriodType().UnitStrindex()))
+	if !ok || profile.Period() <= 0 {
+		return nil
+	}
+	period := time.Duration(profile.Period()) * unit
+	return func(v int64) time.Duration { return time.Duration(v) * period }
+}
+
+// dumpBlockingFrames dumps the total duration per leaf frame of an off-CPU or wall-clock
+// profile, which is where the threads were blocked.
+func dumpBlockingFrames(log lineLogger, config Config, lookup Lookup, profile pprofile.Profile, duration func(int64) time.Duration) {
+	leaves, names, total := blockingFrames(config, lookup, profile)
+	if len(leaves) == 0 {
+		return
+	}
+
+	log.Info(fmt.Sprintf("  Blocking leaf frames (total %s):", duration(total)))
+	for _, name := range names[:min(len(names), blockingLeafFrames)] {
+		log.Info(fmt.Sprintf("    %s (%.1f%%): %s", duration(leaves[name]), percent(int(leaves[name]), int(total)), name))
+	}
+	if len(names) > blockingLeafFrames {
+		log.Info(fmt.Sprintf("    ... %d more frames", len(names)-blockingLeafFrames))
+	}
+	log.Info("~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~")
+}
+
+// blockingFrames sums up the sample values of a profile per leaf frame. It returns the leaf
+// frame names ordered by value, largest first, and the total of all values.
+func blockingFrames(config Config, lookup Lookup, profile pprofile.Profile) (map[string]int64, []string, int64) {
+	leaves := map[string]int64{}
+	var total int64
+	for _, sample := range profile.Samples().All() {
+		if !includeSample(config, lookup.dict, sample) {
+			continue
+		}
+		leaf := "<no frames>"
+		if stack, ok := lookup.Stack(sample.StackIndex()); ok && stack.LocationIndices().Len() > 0 {
+			leaf = "<invalid location>"
+			if location, ok := lookup.Location(stack.LocationIndices().At(0)); ok {
+				leaf = frameName(lookup, location)
+			}
+		}
+		for _, v := range sample.Values().All() {
+			leaves[leaf] += v
+			total += v
+		}
+	}
+
+	names := make([]string, 0, len(leaves))
+	for name := range leaves {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(cmp.Compare(leaves[b], leaves[a]), cmp.Compare(a, b))
+	})
+	return leaves, names, total
+}
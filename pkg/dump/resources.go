@@ -0,0 +1,61 @@
+package dump
+
+import (
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"slices"
+	"sync"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+)
+
+// maxCachedResources bounds the number of attribute sets a ResourceCache remembers. Once it's
+// full it starts over, so senders with ever changing attributes don't grow it indefinitely.
+const maxCachedResources = 10000
+
+// Fingerprint returns a short stable identifier of a resource, derived from its attributes
+// independent of their order.
+func Fingerprint(attrs pcommon.Map) string {
+	h := fnv.New64a()
+	raw := attrs.AsRaw()
+	for _, k := range slices.Sorted(maps.Keys(raw)) {
+		fmt.Fprintf(h, "%s=%v\x00", k, raw[k])
+	}
+	return fmt.Sprintf("%08x", h.Sum64()>>32)
+}
+
+// ResourceCache remembers the fingerprints of the resources seen so far, to print the
+// attributes of a resource only the first time and its fingerprint afterwards.
+type ResourceCache struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// NewResourceCache returns an empty ResourceCache.
+func NewResourceCache() *ResourceCache {
+	return &ResourceCache{seen: map[string]bool{}}
+}
+
+// See returns the fingerprint of the resource and whether it was seen before.
+func (c *ResourceCache) See(attrs pcommon.Map) (fingerprint string, seen bool) {
+	fingerprint = Fingerprint(attrs)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.seen[fingerprint] {
+		return fingerprint, true
+	}
+	if len(c.seen) >= maxCachedResources {
+		clear(c.seen)
+	}
+	c.seen[fingerprint] = true
+	return fingerprint, false
+}
+
+// Len returns the number of resources remembered.
+func (c *ResourceCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.seen)
+}
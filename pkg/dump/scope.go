@@ -0,0 +1,37 @@
+package dump
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ValidateScopePatterns returns an error for the first malformed FilterScopeNames pattern.
+func ValidateScopePatterns(patterns []string) error {
+	for _, p := range patterns {
+		if _, err := path.Match(strings.TrimPrefix(p, "!"), ""); err != nil {
+			return fmt.Errorf("invalid scope name pattern %q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// IncludeScope returns whether the instrumentation scope passes the scope name filter. A
+// scope is excluded if it matches any pattern prefixed with !, and, if there are other
+// patterns, included only if it matches one of them.
+func IncludeScope(config Config, name string) bool {
+	included, hasIncludes := false, false
+	for _, p := range config.FilterScopeNames {
+		if exclude, ok := strings.CutPrefix(p, "!"); ok {
+			if matched, _ := path.Match(exclude, name); matched {
+				return false
+			}
+			continue
+		}
+		hasIncludes = true
+		if matched, _ := path.Match(p, name); matched {
+			included = true
+		}
+	}
+	return included || !hasIncludes
+}
@@ -0,0 +1,83 @@
+package dump
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// StringTableReport describes the problems of the string table of a request.
+type StringTableReport struct {
+	// Zero is the entry at index 0, which must be the empty string. ZeroInvalid is set if it
+	// isn't, or if the table is empty.
+	Zero        string
+	ZeroInvalid bool
+	// Duplicates is the number of entries repeating an earlier one, DuplicateBytes their size
+	// and FirstDuplicate the first of them.
+	Duplicates     int
+	DuplicateBytes int
+	FirstDuplicate string
+	// InvalidUTF8 is the number of entries that aren't valid UTF-8, FirstInvalidUTF8 the index
+	// of the first of them.
+	InvalidUTF8      int
+	FirstInvalidUTF8 int
+}
+
+// CheckStringTable checks that the string table of a request starts with the empty string and
+// has neither duplicate entries nor entries that aren't valid UTF-8.
+func CheckStringTable(dict pprofile.ProfilesDictionary) StringTableReport {
+	var r StringTableReport
+	table := dict.StringTable()
+	if table.Len() == 0 {
+		r.ZeroInvalid = true
+		return r
+	}
+	if r.Zero = table.At(0); r.Zero != "" {
+		r.ZeroInvalid = true
+	}
+
+	seen := make(map[string]struct{}, table.Len())
+	for i, s := range table.All() {
+		if _, ok := seen[s]; ok {
+			if r.Duplicates == 0 {
+				r.FirstDuplicate = s
+			}
+			r.Duplicates++
+			r.DuplicateBytes += len(s)
+		}
+		seen[s] = struct{}{}
+		if !utf8.ValidString(s) {
+			if r.InvalidUTF8 == 0 {
+				r.FirstInvalidUTF8 = i
+			}
+			r.InvalidUTF8++
+		}
+	}
+	return r
+}
+
+// Empty returns whether no problem was found.
+func (r StringTableReport) Empty() bool {
+	return !r.ZeroInvalid && r.Duplicates == 0 && r.InvalidUTF8 == 0
+}
+
+// String formats the report on a single line.
+func (r StringTableReport) String() string {
+	if r.Empty() {
+		return "no string table issues"
+	}
+	var parts []string
+	if r.ZeroInvalid {
+		parts = append(parts, fmt.Sprintf("entry 0 is %q instead of empty", r.Zero))
+	}
+	if r.Duplicates > 0 {
+		parts = append(parts, fmt.Sprintf("%d duplicate strings (%d bytes, first %q)",
+			r.Duplicates, r.DuplicateBytes, Truncate(r.FirstDuplicate, 64)))
+	}
+	if r.InvalidUTF8 > 0 {
+		parts = append(parts, fmt.Sprintf("%d strings with invalid UTF-8 (first at index %d)", r.InvalidUTF8, r.FirstInvalidUTF8))
+	}
+	return strings.Join(parts, ", ")
+}
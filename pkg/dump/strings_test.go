@@ -0,0 +1,62 @@
+package dump
+
+import (
+	"testing"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+func TestCheckStringTable(t *testing.T) {
+	tests := []struct {
+		name    string
+		strings []string
+		want    StringTableReport
+	}{
+		{
+			name:    "valid",
+			strings: []string{"", "events", "count"},
+		},
+		{
+			name: "empty table",
+			want: StringTableReport{ZeroInvalid: true},
+		},
+		{
+			name:    "non-empty entry 0",
+			strings: []string{"events", "count"},
+			want:    StringTableReport{Zero: "events", ZeroInvalid: true},
+		},
+		{
+			name:    "duplicates",
+			strings: []string{"", "main", "count", "main", "main", "count"},
+			want:    StringTableReport{Duplicates: 3, DuplicateBytes: 13, FirstDuplicate: "main"},
+		},
+		{
+			name:    "duplicate empty string",
+			strings: []string{"", "main", ""},
+			want:    StringTableReport{Duplicates: 1, FirstDuplicate: ""},
+		},
+		{
+			name:    "invalid UTF-8",
+			strings: []string{"", "main", "\xff", "ok", "\xc3("},
+			want:    StringTableReport{InvalidUTF8: 2, FirstInvalidUTF8: 2},
+		},
+		{
+			name:    "invalid UTF-8 entry 0",
+			strings: []string{"\xff"},
+			want:    StringTableReport{Zero: "\xff", ZeroInvalid: true, InvalidUTF8: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dict := pprofile.NewProfilesDictionary()
+			dict.StringTable().Append(tt.strings...)
+			got := CheckStringTable(dict)
+			if got != tt.want {
+				t.Errorf("CheckStringTable() = %+v, want %+v", got, tt.want)
+			}
+			if got.Empty() != (tt.want == StringTableReport{}) {
+				t.Errorf("Empty() = %v for %s", got.Empty(), got)
+			}
+		})
+	}
+}
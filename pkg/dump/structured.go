@@ -0,0 +1,333 @@
+package dump
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// isPlain returns whether log writes the lines of the plain dump. Other handlers, like the slog
+// text and JSON handlers, get a record per profile and sample with the fields as attributes.
+func isPlain(log *slog.Logger) bool {
+	_, ok := log.Handler().(*PlainHandler)
+	return ok
+}
+
+// structuredResourceProfile logs a resource profile as records: one per profile, per
+// implausible value, per thread with ThreadTopStacks, per process with GroupByProcess and per
+// sample. Every record carries the profile ID, profile records the resource and scope.
+func structuredResourceProfile(log *slog.Logger, config Config, dict pprofile.ProfilesDictionary, rp pprofile.ResourceProfiles) {
+	ctx := context.Background()
+	resourceAttrs := rp.Resource().Attributes()
+	if !IncludeResource(config, resourceAttrs) {
+		return
+	}
+
+	var resource []slog.Attr
+	if config.ExportResourceAttributes {
+		resource = structuredResource(config, resourceAttrs)
+	}
+	if config.IgnoreProfilesWithoutContainerID {
+		containerID, ok := resourceAttrs.Get("container.id")
+		if !ok || containerID.AsString() == "" {
+			log.LogAttrs(ctx, slog.LevelWarn, "skipped resource profile without container.id", resource...)
+			return
+		}
+	}
+	if rp.SchemaUrl() != "" {
+		resource = append(resource, slog.String("schema_url", rp.SchemaUrl()))
+	}
+	if dropped := rp.Resource().DroppedAttributesCount(); dropped > 0 {
+		resource = append(resource, slog.Int("resource_dropped_attributes_count", int(dropped)))
+	}
+
+	d := &structuredDumper{
+		log:       log,
+		config:    config,
+		lookup:    NewLookup(dict),
+		locations: make([][]frame, dict.LocationTable().Len()),
+	}
+	for _, sp := range rp.ScopeProfiles().All() {
+		if !IncludeScope(config, sp.Scope().Name()) {
+			continue
+		}
+		scope := []slog.Attr{slog.String("name", sp.Scope().Name())}
+		if sp.Scope().Version() != "" {
+			scope = append(scope, slog.String("version", sp.Scope().Version()))
+		}
+		if sp.SchemaUrl() != "" {
+			scope = append(scope, slog.String("schema_url", sp.SchemaUrl()))
+		}
+		if dropped := sp.Scope().DroppedAttributesCount(); dropped > 0 {
+			scope = append(scope, slog.Int("dropped_attributes_count", int(dropped)))
+		}
+
+		for _, profile := range sp.Profiles().All() {
+			sampleType := d.lookup.String(profile.SampleType().TypeStrindex())
+			if len(config.FilterSampleTypes) > 0 && !slices.Contains(config.FilterSampleTypes, sampleType) {
+				continue
+			}
+			attrs := append(slices.Clone(resource), slog.GroupAttrs("scope", scope...))
+			d.profile(ctx, attrs, rp, profile)
+		}
+	}
+}
+
+// structuredResource returns the resource attributes, or only the fingerprint of a resource
+// already dumped if Resources is set.
+func structuredResource(config Config, attrs pcommon.Map) []slog.Attr {
+	var out []slog.Attr
+	if config.Resources != nil && attrs.Len() > 0 {
+		fingerprint, seen := config.Resources.See(attrs)
+		out = append(out, slog.String("resource_fingerprint", fingerprint))
+		if seen {
+			return out
+		}
+	}
+	resource := make([]slog.Attr, 0, attrs.Len())
+	for k, v := range attrs.All() {
+		resource = append(resource, slog.String(k, Truncate(v.AsString(), config.MaxAttributeLength)))
+	}
+	return append(out, slog.GroupAttrs("resource", resource...))
+}
+
+// structuredDumper logs the profiles of a resource. It caches the frames of every location,
+// as the same locations show up in many stacks.
+type structuredDumper struct {
+	log       *slog.Logger
+	config    Config
+	lookup    Lookup
+	locations [][]frame
+}
+
+func (d *structuredDumper) profile(ctx context.Context, attrs []slog.Attr, rp pprofile.ResourceProfiles, profile pprofile.Profile) {
+	log, config, lookup := d.log, d.config, d.lookup
+	id := slog.String("profile_id", profile.ProfileID().String())
+
+	attrs = append([]slog.Attr{id}, attrs...)
+	attrs = append(attrs,
+		slog.Time("profile_time", profile.Time().AsTime()),
+		slog.Duration("duration", time.Duration(profile.DurationNano())),
+		slog.String("sample_type", lookup.String(profile.SampleType().TypeStrindex())),
+		slog.String("sample_unit", lookup.String(profile.SampleType().UnitStrindex())),
+		slog.String("period_type", lookup.String(profile.PeriodType().TypeStrindex())),
+		slog.String("period_unit", lookup.String(profile.PeriodType().UnitStrindex())),
+		slog.Int64("period", profile.Period()),
+		slog.Int("samples", profile.Samples().Len()),
+	)
+	if dropped := profile.DroppedAttributesCount(); dropped > 0 {
+		attrs = append(attrs, slog.Int("dropped_attributes_count", int(dropped)))
+	}
+	if profileAttrs := d.attributes(profile.AttributeIndices()); len(profileAttrs) > 0 {
+		attrs = append(attrs, slog.GroupAttrs("attributes", profileAttrs...))
+	}
+	if config.ExportFrameTypeHistogram {
+		attrs = append(attrs, slog.GroupAttrs("frame_types", CountFrames(lookup.dict, profile).attrs()...))
+	}
+	if config.SplitKernelFrames {
+		attrs = append(attrs, slog.GroupAttrs("kernel", CountKernel(lookup.dict, profile).attrs()...))
+	}
+	format := ValueFormatter(lookup, profile)
+	if format != nil {
+		total, _ := sumSamples(config, lookup, profile)
+		attrs = append(attrs, slog.String("total", format(total)))
+	}
+	if duration := SampleDuration(lookup, profile); duration != nil {
+		if leaves, names, total := blockingFrames(config, lookup, profile); len(leaves) > 0 {
+			blocking := make([]string, 0, blockingLeafFrames)
+			for _, name := range names[:min(len(names), blockingLeafFrames)] {
+				blocking = append(blocking, fmt.Sprintf("%s (%.1f%%): %s", duration(leaves[name]), percent(int(leaves[name]), int(total)), name))
+			}
+			attrs = append(attrs, slog.Any("blocking_frames", blocking))
+		}
+	}
+	log.LogAttrs(ctx, slog.LevelInfo, "profile", attrs...)
+
+	for _, issue := range CheckValues(lookup, profile) {
+		log.LogAttrs(ctx, slog.LevelWarn, "implausible value", id, slog.String("issue", issue))
+	}
+
+	if config.ThreadTopStacks > 0 {
+		for _, t := range summarizeThreads(config, lookup.dict, profile) {
+			var stacks []string
+			for _, idx := range t.topStacks(config.ThreadTopStacks) {
+				stacks = append(stacks, fmt.Sprintf("%d: %s", t.stacks[idx], stackString(config, lookup.dict, idx)))
+			}
+			log.LogAttrs(ctx, slog.LevelInfo, "thread", id, slog.String("thread", t.name),
+				slog.Int("samples", t.samples), slog.Int64("value", t.value), slog.Any("top_stacks", stacks))
+		}
+	}
+
+	if config.GroupByProcess {
+		for _, group := range groupByProcess(config, lookup.dict, rp, profile.Samples()) {
+			process := slog.GroupAttrs("process",
+				slog.String("executable_name", group.executableName), slog.String("pid", group.pid))
+			log.LogAttrs(ctx, slog.LevelInfo, "process", id, process,
+				slog.Int("samples", len(group.samples)), slog.Int64("value", group.value))
+			for _, sample := range group.samples {
+				d.sample(ctx, format, sample, id, process)
+			}
+		}
+		return
+	}
+	for i, sample := range profile.Samples().All() {
+		if includeSample(config, lookup.dict, sample) {
+			d.sample(ctx, format, sample, id, slog.Int("sample", i))
+		}
+	}
+}
+
+func (d *structuredDumper) sample(ctx context.Context, format func(int64) string, sample pprofile.Sample, attrs ...slog.Attr) {
+	config, lookup := d.config, d.lookup
+
+	if sample.TimestampsUnixNano().Len() > 0 {
+		timestamps := make([]time.Time, 0, sample.TimestampsUnixNano().Len())
+		for _, ts := range sample.TimestampsUnixNano().All() {
+			timestamps = append(timestamps, time.Unix(0, int64(ts)))
+		}
+		attrs = append(attrs, slog.Any("timestamps", timestamps))
+	}
+	if sample.Values().Len() > 0 {
+		attrs = append(attrs, slog.Any("values", sample.Values().AsRaw()))
+		if format != nil {
+			attrs = append(attrs, slog.String("formatted_values", formatValues(sample.Values().AsRaw(), format)))
+		}
+	}
+	if link, ok := lookup.Link(sample.LinkIndex()); ok {
+		attrs = append(attrs, slog.String("trace_id", link.TraceID().String()), slog.String("span_id", link.SpanID().String()))
+	}
+	if config.ExportSampleAttributes {
+		if sampleAttrs := d.attributes(sample.AttributeIndices()); len(sampleAttrs) > 0 {
+			attrs = append(attrs, slog.GroupAttrs("attributes", sampleAttrs...))
+		}
+	}
+
+	stack, ok := lookup.Stack(sample.StackIndex())
+	if !ok {
+		attrs = append(attrs, slog.String("stack", invalidIndex(sample.StackIndex())))
+	}
+	if ok && config.ExportStackFrames {
+		var stackFrames frames
+		indices := stack.LocationIndices()
+		for m, idx := range indices.All() {
+			if config.MaxStackDepth > 0 && m >= config.MaxStackDepth {
+				attrs = append(attrs, slog.Int("more_frames", indices.Len()-m))
+				break
+			}
+			for _, f := range d.location(idx) {
+				if len(config.ExportStackFrameTypes) == 0 || slices.Contains(config.ExportStackFrameTypes, f.Type) {
+					stackFrames = append(stackFrames, f)
+				}
+			}
+		}
+		attrs = append(attrs, slog.Any("frames", stackFrames))
+	}
+	d.log.LogAttrs(ctx, slog.LevelInfo, "sample", attrs...)
+}
+
+// attributes resolves the attributes at the given indices.
+func (d *structuredDumper) attributes(indices pcommon.Int32Slice) []slog.Attr {
+	attrs := make([]slog.Attr, 0, indices.Len())
+	for _, idx := range indices.All() {
+		key, value := d.lookup.KeyValue(idx, d.config.MaxAttributeLength)
+		attrs = append(attrs, slog.String(key, value))
+	}
+	return attrs
+}
+
+// location returns the frames of a location, one per line.
+func (d *structuredDumper) location(idx int32) []frame {
+	location, ok := d.lookup.Location(idx)
+	if !ok {
+		return []frame{{Type: "unknown", Function: invalidIndex(idx)}}
+	}
+	if d.locations[idx] != nil {
+		return d.locations[idx]
+	}
+
+	lookup := d.lookup
+	base := frame{
+		Type:   FrameType(lookup.dict, location),
+		Kernel: d.config.SplitKernelFrames && IsKernelFrame(lookup, location),
+	}
+	if d.config.ExportLocationAttributes {
+		for _, attrIdx := range location.AttributeIndices().All() {
+			key, value := lookup.KeyValue(attrIdx, d.config.MaxAttributeLength)
+			if key == "profile.frame.type" {
+				continue
+			}
+			if base.Attributes == nil {
+				base.Attributes = map[string]string{}
+			}
+			base.Attributes[key] = value
+		}
+	}
+
+	lines := location.Lines()
+	if lines.Len() == 0 {
+		base.Address = location.Address()
+		base.Mapping = lookup.MappingFile(location.MappingIndex())
+		d.locations[idx] = []frame{base}
+		return d.locations[idx]
+	}
+	// Lines are ordered from the innermost inlined function outwards, all but the last one
+	// were inlined into it.
+	out := make([]frame, 0, lines.Len())
+	for n, line := range lines.All() {
+		f := base
+		f.Function = invalidIndex(line.FunctionIndex())
+		if function, ok := lookup.Function(line.FunctionIndex()); ok {
+			f.Function = lookup.String(function.NameStrindex())
+			f.File = lookup.String(function.FilenameStrindex())
+		}
+		f.Line = line.Line()
+		f.Column = line.Column()
+		f.Inlined = n < lines.Len()-1
+		out = append(out, f)
+	}
+	d.locations[idx] = out
+	return out
+}
+
+// frame is a stack frame of the structured dump.
+type frame struct {
+	Type     string `json:"type"`
+	Function string `json:"function,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int64  `json:"line,omitempty"`
+	Column   int64  `json:"column,omitempty"`
+	// Address and Mapping are set for frames without line information.
+	Address uint64 `json:"address,omitempty"`
+	Mapping string `json:"mapping,omitempty"`
+	Inlined bool   `json:"inlined,omitempty"`
+	// Kernel is set for kernel frames with SplitKernelFrames.
+	Kernel     bool              `json:"kernel,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// frames is a stack, leaf first. The JSON handler logs it as an array of frames, the text
+// handler on a single line like stackString.
+type frames []frame
+
+func (f frames) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]frame(f))
+}
+
+func (f frames) MarshalText() ([]byte, error) {
+	names := make([]string, 0, len(f))
+	for _, frame := range f {
+		if frame.Function == "" {
+			names = append(names, fmt.Sprintf("%#x@%s", frame.Address, frame.Mapping))
+			continue
+		}
+		names = append(names, frame.Function)
+	}
+	return []byte(strings.Join(names, " <- ")), nil
+}
@@ -0,0 +1,77 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestStructured(t *testing.T) {
+	pd := testRequest(3, 4)
+	profile := pd.ResourceProfiles().At(0).ScopeProfiles().At(0).Profiles().At(0)
+	profile.SetDurationNano(^uint64(0))
+
+	var out bytes.Buffer
+	log := slog.New(slog.NewJSONHandler(&out, nil))
+	Profiles(log, Config{
+		ExportResourceAttributes: true,
+		ExportSampleAttributes:   true,
+		ExportStackFrames:        true,
+		ExportFrameTypeHistogram: true,
+		ExportDictionaryStats:    true,
+		ThreadTopStacks:          1,
+	}, pd)
+
+	records := map[string][]map[string]any{}
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var record map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid record %q: %v", scanner.Text(), err)
+		}
+		msg := record["msg"].(string)
+		records[msg] = append(records[msg], record)
+	}
+
+	counts := map[string]int{"dictionary": 1, "profile": 1, "implausible value": 1, "thread": 3, "sample": 3}
+	for msg, want := range counts {
+		if got := len(records[msg]); got != want {
+			t.Errorf("%d %q records, want %d", got, msg, want)
+		}
+	}
+	if len(records["profile"]) == 0 || len(records["sample"]) == 0 || len(records["implausible value"]) == 0 {
+		t.FailNow()
+	}
+
+	p := records["profile"][0]
+	if p["profile_id"] != "01020304000000000000000000000000" || p["sample_type"] != "events" {
+		t.Errorf("profile record = %v", p)
+	}
+	if resource, _ := p["resource"].(map[string]any); resource["container.id"] != "0123456789abcdef" {
+		t.Errorf("profile resource = %v", p["resource"])
+	}
+	if frameTypes, _ := p["frame_types"].(map[string]any); frameTypes["total"] != float64(12) {
+		t.Errorf("profile frame types = %v", p["frame_types"])
+	}
+	if issue, _ := records["implausible value"][0]["issue"].(string); !strings.HasPrefix(issue, "negative duration") {
+		t.Errorf("implausible value issue = %q", issue)
+	}
+
+	s := records["sample"][0]
+	if attrs, _ := s["attributes"].(map[string]any); attrs["thread.name"] != "thread-0" {
+		t.Errorf("sample attributes = %v", s["attributes"])
+	}
+	frames, _ := s["frames"].([]any)
+	if len(frames) != 4 {
+		t.Fatalf("sample frames = %v, want 4", s["frames"])
+	}
+	if f := frames[0].(map[string]any); f["type"] != "kernel" || f["mapping"] != "/usr/lib/libtest.so" {
+		t.Errorf("first frame = %v", f)
+	}
+	if f := frames[3].(map[string]any); f["function"] != "python_func_3_0" || f["line"] != float64(13) {
+		t.Errorf("last frame = %v", f)
+	}
+}
@@ -0,0 +1,125 @@
+package dump
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// threadSummary aggregates the samples of a thread.
+type threadSummary struct {
+	name    string
+	samples int
+	value   int64
+	// stacks maps the stack index to the summed value of its samples.
+	stacks map[int32]int64
+}
+
+// dumpThreads dumps the sample count, value and top stacks per thread.name of the profile.
+func dumpThreads(log lineLogger, config Config, dict pprofile.ProfilesDictionary, profile pprofile.Profile) {
+	log.Info("  Threads:")
+	for _, t := range summarizeThreads(config, dict, profile) {
+		log.Info(fmt.Sprintf("    %s: Samples: %d, Value: %d", t.name, t.samples, t.value))
+		for _, idx := range t.topStacks(config.ThreadTopStacks) {
+			log.Info(fmt.Sprintf("      %d: %s", t.stacks[idx], stackString(config, dict, idx)))
+		}
+	}
+	log.Info("~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~~")
+}
+
+// summarizeThreads aggregates the samples of the profile passing the filters by thread.name.
+// Threads are ordered by value, largest first.
+func summarizeThreads(config Config, dict pprofile.ProfilesDictionary, profile pprofile.Profile) []*threadSummary {
+	threads := map[string]*threadSummary{}
+	samples := profile.Samples()
+	for i := 0; i < samples.Len(); i++ {
+		sample := samples.At(i)
+		if !includeSample(config, dict, sample) {
+			continue
+		}
+		name := AttributeValue(sample.AttributeIndices(), dict.AttributeTable(), dict.StringTable(), "thread.name")
+		if name == "" {
+			name = "<unknown>"
+		}
+		t, ok := threads[name]
+		if !ok {
+			t = &threadSummary{name: name, stacks: map[int32]int64{}}
+			threads[name] = t
+		}
+		var value int64
+		for _, v := range sample.Values().All() {
+			value += v
+		}
+		t.samples++
+		t.value += value
+		t.stacks[sample.StackIndex()] += value
+	}
+
+	sorted := make([]*threadSummary, 0, len(threads))
+	for _, t := range threads {
+		sorted = append(sorted, t)
+	}
+	slices.SortFunc(sorted, func(a, b *threadSummary) int {
+		return cmp.Or(cmp.Compare(b.value, a.value), cmp.Compare(a.name, b.name))
+	})
+	return sorted
+}
+
+// topStacks returns the indices of the n stacks of the thread with the largest values.
+func (t *threadSummary) topStacks(n int) []int32 {
+	stacks := make([]int32, 0, len(t.stacks))
+	for idx := range t.stacks {
+		stacks = append(stacks, idx)
+	}
+	slices.SortFunc(stacks, func(a, b int32) int {
+		return cmp.Or(cmp.Compare(t.stacks[b], t.stacks[a]), cmp.Compare(a, b))
+	})
+	return stacks[:min(len(stacks), n)]
+}
+
+// stackString formats a stack on a single line, leaf first.
+func stackString(config Config, dict pprofile.ProfilesDictionary, stackIdx int32) string {
+	lookup := NewLookup(dict)
+	stack, ok := lookup.Stack(stackIdx)
+	if !ok {
+		return "<invalid stack>"
+	}
+	indices := stack.LocationIndices()
+
+	var frames []string
+	for m, idx := range indices.All() {
+		if config.MaxStackDepth > 0 && m >= config.MaxStackDepth {
+			frames = append(frames, fmt.Sprintf("... %d more", indices.Len()-m))
+			break
+		}
+		location, ok := lookup.Location(idx)
+		if !ok {
+			frames = append(frames, "<invalid location>")
+			continue
+		}
+		frames = append(frames, frameName(lookup, location))
+	}
+	return strings.Join(frames, " <- ")
+}
+
+// frameName returns the function names of the location, or its address and mapping file if
+// it's not symbolized.
+func frameName(lookup Lookup, location pprofile.Location) string {
+	if location.Lines().Len() == 0 {
+		return fmt.Sprintf("%#x@%s", location.Address(), lookup.MappingFile(location.MappingIndex()))
+	}
+
+	var names []string
+	for _, line := range location.Lines().All() {
+		function, ok := lookup.Function(line.FunctionIndex())
+		if !ok {
+			names = append(names, "<invalid function>")
+			continue
+		}
+		names = append(names, lookup.String(function.NameStrindex()))
+	}
+	return strings.Join(names, " <- ")
+}
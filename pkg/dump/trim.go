@@ -0,0 +1,292 @@
+package dump
+
+import (
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// ExtractProfile returns a standalone request holding only profile, with the resource of rp
+// and the scope of sp, and a dictionary containing only the entries the profile references.
+func ExtractProfile(dict pprofile.ProfilesDictionary, rp pprofile.ResourceProfiles, sp pprofile.ScopeProfiles, profile pprofile.Profile) pprofile.Profiles {
+	pd := pprofile.NewProfiles()
+	b := newDictionaryBuilder(dict, pd.Dictionary())
+
+	dstRP := pd.ResourceProfiles().AppendEmpty()
+	rp.Resource().CopyTo(dstRP.Resource())
+	dstRP.SetSchemaUrl(rp.SchemaUrl())
+	dstSP := dstRP.ScopeProfiles().AppendEmpty()
+	sp.Scope().CopyTo(dstSP.Scope())
+	dstSP.SetSchemaUrl(sp.SchemaUrl())
+	b.profile(profile, dstSP.Profiles().AppendEmpty())
+	return pd
+}
+
+// Trim returns a copy of pd holding only the profiles keep returns true for, with a dictionary
+// containing only the entries they reference. Resources and scopes without any kept profile are
+// left out.
+func Trim(pd pprofile.Profiles, keep func(rp pprofile.ResourceProfiles, sp pprofile.ScopeProfiles, profile pprofile.Profile) bool) pprofile.Profiles {
+	trimmed := pprofile.NewProfiles()
+	b := newDictionaryBuilder(pd.Dictionary(), trimmed.Dictionary())
+
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rp := rps.At(i)
+		var dstRP pprofile.ResourceProfiles
+		sps := rp.ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			sp := sps.At(j)
+			var dstSP pprofile.ScopeProfiles
+			pcs := sp.Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				if !keep(rp, sp, pcs.At(k)) {
+					continue
+				}
+				if dstRP == (pprofile.ResourceProfiles{}) {
+					dstRP = trimmed.ResourceProfiles().AppendEmpty()
+					rp.Resource().CopyTo(dstRP.Resource())
+					dstRP.SetSchemaUrl(rp.SchemaUrl())
+				}
+				if dstSP == (pprofile.ScopeProfiles{}) {
+					dstSP = dstRP.ScopeProfiles().AppendEmpty()
+					sp.Scope().CopyTo(dstSP.Scope())
+					dstSP.SetSchemaUrl(sp.SchemaUrl())
+				}
+				b.profile(pcs.At(k), dstSP.Profiles().AppendEmpty())
+			}
+		}
+	}
+	return trimmed
+}
+
+// dictionaryBuilder copies the entries of a dictionary referenced by profiles into a new
+// dictionary, assigning new indices in the order they are first referenced. The zero entry of
+// every table stays at index 0. Invalid references are copied as the zero entry, except for
+// strings, which are copied as "<invalid index N>".
+type dictionaryBuilder struct {
+	src Lookup
+	dst pprofile.ProfilesDictionary
+
+	strings    map[int32]int32
+	attributes map[int32]int32
+	mappings   map[int32]int32
+	functions  map[int32]int32
+	locations  map[int32]int32
+	stacks     map[int32]int32
+	links      map[int32]int32
+}
+
+func newDictionaryBuilder(src, dst pprofile.ProfilesDictionary) *dictionaryBuilder {
+	b := &dictionaryBuilder{
+		src:        NewLookup(src),
+		dst:        dst,
+		strings:    map[int32]int32{},
+		attributes: map[int32]int32{},
+		mappings:   map[int32]int32{},
+		functions:  map[int32]int32{},
+		locations:  map[int32]int32{},
+		stacks:     map[int32]int32{},
+		links:      map[int32]int32{},
+	}
+	// Copy the zero entries first, in the order the tables reference each other, so that
+	// they end up at index 0.
+	if src.StringTable().Len() > 0 {
+		b.string(0)
+	} else {
+		dst.StringTable().Append("")
+		b.strings[0] = 0
+	}
+	if src.AttributeTable().Len() > 0 {
+		b.attribute(0)
+	} else {
+		dst.AttributeTable().AppendEmpty()
+		b.attributes[0] = 0
+	}
+	if src.MappingTable().Len() > 0 {
+		b.mapping(0)
+	} else {
+		dst.MappingTable().AppendEmpty()
+		b.mappings[0] = 0
+	}
+	if src.FunctionTable().Len() > 0 {
+		b.function(0)
+	} else {
+		dst.FunctionTable().AppendEmpty()
+		b.functions[0] = 0
+	}
+	if src.LocationTable().Len() > 0 {
+		b.location(0)
+	} else {
+		dst.LocationTable().AppendEmpty()
+		b.locations[0] = 0
+	}
+	if src.StackTable().Len() > 0 {
+		b.stack(0)
+	} else {
+		dst.StackTable().AppendEmpty()
+		b.stacks[0] = 0
+	}
+	if src.LinkTable().Len() > 0 {
+		b.link(0)
+	} else {
+		dst.LinkTable().AppendEmpty()
+		b.links[0] = 0
+	}
+	return b
+}
+
+// profile copies src to dst, rewriting its references into the new dictionary.
+func (b *dictionaryBuilder) profile(src, dst pprofile.Profile) {
+	src.CopyTo(dst)
+	b.valueType(dst.SampleType())
+	b.valueType(dst.PeriodType())
+	b.attributeIndices(dst.AttributeIndices())
+	for _, sample := range dst.Samples().All() {
+		sample.SetStackIndex(b.stack(sample.StackIndex()))
+		sample.SetLinkIndex(b.link(sample.LinkIndex()))
+		b.attributeIndices(sample.AttributeIndices())
+	}
+}
+
+func (b *dictionaryBuilder) valueType(vt pprofile.ValueType) {
+	vt.SetTypeStrindex(b.string(vt.TypeStrindex()))
+	vt.SetUnitStrindex(b.string(vt.UnitStrindex()))
+}
+
+// attributeIndices rewrites indices into the attribute table in place.
+func (b *dictionaryBuilder) attributeIndices(indices pcommon.Int32Slice) {
+	for i := 0; i < indices.Len(); i++ {
+		indices.SetAt(i, b.attribute(indices.At(i)))
+	}
+}
+
+func (b *dictionaryBuilder) string(idx int32) int32 {
+	if n, ok := b.strings[idx]; ok {
+		return n
+	}
+	n := int32(b.dst.StringTable().Len())
+	b.dst.StringTable().Append(b.src.String(idx))
+	b.strings[idx] = n
+	return n
+}
+
+func (b *dictionaryBuilder) attribute(idx int32) int32 {
+	if n, ok := b.attributes[idx]; ok {
+		return n
+	}
+	src, ok := b.src.Attribute(idx)
+	if !ok {
+		return 0
+	}
+	key, unit := b.string(src.KeyStrindex()), b.string(src.UnitStrindex())
+	n := int32(b.dst.AttributeTable().Len())
+	dst := b.dst.AttributeTable().AppendEmpty()
+	dst.SetKeyStrindex(key)
+	dst.SetUnitStrindex(unit)
+	src.Value().CopyTo(dst.Value())
+	b.attributes[idx] = n
+	return n
+}
+
+func (b *dictionaryBuilder) mapping(idx int32) int32 {
+	if n, ok := b.mappings[idx]; ok {
+		return n
+	}
+	// Lookup.Mapping treats index 0 as no mapping, it's resolved directly.
+	var src pprofile.Mapping
+	if idx == 0 {
+		src = b.src.dict.MappingTable().At(0)
+	} else if m, ok := b.src.Mapping(idx); ok {
+		src = m
+	} else {
+		return 0
+	}
+	filename := b.string(src.FilenameStrindex())
+	n := int32(b.dst.MappingTable().Len())
+	dst := b.dst.MappingTable().AppendEmpty()
+	src.CopyTo(dst)
+	dst.SetFilenameStrindex(filename)
+	b.attributeIndices(dst.AttributeIndices())
+	b.mappings[idx] = n
+	return n
+}
+
+func (b *dictionaryBuilder) function(idx int32) int32 {
+	if n, ok := b.functions[idx]; ok {
+		return n
+	}
+	src, ok := b.src.Function(idx)
+	if !ok {
+		return 0
+	}
+	name, systemName, filename := b.string(src.NameStrindex()), b.string(src.SystemNameStrindex()), b.string(src.FilenameStrindex())
+	n := int32(b.dst.FunctionTable().Len())
+	dst := b.dst.FunctionTable().AppendEmpty()
+	dst.SetNameStrindex(name)
+	dst.SetSystemNameStrindex(systemName)
+	dst.SetFilenameStrindex(filename)
+	dst.SetStartLine(src.StartLine())
+	b.functions[idx] = n
+	return n
+}
+
+func (b *dictionaryBuilder) location(idx int32) int32 {
+	if n, ok := b.locations[idx]; ok {
+		return n
+	}
+	src, ok := b.src.Location(idx)
+	if !ok {
+		return 0
+	}
+	mapping := b.mapping(src.MappingIndex())
+	functions := make([]int32, src.Lines().Len())
+	for i, line := range src.Lines().All() {
+		functions[i] = b.function(line.FunctionIndex())
+	}
+	n := int32(b.dst.LocationTable().Len())
+	dst := b.dst.LocationTable().AppendEmpty()
+	src.CopyTo(dst)
+	dst.SetMappingIndex(mapping)
+	for i, line := range dst.Lines().All() {
+		line.SetFunctionIndex(functions[i])
+	}
+	b.attributeIndices(dst.AttributeIndices())
+	b.locations[idx] = n
+	return n
+}
+
+func (b *dictionaryBuilder) stack(idx int32) int32 {
+	if n, ok := b.stacks[idx]; ok {
+		return n
+	}
+	src, ok := b.src.Stack(idx)
+	if !ok {
+		return 0
+	}
+	locations := make([]int32, src.LocationIndices().Len())
+	for i, location := range src.LocationIndices().All() {
+		locations[i] = b.location(location)
+	}
+	n := int32(b.dst.StackTable().Len())
+	b.dst.StackTable().AppendEmpty().LocationIndices().FromRaw(locations)
+	b.stacks[idx] = n
+	return n
+}
+
+func (b *dictionaryBuilder) link(idx int32) int32 {
+	if n, ok := b.links[idx]; ok {
+		return n
+	}
+	// Lookup.Link treats index 0 as no link, it's resolved directly.
+	var src pprofile.Link
+	if idx == 0 {
+		src = b.src.dict.LinkTable().At(0)
+	} else if l, ok := b.src.Link(idx); ok {
+		src = l
+	} else {
+		return 0
+	}
+	n := int32(b.dst.LinkTable().Len())
+	src.CopyTo(b.dst.LinkTable().AppendEmpty())
+	b.links[idx] = n
+	return n
+}
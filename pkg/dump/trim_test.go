@@ -0,0 +1,154 @@
+package dump
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// resolvedSamples renders every sample of every profile with all of its references resolved,
+// so requests can be compared regardless of their dictionary layout.
+func resolvedSamples(pd pprofile.Profiles) map[string][]string {
+	lookup := NewLookup(pd.Dictionary())
+	out := map[string][]string{}
+	for _, rp := range pd.ResourceProfiles().All() {
+		for _, sp := range rp.ScopeProfiles().All() {
+			for _, profile := range sp.Profiles().All() {
+				key := fmt.Sprintf("%s/%s/%s", rp.Resource().Attributes().AsRaw()["service.name"], sp.Scope().Name(),
+					formatValueType(lookup, profile.SampleType()))
+				for _, sample := range profile.Samples().All() {
+					var b strings.Builder
+					fmt.Fprintf(&b, "values=%v timestamps=%v", sample.Values().AsRaw(), sample.TimestampsUnixNano().AsRaw())
+					for _, idx := range sample.AttributeIndices().All() {
+						k, v := lookup.KeyValue(idx, 0)
+						fmt.Fprintf(&b, " %s=%s", k, v)
+					}
+					if stack, ok := lookup.Stack(sample.StackIndex()); ok {
+						for _, idx := range stack.LocationIndices().All() {
+							location, _ := lookup.Location(idx)
+							fmt.Fprintf(&b, " | %s %#x %s", frameName(lookup, location), location.Address(), lookup.MappingFile(location.MappingIndex()))
+							for _, attr := range location.AttributeIndices().All() {
+								k, v := lookup.KeyValue(attr, 0)
+								fmt.Fprintf(&b, " %s=%s", k, v)
+							}
+						}
+					}
+					out[key] = append(out[key], b.String())
+				}
+			}
+		}
+	}
+	return out
+}
+
+func TestTrim(t *testing.T) {
+	// twoProfiles adds a copy of the profile of a test request with another sample type and
+	// a string only it references.
+	twoProfiles := func() pprofile.Profiles {
+		pd := testRequest(20, 8)
+		profiles := pd.ResourceProfiles().At(0).ScopeProfiles().At(0).Profiles()
+		other := profiles.AppendEmpty()
+		profiles.At(0).CopyTo(other)
+		idx, _ := pprofile.SetString(pd.Dictionary().StringTable(), "samples")
+		other.SampleType().SetTypeStrindex(idx)
+		return pd
+	}
+
+	tests := []struct {
+		name     string
+		request  func() pprofile.Profiles
+		keep     func(pd pprofile.Profiles) func(pprofile.ResourceProfiles, pprofile.ScopeProfiles, pprofile.Profile) bool
+		profiles []string
+		// smaller is whether the trimmed string table has fewer entries.
+		smaller bool
+	}{
+		{
+			name:     "keep all",
+			request:  func() pprofile.Profiles { return testRequest(20, 8) },
+			keep:     keepSampleTypes(),
+			profiles: []string{"test/test/events [count]"},
+		},
+		{
+			name:     "keep one of two profiles",
+			request:  twoProfiles,
+			keep:     keepSampleTypes("events"),
+			profiles: []string{"test/test/events [count]"},
+			smaller:  true,
+		},
+		{
+			name:     "keep the other profile",
+			request:  twoProfiles,
+			keep:     keepSampleTypes("samples"),
+			profiles: []string{"test/test/samples [count]"},
+			smaller:  true,
+		},
+		{
+			name:    "keep none",
+			request: twoProfiles,
+			keep:    keepSampleTypes("cpu"),
+			smaller: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pd := tt.request()
+			trimmed := Trim(pd, tt.keep(pd))
+
+			if report := CheckReferences(trimmed); !report.Empty() {
+				t.Fatalf("trimmed request has invalid references: %s", report)
+			}
+			if s := trimmed.Dictionary().StringTable(); s.Len() == 0 || s.At(0) != "" {
+				t.Errorf("trimmed string table doesn't start with the empty string")
+			}
+			original, got := resolvedSamples(pd), resolvedSamples(trimmed)
+			var keys []string
+			for key := range got {
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+			if !slices.Equal(keys, tt.profiles) {
+				t.Fatalf("trimmed profiles = %v, want %v", keys, tt.profiles)
+			}
+			for _, key := range keys {
+				if !slices.Equal(got[key], original[key]) {
+					t.Errorf("samples of %s changed:\ngot  %q\nwant %q", key, got[key], original[key])
+				}
+			}
+			if smaller := trimmed.Dictionary().StringTable().Len() < pd.Dictionary().StringTable().Len(); smaller != tt.smaller {
+				t.Errorf("string table shrank from %d to %d entries, want smaller = %v",
+					pd.Dictionary().StringTable().Len(), trimmed.Dictionary().StringTable().Len(), tt.smaller)
+			}
+		})
+	}
+}
+
+// keepSampleTypes returns a Trim filter keeping the profiles of the given sample types, or all
+// of them without any.
+func keepSampleTypes(types ...string) func(pd pprofile.Profiles) func(pprofile.ResourceProfiles, pprofile.ScopeProfiles, pprofile.Profile) bool {
+	return func(pd pprofile.Profiles) func(pprofile.ResourceProfiles, pprofile.ScopeProfiles, pprofile.Profile) bool {
+		lookup := NewLookup(pd.Dictionary())
+		return func(_ pprofile.ResourceProfiles, _ pprofile.ScopeProfiles, profile pprofile.Profile) bool {
+			return len(types) == 0 || slices.Contains(types, lookup.String(profile.SampleType().TypeStrindex()))
+		}
+	}
+}
+
+func TestExtractProfile(t *testing.T) {
+	pd := testRequest(20, 8)
+	rp := pd.ResourceProfiles().At(0)
+	sp := rp.ScopeProfiles().At(0)
+	extracted := ExtractProfile(pd.Dictionary(), rp, sp, sp.Profiles().At(0))
+
+	if report := CheckReferences(extracted); !report.Empty() {
+		t.Fatalf("extracted request has invalid references: %s", report)
+	}
+	original, got := resolvedSamples(pd), resolvedSamples(extracted)
+	for key, samples := range original {
+		if !slices.Equal(got[key], samples) {
+			t.Errorf("samples of %s changed:\ngot  %q\nwant %q", key, got[key], samples)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package dump
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// IsLockSampleType returns whether the sample type measures lock contention, like
+// contentions or mutex delay.
+func IsLockSampleType(sampleType string) bool {
+	sampleType = strings.ToLower(sampleType)
+	for _, s := range []string{"contention", "lock", "mutex", "delay"} {
+		if strings.Contains(sampleType, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValueFormatter returns the formatter of the sample values of a profile in their unit, or
+// nil if they are plain numbers. Off-CPU and wall-clock values and lock delays are formatted
+// as durations, bytes with binary prefixes and contention and object counts with their noun.
+func ValueFormatter(lookup Lookup, profile pprofile.Profile) func(int64) string {
+	if duration := SampleDuration(lookup, profile); duration != nil {
+		return func(v int64) string { return duration(v).String() }
+	}
+
+	sampleType := strings.ToLower(lookup.String(profile.SampleType().TypeStrindex()))
+	unit := strings.ToLower(lookup.String(profile.SampleType().UnitStrindex()))
+	if unit == "bytes" || unit == "byte" {
+		return FormatBytes
+	}
+	if IsLockSampleType(sampleType) {
+		if d, ok := timeUnit(unit); ok {
+			return func(v int64) string { return (time.Duration(v) * d).String() }
+		}
+		if unit == "count" || unit == "" || unit == "contentions" {
+			return countFormatter("contention", "contentions")
+		}
+	}
+	if strings.HasSuffix(sampleType, "objects") && (unit == "count" || unit == "") {
+		return countFormatter("object", "objects")
+	}
+	return nil
+}
+
+// FormatBytes formats a number of bytes with binary prefixes, like 1.5 MiB.
+func FormatBytes(v int64) string {
+	const unit = 1024
+	abs := v
+	if abs < 0 {
+		abs = -abs
+	}
+	if abs < unit {
+		return fmt.Sprintf("%d B", v)
+	}
+	div, exp := int64(unit), 0
+	for n := abs / unit; n >= unit && exp < 5; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(v)/float64(div), "KMGTPE"[exp])
+}
+
+func countFormatter(singular, plural string) func(int64) string {
+	return func(v int64) string {
+		if v == 1 {
+			return "1 " + singular
+		}
+		return fmt.Sprintf("%d %s", v, plural)
+	}
+}
+
+// formatValues formats sample values with format.
+func formatValues(values []int64, format func(int64) string) string {
+	formatted := make([]string, len(values))
+	for i, v := range values {
+		formatted[i] = format(v)
+	}
+	return "[" + strings.Join(formatted, " ") + "]"
+}
+
+// dumpTotal dumps the summed values of the samples of a profile.
+func dumpTotal(log lineLogger, config Config, lookup Lookup, profile pprofile.Profile, format func(int64) string) {
+	total, samples := sumSamples(config, lookup, profile)
+	log.Info(fmt.Sprintf("  Total: %s in %d samples", format(total), samples))
+}
+
+// sumSamples returns the summed values and the number of the samples of a profile passing
+// the filters.
+func sumSamples(config Config, lookup Lookup, profile pprofile.Profile) (total int64, samples int) {
+	for _, sample := range profile.Samples().All() {
+		if !includeSample(config, lookup.dict, sample) {
+			continue
+		}
+		samples++
+		for _, v := range sample.Values().All() {
+			total += v
+		}
+	}
+	return total, samples
+}
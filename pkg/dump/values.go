@@ -0,0 +1,83 @@
+package dump
+
+import (
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// maxProfileDuration is the longest profile duration considered plausible, and
+// maxParallelism the most threads a sample value in a time unit may add up, which bounds it
+// by maxParallelism times the duration of the profile.
+const (
+	maxProfileDuration = 24 * time.Hour
+	maxParallelism     = 1024
+)
+
+// CheckValues returns the implausible values of a profile: negative or zero periods and
+// durations, durations of more than a day, negative and zero sample values, sample values in
+// a time unit exceeding what the profile could have measured, and samples with a value count
+// matching neither one nor their timestamp count.
+func CheckValues(lookup Lookup, profile pprofile.Profile) []string {
+	var issues []string
+	if profile.Period() < 0 {
+		issues = append(issues, fmt.Sprintf("negative period %d", profile.Period()))
+	} else if profile.Period() == 0 && lookup.String(profile.PeriodType().TypeStrindex()) != "" {
+		issues = append(issues, "zero period with a period type set")
+	}
+
+	duration := time.Duration(profile.DurationNano())
+	switch {
+	case profile.DurationNano() == 0:
+		issues = append(issues, "zero duration")
+	case duration < 0:
+		// Negative durations only show up as huge unsigned values on the wire.
+		issues = append(issues, fmt.Sprintf("negative duration %d ns (%d as unsigned)", int64(profile.DurationNano()), profile.DurationNano()))
+	case duration > maxProfileDuration:
+		issues = append(issues, fmt.Sprintf("duration %d ns (%v) is longer than %v", profile.DurationNano(), duration, maxProfileDuration))
+	}
+	if profile.Time().AsTime().Unix() <= 0 {
+		issues = append(issues, "time is not set")
+	}
+
+	// maxValue is the largest plausible value in the sample unit, if it's a time unit.
+	var maxValue int64
+	if unit, ok := timeUnit(lookup.String(profile.SampleType().UnitStrindex())); ok && duration > 0 && duration <= maxProfileDuration {
+		maxValue = int64(duration*maxParallelism) / int64(unit)
+	}
+
+	var negative, zero, tooLarge, mismatched int
+	var largest int64
+	for _, sample := range profile.Samples().All() {
+		values := sample.Values()
+		if n, timestamps := values.Len(), sample.TimestampsUnixNano().Len(); n != 1 && n != timestamps {
+			mismatched++
+		}
+		for _, v := range values.All() {
+			switch {
+			case v < 0:
+				negative++
+			case v == 0:
+				zero++
+			case maxValue > 0 && v > maxValue:
+				tooLarge++
+				largest = max(largest, v)
+			}
+		}
+	}
+	if negative > 0 {
+		issues = append(issues, fmt.Sprintf("%d negative sample values", negative))
+	}
+	if zero > 0 {
+		issues = append(issues, fmt.Sprintf("%d zero sample values", zero))
+	}
+	if tooLarge > 0 {
+		issues = append(issues, fmt.Sprintf("%d sample values exceed %d times the profile duration, up to %d %s",
+			tooLarge, maxParallelism, largest, lookup.String(profile.SampleType().UnitStrindex())))
+	}
+	if mismatched > 0 {
+		issues = append(issues, fmt.Sprintf("%d samples have neither one value nor one per timestamp", mismatched))
+	}
+	return issues
+}
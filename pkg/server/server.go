@@ -0,0 +1,163 @@
+// Package server provides an embeddable OTLP profiles server, e.g. to act as a fake profiles
+// backend in tests. Received profiles are dumped via the dump package and handed to an
+// optional hook.
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"google.golang.org/grpc"
+	// Profilers send the data gzip encoded.
+	_ "google.golang.org/grpc/encoding/gzip"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// Config configures the server.
+type Config struct {
+	dump.Config
+	// Addr is the address to listen on. Defaults to a random port on localhost, see Server.Addr.
+	Addr string
+}
+
+// Hook is called for every received request, after it got dumped. A returned error is sent
+// back to the exporter.
+type Hook func(ctx context.Context, request pprofileotlp.ExportRequest) error
+
+// Option customizes the server.
+type Option func(*Server)
+
+// WithWriter sets the destination of the dump output, which is stdout by default. A nil
+// writer disables dumping.
+func WithWriter(w io.Writer) Option {
+	return func(s *Server) {
+		s.out = w
+	}
+}
+
+// WithHook sets the hook called for every received request.
+func WithHook(hook Hook) Option {
+	return func(s *Server) {
+		s.hook = hook
+	}
+}
+
+// WithLogger sets the logger for server messages, which is slog.Default by default.
+func WithLogger(log *slog.Logger) Option {
+	return func(s *Server) {
+		s.log = log
+	}
+}
+
+// WithGRPCServerOptions adds options to the underlying gRPC server.
+func WithGRPCServerOptions(opts ...grpc.ServerOption) Option {
+	return func(s *Server) {
+		s.grpcOpts = append(s.grpcOpts, opts...)
+	}
+}
+
+// Server is an OTLP profiles gRPC server.
+type Server struct {
+	pprofileotlp.UnimplementedGRPCServer
+
+	cfg      Config
+	out      io.Writer
+	hook     Hook
+	log      *slog.Logger
+	grpcOpts []grpc.ServerOption
+
+	dumpLog *slog.Logger
+	grpc    *grpc.Server
+	lis     net.Listener
+	done    chan struct{}
+	mu      sync.Mutex
+}
+
+// NewServer returns a server, which needs to be started with Start.
+func NewServer(cfg Config, opts ...Option) *Server {
+	if cfg.Addr == "" {
+		cfg.Addr = "127.0.0.1:0"
+	}
+	s := &Server{
+		cfg: cfg,
+		out: os.Stdout,
+		log: slog.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.out != nil {
+		s.dumpLog = slog.New(dump.NewPlainHandler(s.out, slog.LevelInfo))
+	}
+	return s
+}
+
+// Start starts listening and serving in the background.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.grpc != nil {
+		return errors.New("server already started")
+	}
+	lis, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	s.lis = lis
+	s.grpc = grpc.NewServer(s.grpcOpts...)
+	pprofileotlp.RegisterGRPCServer(s.grpc, s)
+
+	s.done = make(chan struct{})
+	go func() {
+		defer close(s.done)
+		if err := s.grpc.Serve(lis); err != nil {
+			s.log.Error("error serving", slog.Any("error", err.Error()))
+		}
+	}()
+	return nil
+}
+
+// Addr returns the address the server listens on, once it is started.
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lis == nil {
+		return ""
+	}
+	return s.lis.Addr().String()
+}
+
+// Stop stops the server gracefully, letting pending requests finish.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.grpc == nil {
+		return
+	}
+	s.grpc.GracefulStop()
+	<-s.done
+	s.grpc = nil
+	s.lis = nil
+}
+
+// Export implements pprofileotlp.GRPCServer.
+func (s *Server) Export(ctx context.Context, request pprofileotlp.ExportRequest) (pprofileotlp.ExportResponse, error) {
+	if s.dumpLog != nil {
+		dump.Profiles(s.dumpLog, s.cfg.Config, request.Profiles())
+	}
+	if s.hook != nil {
+		if err := s.hook(ctx, request); err != nil {
+			return pprofileotlp.NewExportResponse(), err
+		}
+	}
+	return pprofileotlp.NewExportResponse(), nil
+}
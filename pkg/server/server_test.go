@@ -0,0 +1,106 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func testRequest() pprofileotlp.ExportRequest {
+	pd := pprofile.NewProfiles()
+	dict := pd.Dictionary()
+	dict.StringTable().Append("", "events", "count")
+	dict.StackTable().AppendEmpty()
+
+	rp := pd.ResourceProfiles().AppendEmpty()
+	rp.Resource().Attributes().PutStr("service.name", "test")
+	profile := rp.ScopeProfiles().AppendEmpty().Profiles().AppendEmpty()
+	profile.SetProfileID(pprofile.ProfileID{0xca, 0xfe})
+	profile.SampleType().SetTypeStrindex(1)
+	profile.SampleType().SetUnitStrindex(2)
+	profile.Samples().AppendEmpty().Values().Append(1)
+	return pprofileotlp.NewExportRequestFromProfiles(pd)
+}
+
+func export(t *testing.T, addr string) error {
+	t.Helper()
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = pprofileotlp.NewGRPCClient(conn).Export(ctx, testRequest())
+	return err
+}
+
+func TestServer(t *testing.T) {
+	var out bytes.Buffer
+	received := make(chan pprofileotlp.ExportRequest, 1)
+	s := NewServer(Config{Addr: "127.0.0.1:0"}, WithWriter(&out), WithHook(func(_ context.Context, request pprofileotlp.ExportRequest) error {
+		received <- request
+		return nil
+	}))
+	if err := s.Start(); err != nil {
+		t.Fatalf("error starting server: %v", err)
+	}
+	if err := s.Start(); err == nil {
+		t.Error("starting the server twice succeeded")
+	}
+
+	addr := s.Addr()
+	if addr == "" || strings.HasSuffix(addr, ":0") {
+		t.Fatalf("Addr() = %q, want the bound address", addr)
+	}
+	if err := export(t, addr); err != nil {
+		t.Fatalf("error exporting: %v", err)
+	}
+
+	select {
+	case request := <-received:
+		if n := request.Profiles().ResourceProfiles().Len(); n != 1 {
+			t.Errorf("received %d resource profiles, want 1", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("hook wasn't called")
+	}
+	if !strings.Contains(out.String(), "ProfileID: cafe") {
+		t.Errorf("dump output lacks the profile ID:\n%s", out.String())
+	}
+
+	s.Stop()
+	if addr := s.Addr(); addr != "" {
+		t.Errorf("Addr() after Stop = %q, want empty", addr)
+	}
+	if err := export(t, addr); err == nil {
+		t.Error("exporting after Stop succeeded")
+	}
+	// Stopping twice is a no-op.
+	s.Stop()
+}
+
+func TestServerHookError(t *testing.T) {
+	s := NewServer(Config{}, WithWriter(nil), WithHook(func(context.Context, pprofileotlp.ExportRequest) error {
+		return status.Error(codes.ResourceExhausted, "slow down")
+	}))
+	if err := s.Start(); err != nil {
+		t.Fatalf("error starting server: %v", err)
+	}
+	defer s.Stop()
+
+	err := export(t, s.Addr())
+	if st, ok := status.FromError(err); !ok || st.Code() != codes.ResourceExhausted {
+		t.Errorf("export error = %v, want the hook's ResourceExhausted", err)
+	}
+}
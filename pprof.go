@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/google/pprof/profile"
+)
+
+// toPprof converts a resolved profile into the pprof format. Sample attributes end up as
+// labels, the resource and scope are dropped as pprof has no notion of them.
+func toPprof(view profileView) *profile.Profile {
+	p := view.Profile
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{
+			Type: p.SampleType,
+			Unit: p.SampleUnit,
+		}},
+		PeriodType: &profile.ValueType{
+			Type: p.PeriodType,
+			Unit: p.PeriodUnit,
+		},
+		Period:        p.Period,
+		TimeNanos:     p.Time.UnixNano(),
+		DurationNanos: int64(p.Duration),
+	}
+
+	b := newPprofBuilder(prof)
+	for _, sample := range p.Samples {
+		b.addSample(sample)
+	}
+
+	return prof
+}
+
+// pprofBuilder deduplicates functions, mappings and locations while building a pprof profile.
+type pprofBuilder struct {
+	prof      *profile.Profile
+	functions map[[2]string]*profile.Function
+	mappings  map[string]*profile.Mapping
+	locations map[string]*profile.Location
+}
+
+func newPprofBuilder(prof *profile.Profile) *pprofBuilder {
+	return &pprofBuilder{
+		prof:      prof,
+		functions: map[[2]string]*profile.Function{},
+		mappings:  map[string]*profile.Mapping{},
+		locations: map[string]*profile.Location{},
+	}
+}
+
+func (b *pprofBuilder) addSample(sample sampleView) {
+	// pprof profiles only support a single value per sample type, the values of a sample with
+	// one per timestamp are summed up.
+	s := &profile.Sample{
+		Value: []int64{sample.total()},
+	}
+	if len(sample.Values) == 0 {
+		s.Value = []int64{1}
+	}
+
+	// Inlined frames share a single pprof location with multiple lines.
+	var chain []frameView
+	for _, frame := range sample.Frames {
+		chain = append(chain, frame)
+		if frame.Inlined {
+			continue
+		}
+		s.Location = append(s.Location, b.location(chain))
+		chain = nil
+	}
+	if len(chain) > 0 {
+		s.Location = append(s.Location, b.location(chain))
+	}
+
+	for k, v := range sample.Attributes {
+		if s.Label == nil {
+			s.Label = map[string][]string{}
+		}
+		s.Label[k] = []string{v}
+	}
+
+	b.prof.Sample = append(b.prof.Sample, s)
+}
+
+// location returns the location for the given frames, which all belong to the same OTLP
+// location. All but the last are inlined into their caller.
+func (b *pprofBuilder) location(frames []frameView) *profile.Location {
+	key := fmt.Sprint(frames)
+	if loc, ok := b.locations[key]; ok {
+		return loc
+	}
+
+	loc := &profile.Location{
+		ID:      uint64(len(b.prof.Location) + 1),
+		Address: frames[0].Address,
+	}
+	if frames[0].Mapping != "" {
+		loc.Mapping = b.mapping(frames[0].Mapping)
+	}
+	for _, frame := range frames {
+		if frame.Function == "" {
+			continue
+		}
+		loc.Line = append(loc.Line, profile.Line{
+			Function: b.function(frame.Function, frame.File),
+			Line:     frame.Line,
+			Column:   frame.Column,
+		})
+	}
+
+	b.locations[key] = loc
+	b.prof.Location = append(b.prof.Location, loc)
+	return loc
+}
+
+func (b *pprofBuilder) function(name, file string) *profile.Function {
+	key := [2]string{name, file}
+	if fn, ok := b.functions[key]; ok {
+		return fn
+	}
+
+	fn := &profile.Function{
+		ID:         uint64(len(b.prof.Function) + 1),
+		Name:       name,
+		SystemName: name,
+		Filename:   file,
+	}
+	b.functions[key] = fn
+	b.prof.Function = append(b.prof.Function, fn)
+	return fn
+}
+
+func (b *pprofBuilder) mapping(file string) *profile.Mapping {
+	if m, ok := b.mappings[file]; ok {
+		return m
+	}
+
+	m := &profile.Mapping{
+		ID:   uint64(len(b.prof.Mapping) + 1),
+		File: file,
+	}
+	b.mappings[file] = m
+	b.prof.Mapping = append(b.prof.Mapping, m)
+	return m
+}
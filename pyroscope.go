@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// pyroscopeConfig configures forwarding to the Pyroscope ingest API.
+type pyroscopeConfig struct {
+	URL string
+	// AppName is used for resources without service.name.
+	AppName  string
+	TenantID string
+	Username string
+	Password string
+}
+
+// pyroscopeForwarder converts received profiles to pprof and pushes them to Pyroscope. The
+// resource attributes become labels of the series.
+type pyroscopeForwarder struct {
+	log    *slog.Logger
+	cfg    pyroscopeConfig
+	config func() Config
+	client *http.Client
+}
+
+func newPyroscopeForwarder(log *slog.Logger, cfg pyroscopeConfig, config func() Config) *pyroscopeForwarder {
+	return &pyroscopeForwarder{
+		log:    log,
+		cfg:    cfg,
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *pyroscopeForwarder) forward(pd pprofile.Profiles) {
+	for _, view := range resolveProfiles(p.config(), pd) {
+		if err := p.push(view); err != nil {
+			p.log.Error("error forwarding profile to pyroscope",
+				slog.String("profile_id", view.Profile.ProfileID),
+				slog.Any("error", err.Error()))
+		}
+	}
+}
+
+func (p *pyroscopeForwarder) push(view profileView) error {
+	var body bytes.Buffer
+	if err := toPprof(view).Write(&body); err != nil {
+		return fmt.Errorf("error encoding pprof: %w", err)
+	}
+
+	from := view.Profile.Time
+	until := from.Add(view.Profile.Duration)
+	query := url.Values{}
+	query.Set("name", pyroscopeSeriesName(p.cfg.AppName, view))
+	query.Set("from", strconv.FormatInt(from.Unix(), 10))
+	query.Set("until", strconv.FormatInt(max(until.Unix(), from.Unix()+1), 10))
+	query.Set("format", "pprof")
+	query.Set("spyName", "otel-profiles-debug-server")
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(p.cfg.URL, "/")+"/ingest?"+query.Encode(), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if p.cfg.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", p.cfg.TenantID)
+	}
+	if p.cfg.Username != "" {
+		req.SetBasicAuth(p.cfg.Username, p.cfg.Password)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// pyroscopeSeriesName returns the series name in the app{label=value,...} format of the
+// ingest API.
+func pyroscopeSeriesName(appName string, view profileView) string {
+	if name := view.Resource.Attributes["service.name"]; name != "" {
+		appName = name
+	}
+
+	var labels []string
+	for _, k := range slices.Sorted(maps.Keys(view.Resource.Attributes)) {
+		if k == "service.name" {
+			continue
+		}
+		labels = append(labels, pyroscopeLabel(k)+"="+pyroscopeLabel(view.Resource.Attributes[k]))
+	}
+	return appName + "." + view.Profile.SampleType + "{" + strings.Join(labels, ",") + "}"
+}
+
+// pyroscopeLabel replaces characters that are not allowed in series names.
+func pyroscopeLabel(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '{', '}', ',', '=', ' ':
+			return '_'
+		}
+		return r
+	}, s)
+}
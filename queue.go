@@ -0,0 +1,63 @@
+package main
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// dumpQueue decouples dumping from the Export handler, so a slow output doesn't backpressure
+// the exporter.
+type dumpQueue struct {
+	requests chan queuedRequest
+	wg       sync.WaitGroup
+}
+
+// queuedRequest is a request waiting in a dumpQueue with the memory reserved for it.
+type queuedRequest struct {
+	pd          pprofile.Profiles
+	reservation *reservation
+}
+
+// newDumpQueue starts the given number of workers calling dump for every queued request. With
+// more than one worker, the output of concurrent requests may interleave.
+func newDumpQueue(size, workers int, dump func(pprofile.Profiles)) *dumpQueue {
+	q := &dumpQueue{
+		requests: make(chan queuedRequest, size),
+	}
+	for range max(workers, 1) {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for r := range q.requests {
+				dump(r.pd)
+				r.reservation.done()
+			}
+		}()
+	}
+	return q
+}
+
+// enqueue queues the request without blocking, holding the reservation until it is dumped.
+// It returns false if the queue is full.
+func (q *dumpQueue) enqueue(pd pprofile.Profiles, res *reservation) bool {
+	res.hold()
+	select {
+	case q.requests <- queuedRequest{pd: pd, reservation: res}:
+		return true
+	default:
+		res.done()
+		return false
+	}
+}
+
+// depth returns the number of requests waiting to be dumped.
+func (q *dumpQueue) depth() int {
+	return len(q.requests)
+}
+
+// close stops accepting requests and waits until all queued requests are dumped.
+func (q *dumpQueue) close() {
+	close(q.requests)
+	q.wg.Wait()
+}
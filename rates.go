@@ -0,0 +1,207 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// rateKey identifies the resources the rates are reported for.
+type rateKey struct {
+	tenant    string
+	service   string
+	container string
+}
+
+// resourceRate counts what a resource sent within the current interval.
+type resourceRate struct {
+	profiles int64
+	samples  int64
+	// bytes is the share of the request size by the share of samples of the resource.
+	bytes  float64
+	stacks map[uint64]struct{}
+}
+
+// rateDashboard periodically prints the profile, sample and byte rates and the number of unique
+// stacks per service and container, for watching load tests.
+type rateDashboard struct {
+	interval time.Duration
+	out      io.Writer
+	seed     maphash.Seed
+	// tenantAttribute is the resource attribute holding the tenant, if the rates are reported
+	// per tenant.
+	tenantAttribute string
+
+	mu        sync.Mutex
+	started   time.Time
+	resources map[rateKey]*resourceRate
+}
+
+func newRateDashboard(interval time.Duration, out io.Writer) *rateDashboard {
+	return &rateDashboard{
+		interval:  interval,
+		out:       out,
+		seed:      maphash.MakeSeed(),
+		started:   time.Now(),
+		resources: map[rateKey]*resourceRate{},
+	}
+}
+
+// record counts a request of size bytes on the wire.
+func (d *rateDashboard) record(size int, pd pprofile.Profiles) {
+	dict := pd.Dictionary()
+	rps := pd.ResourceProfiles()
+
+	totalSamples := 0
+	for i := 0; i < rps.Len(); i++ {
+		totalSamples += countSamples(rps.At(i))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i := 0; i < rps.Len(); i++ {
+		rp := rps.At(i)
+		attrs := rp.Resource().Attributes()
+		key := rateKey{service: "unknown", container: "-"}
+		if v, ok := attrs.Get("service.name"); ok && v.AsString() != "" {
+			key.service = v.AsString()
+		}
+		if v, ok := attrs.Get("container.id"); ok && v.AsString() != "" {
+			key.container = v.AsString()
+		}
+		if v, ok := attrs.Get(d.tenantAttribute); ok && d.tenantAttribute != "" {
+			key.tenant = v.AsString()
+		}
+		r := d.resources[key]
+		if r == nil {
+			r = &resourceRate{stacks: map[uint64]struct{}{}}
+			d.resources[key] = r
+		}
+
+		samples := countSamples(rp)
+		r.samples += int64(samples)
+		if totalSamples > 0 {
+			r.bytes += float64(size) * float64(samples) / float64(totalSamples)
+		}
+		sps := rp.ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			pcs := sps.At(j).Profiles()
+			r.profiles += int64(pcs.Len())
+			for k := 0; k < pcs.Len(); k++ {
+				for _, sample := range pcs.At(k).Samples().All() {
+					r.stacks[d.stackHash(dict, sample.StackIndex())] = struct{}{}
+				}
+			}
+		}
+	}
+}
+
+// stackHash hashes the resolved frames of a stack, as stack indices are only valid within a
+// single request.
+func (d *rateDashboard) stackHash(dict pprofile.ProfilesDictionary, idx int32) uint64 {
+	var h maphash.Hash
+	h.SetSeed(d.seed)
+	lookup := dump.NewLookup(dict)
+	stack, ok := lookup.Stack(idx)
+	if !ok {
+		return h.Sum64()
+	}
+	for _, locIdx := range stack.LocationIndices().All() {
+		location, ok := lookup.Location(locIdx)
+		if !ok {
+			continue
+		}
+		for _, line := range location.Lines().All() {
+			if function, ok := lookup.Function(line.FunctionIndex()); ok {
+				h.WriteString(lookup.String(function.NameStrindex()))
+			}
+			h.WriteByte(0)
+		}
+		if location.Lines().Len() == 0 {
+			if mapping, ok := lookup.Mapping(location.MappingIndex()); ok {
+				h.WriteString(lookup.String(mapping.FilenameStrindex()))
+			}
+			fmt.Fprintf(&h, "+%x", location.Address())
+		}
+		h.WriteByte(1)
+	}
+	return h.Sum64()
+}
+
+// run prints the rates at the end of every interval until ctx is done.
+func (d *rateDashboard) run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.print(now)
+		}
+	}
+}
+
+// print writes the rates since the last print and resets them.
+func (d *rateDashboard) print(now time.Time) {
+	d.mu.Lock()
+	resources := d.resources
+	elapsed := now.Sub(d.started).Seconds()
+	d.resources = map[rateKey]*resourceRate{}
+	d.started = now
+	d.mu.Unlock()
+
+	fmt.Fprintf(d.out, "--------------- Rates (%s) ---------------\n", now.Format(time.TimeOnly))
+	if len(resources) == 0 {
+		fmt.Fprintln(d.out, "  no profiles received")
+		return
+	}
+	keys := make([]rateKey, 0, len(resources))
+	for key := range resources {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b rateKey) int {
+		return cmp.Or(cmp.Compare(resources[b].samples, resources[a].samples),
+			cmp.Compare(a.tenant, b.tenant), cmp.Compare(a.service, b.service), cmp.Compare(a.container, b.container))
+	})
+
+	tw := tabwriter.NewWriter(d.out, 0, 4, 2, ' ', 0)
+	header := "  SERVICE\tCONTAINER\tPROFILES/S\tSAMPLES/S\tBYTES/S\tUNIQUE STACKS"
+	if d.tenantAttribute != "" {
+		header = "  TENANT\t" + header[2:]
+	}
+	fmt.Fprintln(tw, header)
+	for _, key := range keys {
+		r := resources[key]
+		prefix := "  "
+		if d.tenantAttribute != "" {
+			prefix += key.tenant + "\t"
+		}
+		fmt.Fprintf(tw, "%s%s\t%s\t%.1f\t%.1f\t%.0f\t%d\n", prefix, key.service, key.container,
+			float64(r.profiles)/elapsed, float64(r.samples)/elapsed, r.bytes/elapsed, len(r.stacks))
+	}
+	tw.Flush()
+}
+
+func countSamples(rp pprofile.ResourceProfiles) int {
+	n := 0
+	sps := rp.ScopeProfiles()
+	for j := 0; j < sps.Len(); j++ {
+		pcs := sps.At(j).Profiles()
+		for k := 0; k < pcs.Len(); k++ {
+			n += pcs.At(k).Samples().Len()
+		}
+	}
+	return n
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	collectorpb "go.opentelemetry.io/proto/slim/otlp/collector/profiles/v1development"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+)
+
+// rawFormats are the supported values of -raw-format.
+var rawFormats = []string{"prototext", "hexdump"}
+
+// printRaw writes the request as it was encoded on the wire in the given format. Transports
+// that only hand out the decoded request, like gRPC, print it re-encoded, which drops unknown
+// fields.
+func printRaw(w io.Writer, format string, info *requestInfo, request pprofileotlp.ExportRequest) error {
+	payload, source := info.payload, "wire"
+	if payload == nil {
+		var err error
+		if payload, err = request.MarshalProto(); err != nil {
+			return err
+		}
+		source = "re-encoded"
+	}
+
+	var out strings.Builder
+	fmt.Fprintln(&out, "------------------- Raw request -------------------")
+	fmt.Fprintf(&out, "  Source: %s, %d bytes\n", source, len(payload))
+	switch format {
+	case "prototext":
+		var pb collectorpb.ExportProfilesServiceRequest
+		if err := proto.Unmarshal(payload, &pb); err != nil {
+			return err
+		}
+		text, err := prototext.MarshalOptions{Multiline: true, Indent: "  "}.Marshal(&pb)
+		if err != nil {
+			return err
+		}
+		out.Write(text)
+	case "hexdump":
+		out.WriteString(hex.Dump(payload))
+	}
+	fmt.Fprintln(&out, "---------------------------------------------------")
+	_, err := io.WriteString(w, out.String())
+	return err
+}
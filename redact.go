@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+const redactedValue = "[REDACTED]"
+
+// redactor replaces the values of attributes whose key matches one of the patterns. As it runs
+// right after enrichment, no output or forward ever sees the original values.
+type redactor struct {
+	// patterns are path.Match patterns, e.g. process.command_args or *.env.*.
+	patterns []string
+	// hash replaces values with a hash instead of [REDACTED], so equal values can still be
+	// correlated.
+	hash bool
+}
+
+func newRedactor(patterns []string, mode string) (*redactor, error) {
+	for _, p := range patterns {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+	}
+	if mode != "replace" && mode != "hash" {
+		return nil, fmt.Errorf("unknown redaction mode %q, expected replace or hash", mode)
+	}
+	return &redactor{patterns: patterns, hash: mode == "hash"}, nil
+}
+
+func (r *redactor) matches(key string) bool {
+	for _, p := range r.patterns {
+		if ok, _ := path.Match(p, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) redact(pd pprofile.Profiles) {
+	rangeAttributes(pd, func(key string, v pcommon.Value) {
+		if !r.matches(key) {
+			return
+		}
+		if r.hash {
+			sum := sha256.Sum256([]byte(v.AsString()))
+			v.SetStr("sha256:" + hex.EncodeToString(sum[:8]))
+			return
+		}
+		v.SetStr(redactedValue)
+	})
+}
+
+// rangeAttributes calls f for every resource and scope attribute, and every attribute of the
+// dictionary, which holds the profile and sample attributes.
+func rangeAttributes(pd pprofile.Profiles, f func(key string, v pcommon.Value)) {
+	visit := func(attrs pcommon.Map) {
+		attrs.Range(func(k string, v pcommon.Value) bool {
+			f(k, v)
+			return true
+		})
+	}
+
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rp := rps.At(i)
+		visit(rp.Resource().Attributes())
+		sps := rp.ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			visit(sps.At(j).Scope().Attributes())
+		}
+	}
+
+	dict := pd.Dictionary()
+	stringTable := dict.StringTable()
+	attrTable := dict.AttributeTable()
+	for i := 0; i < attrTable.Len(); i++ {
+		attr := attrTable.At(i)
+		idx := int(attr.KeyStrindex())
+		if idx < 0 || idx >= stringTable.Len() {
+			continue
+		}
+		f(stringTable.At(idx), attr.Value())
+	}
+}
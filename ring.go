@@ -0,0 +1,145 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// storedProfile is a profile kept in memory for the HTTP API.
+type storedProfile struct {
+	Seq        int64       `json:"seq"`
+	ReceivedAt time.Time   `json:"received_at"`
+	View       profileView `json:"view"`
+}
+
+// profileRing keeps the most recently received profiles in memory. Entries get evicted once
+// there are more than maxProfiles of them or they are older than maxAge. A zero limit disables
+// the respective check.
+type profileRing struct {
+	mu          sync.Mutex
+	maxProfiles int
+	maxAge      time.Duration
+	// entries is a circular buffer of the n retained entries, the oldest one at head.
+	entries []storedProfile
+	head    int
+	n       int
+	nextSeq int64
+	evicted int64
+}
+
+func newProfileRing(maxProfiles int, maxAge time.Duration) *profileRing {
+	return &profileRing{
+		maxProfiles: maxProfiles,
+		maxAge:      maxAge,
+		nextSeq:     1,
+	}
+}
+
+func (r *profileRing) add(receivedAt time.Time, views []profileView) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, view := range views {
+		r.push(storedProfile{
+			Seq:        r.nextSeq,
+			ReceivedAt: receivedAt,
+			View:       view,
+		})
+		r.nextSeq++
+	}
+	r.evictLocked(receivedAt)
+}
+
+// push appends an entry, overwriting the oldest one once there are maxProfiles entries.
+func (r *profileRing) push(entry storedProfile) {
+	if r.maxProfiles > 0 && r.n == r.maxProfiles {
+		r.entries[r.head] = entry
+		r.head = (r.head + 1) % len(r.entries)
+		r.evicted++
+		return
+	}
+	if r.n == len(r.entries) {
+		size := max(2*len(r.entries), 16)
+		if r.maxProfiles > 0 {
+			size = min(size, r.maxProfiles)
+		}
+		entries := make([]storedProfile, size)
+		for i := range r.n {
+			entries[i] = r.at(i)
+		}
+		r.entries, r.head = entries, 0
+	}
+	r.entries[(r.head+r.n)%len(r.entries)] = entry
+	r.n++
+}
+
+// at returns the i-th oldest entry.
+func (r *profileRing) at(i int) storedProfile {
+	return r.entries[(r.head+i)%len(r.entries)]
+}
+
+// evict drops all entries exceeding the retention settings.
+func (r *profileRing) evict(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.evictLocked(now)
+}
+
+// evictLocked drops the entries older than maxAge, push already limits them to maxProfiles.
+func (r *profileRing) evictLocked(now time.Time) {
+	if r.maxAge <= 0 {
+		return
+	}
+	cutoff := now.Add(-r.maxAge)
+	for r.n > 0 && r.entries[r.head].ReceivedAt.Before(cutoff) {
+		// Clear the entry, so the evicted profile can be garbage collected.
+		r.entries[r.head] = storedProfile{}
+		r.head = (r.head + 1) % len(r.entries)
+		r.n--
+		r.evicted++
+	}
+}
+
+// list returns a copy of all retained entries, oldest first.
+func (r *profileRing) list() []storedProfile {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries := make([]storedProfile, r.n)
+	for i := range r.n {
+		entries[i] = r.at(i)
+	}
+	return entries
+}
+
+// get returns the entry with the given sequence number or profile ID.
+func (r *profileRing) get(match func(storedProfile) bool) (storedProfile, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := r.n - 1; i >= 0; i-- {
+		if entry := r.at(i); match(entry) {
+			return entry, true
+		}
+	}
+	return storedProfile{}, false
+}
+
+// runEviction evicts expired entries until done is closed. Without it, entries only get
+// evicted when new profiles arrive.
+func (r *profileRing) runEviction(done <-chan struct{}) {
+	if r.maxAge <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(min(r.maxAge, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			r.evict(now)
+		}
+	}
+}
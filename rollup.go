@@ -0,0 +1,213 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// unknownService is the service.name backends assume for resources without one.
+const unknownService = "unknown_service"
+
+// rollupKey identifies a time series of the rollups.
+type rollupKey struct {
+	Service    string `json:"service"`
+	SampleType string `json:"sample_type"`
+	Function   string `json:"function"`
+}
+
+// rollupPoint is the aggregate of a series in one interval. Self sums the values of the
+// samples with the function as leaf frame, Total those of the samples with the function
+// anywhere in the stack, counting recursive functions once.
+type rollupPoint struct {
+	Time    time.Time `json:"time"`
+	Self    int64     `json:"self"`
+	Total   int64     `json:"total"`
+	Samples int64     `json:"samples"`
+}
+
+// rollupSeries is the summary of a series over the window.
+type rollupSeries struct {
+	rollupKey
+	Self    int64 `json:"self"`
+	Total   int64 `json:"total"`
+	Samples int64 `json:"samples"`
+}
+
+// rollups aggregates received samples into per service and function time series like a
+// profiling backend would, to compare its results with expectations. Samples are assigned
+// to intervals by their timestamps, or the time of their profile if they have none. Intervals
+// older than the window are dropped.
+type rollups struct {
+	interval time.Duration
+	window   time.Duration
+
+	mu     sync.Mutex
+	series map[rollupKey]map[int64]*rollupPoint
+}
+
+func newRollups(interval, window time.Duration) *rollups {
+	return &rollups{
+		interval: interval,
+		window:   window,
+		series:   map[rollupKey]map[int64]*rollupPoint{},
+	}
+}
+
+func (r *rollups) add(now time.Time, views []profileView) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, view := range views {
+		service := view.Resource.Attributes["service.name"]
+		if service == "" {
+			service = unknownService
+		}
+		p := view.Profile
+		for _, sample := range p.Samples {
+			timestamps := sample.Timestamps
+			if len(timestamps) == 0 {
+				timestamps = []time.Time{p.Time}
+			}
+			functions := map[string]bool{}
+			for i, ts := range timestamps {
+				// Values are either one per timestamp or an aggregate, which is assigned to the
+				// first timestamp.
+				var value int64
+				switch {
+				case len(sample.Values) == len(timestamps):
+					value = sample.Values[i]
+				case i == 0:
+					value = sample.total()
+				}
+				bucket := ts.Truncate(r.interval).UnixNano()
+				clear(functions)
+				for m, frame := range sample.Frames {
+					name := frameName(frame)
+					key := rollupKey{Service: service, SampleType: p.SampleType, Function: name}
+					point := r.point(key, bucket)
+					if m == 0 {
+						point.Self += value
+					}
+					if !functions[name] {
+						functions[name] = true
+						point.Total += value
+						point.Samples++
+					}
+				}
+			}
+		}
+	}
+	r.expire(now)
+}
+
+func (r *rollups) point(key rollupKey, bucket int64) *rollupPoint {
+	points, ok := r.series[key]
+	if !ok {
+		points = map[int64]*rollupPoint{}
+		r.series[key] = points
+	}
+	point, ok := points[bucket]
+	if !ok {
+		point = &rollupPoint{Time: time.Unix(0, bucket).UTC()}
+		points[bucket] = point
+	}
+	return point
+}
+
+// expire drops the intervals ending before the window.
+func (r *rollups) expire(now time.Time) {
+	oldest := now.Add(-r.window).Truncate(r.interval).UnixNano()
+	for key, points := range r.series {
+		for bucket := range points {
+			if bucket < oldest {
+				delete(points, bucket)
+			}
+		}
+		if len(points) == 0 {
+			delete(r.series, key)
+		}
+	}
+}
+
+// list returns the series matching the service and sample type, if set, ordered by their
+// self value.
+func (r *rollups) list(now time.Time, service, sampleType string) []rollupSeries {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(now)
+
+	var out []rollupSeries
+	for key, points := range r.series {
+		if (service != "" && key.Service != service) || (sampleType != "" && key.SampleType != sampleType) {
+			continue
+		}
+		s := rollupSeries{rollupKey: key}
+		for _, point := range points {
+			s.Self += point.Self
+			s.Total += point.Total
+			s.Samples += point.Samples
+		}
+		out = append(out, s)
+	}
+	slices.SortFunc(out, func(a, b rollupSeries) int {
+		return cmp.Or(cmp.Compare(b.Self, a.Self), cmp.Compare(b.Total, a.Total),
+			cmp.Compare(a.Service, b.Service), cmp.Compare(a.SampleType, b.SampleType), cmp.Compare(a.Function, b.Function))
+	})
+	return out
+}
+
+// points returns the intervals of a series in chronological order.
+func (r *rollups) points(now time.Time, key rollupKey) []rollupPoint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.expire(now)
+
+	var out []rollupPoint
+	for _, point := range r.series[key] {
+		out = append(out, *point)
+	}
+	slices.SortFunc(out, func(a, b rollupPoint) int {
+		return a.Time.Compare(b.Time)
+	})
+	return out
+}
+
+func (f *profilesServer) handleListRollups(w http.ResponseWriter, r *http.Request) {
+	if f.rollups == nil {
+		http.Error(w, "rollups are disabled, set -rollup-interval", http.StatusServiceUnavailable)
+		return
+	}
+	series := f.rollups.list(time.Now(), r.URL.Query().Get("service"), r.URL.Query().Get("sample_type"))
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		series = series[:min(n, len(series))]
+	}
+	writeJSON(w, series)
+}
+
+func (f *profilesServer) handleGetRollupSeries(w http.ResponseWriter, r *http.Request) {
+	if f.rollups == nil {
+		http.Error(w, "rollups are disabled, set -rollup-interval", http.StatusServiceUnavailable)
+		return
+	}
+	query := r.URL.Query()
+	key := rollupKey{Service: query.Get("service"), SampleType: query.Get("sample_type"), Function: query.Get("function")}
+	if key.Service == "" || key.SampleType == "" || key.Function == "" {
+		http.Error(w, "service, sample_type and function are required", http.StatusBadRequest)
+		return
+	}
+	points := f.rollups.points(time.Now(), key)
+	if len(points) == 0 {
+		http.Error(w, "no such series", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, points)
+}
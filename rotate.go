@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// rotationConfig controls the size based rotation of output files.
+type rotationConfig struct {
+	// MaxSize is the size in bytes after which the file is rotated. Zero disables rotation.
+	MaxSize int64
+	// MaxFiles is the number of rotated files to keep.
+	MaxFiles int
+	// Compress gzips rotated files.
+	Compress bool
+	// Log receives the errors rotating a file while writing to it, if set.
+	Log *slog.Logger
+}
+
+// rotatingFile is a buffered io.WriteCloser appending to a file, which gets rotated once it
+// grows past the configured size. Rotated files are named <path>.1 (newest) up to
+// <path>.<MaxFiles>. A suspended file is closed until the next write. If rotating fails, writes
+// continue to the current file and rotating is retried once it grew by another MaxSize.
+type rotatingFile struct {
+	mu   sync.Mutex
+	path string
+	cfg  rotationConfig
+	f    *os.File
+	w    *bufio.Writer
+	size int64
+	// retryAt is the size at which rotating is retried after it failed.
+	retryAt int64
+}
+
+func openRotatingFile(path string, cfg rotationConfig) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path: path,
+		cfg:  cfg,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the file at path. The current file, if any, is left as it is if that fails and
+// has to be closed by the caller otherwise.
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f = f
+	r.w = bufio.NewWriter(f)
+	r.size = fi.Size()
+	return nil
+}
+
+// close flushes the buffer and closes the current file, unless it's suspended.
+func (r *rotatingFile) close() error {
+	if r.f == nil {
+		return nil
+	}
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	if r.cfg.MaxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.cfg.MaxSize && r.size >= r.retryAt {
+		if err := r.rotate(); err != nil {
+			r.retryAt = r.size + r.cfg.MaxSize
+			if r.cfg.Log != nil {
+				r.cfg.Log.Error("error rotating output file, writing to the current one", slog.String("path", r.path),
+					slog.Any("error", err.Error()))
+			}
+		}
+	}
+
+	n, err := r.w.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Flush writes any buffered data to the file.
+func (r *rotatingFile) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	return r.w.Flush()
+}
+
+// Suspend closes the file until the next write, which opens it again in append mode.
+func (r *rotatingFile) Suspend() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	err := r.close()
+	r.f, r.w = nil, nil
+	return err
+}
+
+// Reopen reopens the file at the configured path. This allows external tools like logrotate
+// to move the file away. Suspended files are left closed, the current file is kept if the one
+// at path can't be opened.
+func (r *rotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return nil
+	}
+	f, w := r.f, r.w
+	if err := r.open(); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.close()
+}
+
+func (r *rotatingFile) rotatedName(n int) string {
+	name := fmt.Sprintf("%s.%d", r.path, n)
+	if r.cfg.Compress {
+		name += ".gz"
+	}
+	return name
+}
+
+// rotate moves the file away and opens a new one, unless it's suspended. The current file stays
+// open if moving it away or opening the new one fails, so no writes get lost.
+func (r *rotatingFile) rotate() error {
+	if r.f == nil {
+		moved, err := r.shift()
+		if err != nil {
+			return err
+		}
+		return r.compress(moved)
+	}
+
+	if err := r.w.Flush(); err != nil {
+		return err
+	}
+	// The open file keeps being written to under its new name until the new one is opened.
+	moved, err := r.shift()
+	if err != nil {
+		return err
+	}
+	f, w := r.f, r.w
+	if err := r.open(); err != nil {
+		if renameErr := os.Rename(moved, r.path); renameErr != nil {
+			return errors.Join(err, renameErr)
+		}
+		return err
+	}
+	r.retryAt = 0
+	if err := errors.Join(w.Flush(), f.Close()); err != nil {
+		return err
+	}
+	return r.compress(moved)
+}
+
+// shift renames the rotated files and moves the file at path to <path>.1, or to a temporary
+// name to compress it from with Compress. It returns the name the file was moved to.
+func (r *rotatingFile) shift() (string, error) {
+	maxFiles := max(r.cfg.MaxFiles, 1)
+	os.Remove(r.rotatedName(maxFiles))
+	for n := maxFiles - 1; n >= 1; n-- {
+		if err := os.Rename(r.rotatedName(n), r.rotatedName(n+1)); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	moved := r.rotatedName(1)
+	if r.cfg.Compress {
+		moved = r.path + ".rotating"
+	}
+	if err := os.Rename(r.path, moved); err != nil {
+		return "", err
+	}
+	return moved, nil
+}
+
+// compress gzips the file moved away by shift to <path>.1.gz, if Compress is set.
+func (r *rotatingFile) compress(moved string) error {
+	if !r.cfg.Compress {
+		return nil
+	}
+	if err := gzipFile(moved, r.rotatedName(1)); err != nil {
+		return err
+	}
+	return os.Remove(moved)
+}
+
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// Rotate rotates the file right away, regardless of its size.
+func (r *rotatingFile) Rotate() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rotate()
+}
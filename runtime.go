@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	containersapi "github.com/containerd/containerd/api/services/containers/v1"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// runtimeNegativeCacheTTL is how long unknown container IDs are remembered, so we don't ask
+// the runtime for every request of a container it doesn't know.
+const runtimeNegativeCacheTTL = 30 * time.Second
+
+type runtimeEnricherConfig struct {
+	// Runtime is either docker or containerd.
+	Runtime string
+	Socket  string
+	// Namespaces are the containerd namespaces to search for containers.
+	Namespaces []string
+}
+
+type runtimeContainerInfo struct {
+	name  string
+	image string
+}
+
+type runtimeCacheEntry struct {
+	info    runtimeContainerInfo
+	found   bool
+	fetched time.Time
+}
+
+// runtimeEnricher resolves container IDs to container and image names by asking the local
+// container runtime.
+type runtimeEnricher struct {
+	log     *slog.Logger
+	runtime string
+	lookup  func(ctx context.Context, id string) (runtimeContainerInfo, bool, error)
+
+	mu    sync.Mutex
+	cache map[string]runtimeCacheEntry
+}
+
+func newRuntimeEnricher(log *slog.Logger, cfg runtimeEnricherConfig) (*runtimeEnricher, error) {
+	e := &runtimeEnricher{
+		log:     log,
+		runtime: cfg.Runtime,
+		cache:   map[string]runtimeCacheEntry{},
+	}
+
+	switch cfg.Runtime {
+	case "docker":
+		socket := cfg.Socket
+		if socket == "" {
+			socket = "/var/run/docker.sock"
+		}
+		e.lookup = newDockerLookup(socket)
+	case "containerd":
+		socket := cfg.Socket
+		if socket == "" {
+			socket = "/run/containerd/containerd.sock"
+		}
+		lookup, err := newContainerdLookup(socket, cfg.Namespaces)
+		if err != nil {
+			return nil, err
+		}
+		e.lookup = lookup
+	default:
+		return nil, fmt.Errorf("unknown container runtime %q, expected docker or containerd", cfg.Runtime)
+	}
+
+	return e, nil
+}
+
+func (e *runtimeEnricher) enrich(attrs pcommon.Map) {
+	containerID, ok := attrs.Get("container.id")
+	if !ok || containerID.AsString() == "" {
+		return
+	}
+
+	info, ok := e.resolve(containerID.AsString())
+	if !ok {
+		return
+	}
+
+	putMissing(attrs, "container.runtime", e.runtime)
+	putMissing(attrs, "container.name", info.name)
+	if info.image == "" {
+		return
+	}
+	name, tag := splitImageReference(info.image)
+	putMissing(attrs, "container.image.name", name)
+	if _, ok := attrs.Get("container.image.tags"); !ok && tag != "" {
+		attrs.PutEmptySlice("container.image.tags").AppendEmpty().SetStr(tag)
+	}
+}
+
+func (e *runtimeEnricher) resolve(id string) (runtimeContainerInfo, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if entry, ok := e.cache[id]; ok && (entry.found || time.Since(entry.fetched) < runtimeNegativeCacheTTL) {
+		return entry.info, entry.found
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	info, found, err := e.lookup(ctx, id)
+	if err != nil {
+		e.log.Error("error looking up container", slog.String("container.id", id), slog.Any("error", err.Error()))
+	}
+	e.cache[id] = runtimeCacheEntry{info: info, found: found, fetched: time.Now()}
+	return info, found
+}
+
+// splitImageReference splits e.g. ghcr.io/foo/bar:1.2@sha256:... into its name and tag.
+func splitImageReference(ref string) (string, string) {
+	ref, _, _ = strings.Cut(ref, "@")
+	// A colon after the last slash separates the tag, any other colon belongs to the registry port.
+	if idx := strings.LastIndex(ref, ":"); idx > strings.LastIndex(ref, "/") {
+		return ref[:idx], ref[idx+1:]
+	}
+	return ref, ""
+}
+
+func newDockerLookup(socket string) func(ctx context.Context, id string) (runtimeContainerInfo, bool, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	return func(ctx context.Context, id string) (runtimeContainerInfo, bool, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker/containers/"+url.PathEscape(id)+"/json", nil)
+		if err != nil {
+			return runtimeContainerInfo{}, false, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return runtimeContainerInfo{}, false, err
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+		case http.StatusNotFound:
+			return runtimeContainerInfo{}, false, nil
+		default:
+			return runtimeContainerInfo{}, false, fmt.Errorf("unexpected status %s from docker", resp.Status)
+		}
+
+		var container struct {
+			Name   string `json:"Name"`
+			Config struct {
+				Image string `json:"Image"`
+			} `json:"Config"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&container); err != nil {
+			return runtimeContainerInfo{}, false, fmt.Errorf("error decoding container: %w", err)
+		}
+
+		return runtimeContainerInfo{
+			name:  strings.TrimPrefix(container.Name, "/"),
+			image: container.Config.Image,
+		}, true, nil
+	}
+}
+
+func newContainerdLookup(socket string, namespaces []string) (func(ctx context.Context, id string) (runtimeContainerInfo, bool, error), error) {
+	conn, err := grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to containerd: %w", err)
+	}
+	client := containersapi.NewContainersClient(conn)
+
+	return func(ctx context.Context, id string) (runtimeContainerInfo, bool, error) {
+		for _, ns := range namespaces {
+			resp, err := client.Get(metadata.AppendToOutgoingContext(ctx, "containerd-namespace", ns), &containersapi.GetContainerRequest{ID: id})
+			if status.Code(err) == codes.NotFound {
+				continue
+			}
+			if err != nil {
+				return runtimeContainerInfo{}, false, err
+			}
+
+			labels := resp.GetContainer().GetLabels()
+			name := labels["io.kubernetes.container.name"]
+			if name == "" {
+				name = labels["nerdctl/name"]
+			}
+			return runtimeContainerInfo{
+				name:  name,
+				image: resp.GetContainer().GetImage(),
+			}, true, nil
+		}
+		return runtimeContainerInfo{}, false, nil
+	}, nil
+}
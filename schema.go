@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log/slog"
+	"path"
+	"sync"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// schemaChecker warns about resource and scope schema URLs that are missing or refer to a
+// different semantic conventions version than expected, and reports which development version
+// of the profiles proto the payloads appear to use.
+type schemaChecker struct {
+	// expected is the semantic conventions version, e.g. 1.34.0.
+	expected string
+
+	mu sync.Mutex
+	// protoVersion is the last reported proto version.
+	protoVersion string
+}
+
+func (s *schemaChecker) check(log *slog.Logger, pd pprofile.Profiles) {
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rp := rps.At(i)
+		resource := resourceName(mapAttributes(rp.Resource().Attributes()))
+		s.checkURL(log, resource, "resource", rp.SchemaUrl())
+		sps := rp.ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			s.checkURL(log, resource, "scope "+sps.At(j).Scope().Name(), sps.At(j).SchemaUrl())
+		}
+	}
+
+	version := protoVersion(pd)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if version != s.protoVersion {
+		s.protoVersion = version
+		log.Info("profiles proto version", slog.String("version", version))
+	}
+}
+
+func (s *schemaChecker) checkURL(log *slog.Logger, resource, where, url string) {
+	if url == "" {
+		log.Warn("missing schema URL", slog.String("resource", resource), slog.String("where", where))
+		return
+	}
+	// Schema URLs end in the version, e.g. https://opentelemetry.io/schemas/1.34.0.
+	if version := path.Base(url); version != s.expected {
+		log.Warn("schema URL refers to a different semantic conventions version",
+			slog.String("resource", resource), slog.String("where", where),
+			slog.String("schema_url", url), slog.String("expected", s.expected))
+	}
+}
+
+// protoVersion guesses the development version of the profiles proto the payload was encoded
+// with. The server decodes v1.9.0, older payloads decode without error but lose the fields
+// that were moved, most notably the samples lose their stacks.
+func protoVersion(pd pprofile.Profiles) string {
+	dict := pd.Dictionary()
+	samples := 0
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		sps := rps.At(i).ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			pcs := sps.At(j).Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				samples += pcs.At(k).Samples().Len()
+			}
+		}
+	}
+
+	switch {
+	case samples == 0:
+		return "unknown (no samples)"
+	case dict.StackTable().Len() > 1:
+		return "v1.9.0 (stack table)"
+	case dict.StringTable().Len() <= 1:
+		return "pre-v1.8.0 (no request dictionary, all profile data lost)"
+	default:
+		return "pre-v1.9.0 (samples don't reference stacks, frames lost)"
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// semconvAttributes are the attributes of the semantic conventions commonly found on
+// profiles, with the type of their value.
+var semconvAttributes = map[string]pcommon.ValueType{
+	"service.name":                        pcommon.ValueTypeStr,
+	"service.namespace":                   pcommon.ValueTypeStr,
+	"service.version":                     pcommon.ValueTypeStr,
+	"service.instance.id":                 pcommon.ValueTypeStr,
+	"host.name":                           pcommon.ValueTypeStr,
+	"host.id":                             pcommon.ValueTypeStr,
+	"host.arch":                           pcommon.ValueTypeStr,
+	"host.ip":                             pcommon.ValueTypeSlice,
+	"host.mac":                            pcommon.ValueTypeSlice,
+	"os.type":                             pcommon.ValueTypeStr,
+	"os.version":                          pcommon.ValueTypeStr,
+	"os.name":                             pcommon.ValueTypeStr,
+	"os.description":                      pcommon.ValueTypeStr,
+	"container.id":                        pcommon.ValueTypeStr,
+	"container.name":                      pcommon.ValueTypeStr,
+	"container.image.name":                pcommon.ValueTypeStr,
+	"container.image.id":                  pcommon.ValueTypeStr,
+	"container.runtime":                   pcommon.ValueTypeStr,
+	"k8s.cluster.name":                    pcommon.ValueTypeStr,
+	"k8s.node.name":                       pcommon.ValueTypeStr,
+	"k8s.namespace.name":                  pcommon.ValueTypeStr,
+	"k8s.pod.name":                        pcommon.ValueTypeStr,
+	"k8s.pod.uid":                         pcommon.ValueTypeStr,
+	"k8s.container.name":                  pcommon.ValueTypeStr,
+	"k8s.deployment.name":                 pcommon.ValueTypeStr,
+	"k8s.daemonset.name":                  pcommon.ValueTypeStr,
+	"k8s.statefulset.name":                pcommon.ValueTypeStr,
+	"k8s.replicaset.name":                 pcommon.ValueTypeStr,
+	"k8s.job.name":                        pcommon.ValueTypeStr,
+	"k8s.cronjob.name":                    pcommon.ValueTypeStr,
+	"cloud.provider":                      pcommon.ValueTypeStr,
+	"cloud.platform":                      pcommon.ValueTypeStr,
+	"cloud.region":                        pcommon.ValueTypeStr,
+	"cloud.availability_zone":             pcommon.ValueTypeStr,
+	"cloud.account.id":                    pcommon.ValueTypeStr,
+	"cloud.resource_id":                   pcommon.ValueTypeStr,
+	"deployment.environment.name":         pcommon.ValueTypeStr,
+	"telemetry.sdk.name":                  pcommon.ValueTypeStr,
+	"telemetry.sdk.language":              pcommon.ValueTypeStr,
+	"telemetry.sdk.version":               pcommon.ValueTypeStr,
+	"process.pid":                         pcommon.ValueTypeInt,
+	"process.parent_pid":                  pcommon.ValueTypeInt,
+	"process.executable.name":             pcommon.ValueTypeStr,
+	"process.executable.path":             pcommon.ValueTypeStr,
+	"process.executable.build_id.gnu":     pcommon.ValueTypeStr,
+	"process.executable.build_id.go":      pcommon.ValueTypeStr,
+	"process.executable.build_id.htlhash": pcommon.ValueTypeStr,
+	"process.command":                     pcommon.ValueTypeStr,
+	"process.command_line":                pcommon.ValueTypeStr,
+	"process.command_args":                pcommon.ValueTypeSlice,
+	"process.owner":                       pcommon.ValueTypeStr,
+	"process.runtime.name":                pcommon.ValueTypeStr,
+	"process.runtime.version":             pcommon.ValueTypeStr,
+	"thread.id":                           pcommon.ValueTypeInt,
+	"thread.name":                         pcommon.ValueTypeStr,
+	"cpu.logical_number":                  pcommon.ValueTypeInt,
+	"profile.frame.type":                  pcommon.ValueTypeStr,
+}
+
+// semconvFrameTypes are the allowed values of profile.frame.type.
+var semconvFrameTypes = []string{
+	"beam", "cpython", "dotnet", "go", "jvm", "kernel", "native", "perl", "php", "ruby", "rust", "v8js",
+}
+
+// semconvIssue is a deviation from the semantic conventions, where is resource, sample,
+// location or mapping.
+type semconvIssue struct {
+	where   string
+	message string
+}
+
+// semconvLinter checks the attributes of received profiles against the semantic conventions.
+// Every distinct issue is logged once and counted for the summary.
+type semconvLinter struct {
+	// namespaces are the first components of the known attributes. Unknown keys in these
+	// namespaces are reported, all others are considered custom attributes.
+	namespaces map[string]bool
+	// normalized maps the known keys without separators and in lower case to the key, to
+	// detect misnamed keys like container_id or process.PID.
+	normalized map[string]string
+
+	mu     sync.Mutex
+	issues map[semconvIssue]int64
+}
+
+func newSemconvLinter() *semconvLinter {
+	l := &semconvLinter{
+		namespaces: map[string]bool{},
+		normalized: map[string]string{},
+		issues:     map[semconvIssue]int64{},
+	}
+	for key := range semconvAttributes {
+		l.namespaces[strings.SplitN(key, ".", 2)[0]] = true
+		l.normalized[normalizeAttributeKey(key)] = key
+	}
+	return l
+}
+
+func normalizeAttributeKey(key string) string {
+	return strings.ToLower(strings.NewReplacer(".", "", "_", "", "-", "").Replace(key))
+}
+
+func (l *semconvLinter) check(log *slog.Logger, pd pprofile.Profiles) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dict := pd.Dictionary()
+	lookup := dump.NewLookup(dict)
+	checkIndices := func(where string, indices pcommon.Int32Slice) {
+		for _, idx := range indices.All() {
+			if attr, ok := lookup.Attribute(idx); ok {
+				l.checkAttribute(log, where, lookup.String(attr.KeyStrindex()), attr.Value())
+			}
+		}
+	}
+
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rps.At(i).Resource().Attributes().Range(func(k string, v pcommon.Value) bool {
+			l.checkAttribute(log, "resource", k, v)
+			return true
+		})
+		sps := rps.At(i).ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			pcs := sps.At(j).Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				samples := pcs.At(k).Samples()
+				for s := 0; s < samples.Len(); s++ {
+					checkIndices("sample", samples.At(s).AttributeIndices())
+				}
+			}
+		}
+	}
+	for i := 0; i < dict.LocationTable().Len(); i++ {
+		checkIndices("location", dict.LocationTable().At(i).AttributeIndices())
+	}
+	for i := 0; i < dict.MappingTable().Len(); i++ {
+		checkIndices("mapping", dict.MappingTable().At(i).AttributeIndices())
+	}
+}
+
+func (l *semconvLinter) checkAttribute(log *slog.Logger, where, key string, value pcommon.Value) {
+	expected, known := semconvAttributes[key]
+	switch {
+	case !known:
+		if match, ok := l.normalized[normalizeAttributeKey(key)]; ok {
+			l.report(log, where, fmt.Sprintf("misnamed attribute %q, expected %q", key, match))
+		} else if l.namespaces[strings.SplitN(key, ".", 2)[0]] {
+			l.report(log, where, fmt.Sprintf("unknown attribute %q", key))
+		}
+	case value.Type() != expected:
+		l.report(log, where, fmt.Sprintf("attribute %q has type %s, expected %s", key, value.Type(), expected))
+	case key == "profile.frame.type" && !slices.Contains(semconvFrameTypes, value.Str()):
+		l.report(log, where, fmt.Sprintf("unknown profile.frame.type value %q", value.Str()))
+	}
+}
+
+func (l *semconvLinter) report(log *slog.Logger, where, message string) {
+	issue := semconvIssue{where: where, message: message}
+	if l.issues[issue] == 0 {
+		log.Warn("semantic convention violation", slog.String("where", where), slog.String("issue", message))
+	}
+	l.issues[issue]++
+}
+
+func (l *semconvLinter) printSummary(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.issues) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "------------- Semantic conventions ----------------")
+	issues := slices.SortedFunc(maps.Keys(l.issues), func(a, b semconvIssue) int {
+		return strings.Compare(a.where+a.message, b.where+b.message)
+	})
+	for _, issue := range issues {
+		fmt.Fprintf(w, "  %s: %s (%d times)\n", issue.where, issue.message, l.issues[issue])
+	}
+	fmt.Fprintln(w, "---------------------------------------------------")
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// tracesServer dumps received spans, so they can be correlated with the trace IDs of profile
+// sample links.
+type tracesServer struct {
+	ptraceotlp.UnimplementedGRPCServer
+	log     *slog.Logger
+	dumpLog *slog.Logger
+	config  func() Config
+}
+
+func (t *tracesServer) Export(ctx context.Context, request ptraceotlp.ExportRequest) (ptraceotlp.ExportResponse, error) {
+	t.log.Info("received trace export request",
+		slog.Int("resource_spans", request.Traces().ResourceSpans().Len()),
+		slog.Int("spans", request.Traces().SpanCount()))
+
+	c := dump.NewColorizer(t.config().Color)
+	rss := request.Traces().ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		rs := rss.At(i)
+		t.dumpLog.Info(c.ResourceSeparator("---------------- New Resource Spans ---------------"))
+		dumpSignalResource(t.dumpLog, t.config(), c, rs.Resource().Attributes())
+
+		sss := rs.ScopeSpans()
+		for j := 0; j < sss.Len(); j++ {
+			spans := sss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				span := spans.At(k)
+				t.dumpLog.Info(fmt.Sprintf("  Span: %s, TraceID: %s, SpanID: %s, ParentSpanID: %s, Start: %v, Duration: %v",
+					span.Name(), span.TraceID(), span.SpanID(), span.ParentSpanID(),
+					span.StartTimestamp().AsTime(), span.EndTimestamp().AsTime().Sub(span.StartTimestamp().AsTime())))
+			}
+		}
+		t.dumpLog.Info(c.ResourceSeparator("---------------- End Resource Spans ---------------") + "\n")
+	}
+
+	return ptraceotlp.NewExportResponse(), nil
+}
+
+// logsServer dumps received log records along with their trace context.
+type logsServer struct {
+	plogotlp.UnimplementedGRPCServer
+	log     *slog.Logger
+	dumpLog *slog.Logger
+	config  func() Config
+}
+
+func (l *logsServer) Export(ctx context.Context, request plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	l.log.Info("received log export request",
+		slog.Int("resource_logs", request.Logs().ResourceLogs().Len()),
+		slog.Int("log_records", request.Logs().LogRecordCount()))
+
+	c := dump.NewColorizer(l.config().Color)
+	rls := request.Logs().ResourceLogs()
+	for i := 0; i < rls.Len(); i++ {
+		rl := rls.At(i)
+		l.dumpLog.Info(c.ResourceSeparator("---------------- New Resource Logs ----------------"))
+		dumpSignalResource(l.dumpLog, l.config(), c, rl.Resource().Attributes())
+
+		sls := rl.ScopeLogs()
+		for j := 0; j < sls.Len(); j++ {
+			records := sls.At(j).LogRecords()
+			for k := 0; k < records.Len(); k++ {
+				record := records.At(k)
+				l.dumpLog.Info(fmt.Sprintf("  Log: %v [%s] %s, TraceID: %s, SpanID: %s",
+					record.Timestamp().AsTime().Format(time.RFC3339Nano), record.SeverityText(),
+					record.Body().AsString(), record.TraceID(), record.SpanID()))
+			}
+		}
+		l.dumpLog.Info(c.ResourceSeparator("---------------- End Resource Logs ----------------") + "\n")
+	}
+
+	return plogotlp.NewExportResponse(), nil
+}
+
+func dumpSignalResource(log *slog.Logger, config Config, c dump.Colorizer, attrs pcommon.Map) {
+	if !config.ExportResourceAttributes {
+		return
+	}
+	attrs.Range(func(k string, v pcommon.Value) bool {
+		log.Info(fmt.Sprintf("  %s: %v", c.Key(k), dump.Truncate(v.AsString(), config.MaxAttributeLength)))
+		return true
+	})
+}
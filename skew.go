@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+// clockSkewDetector compares the time of received profiles and their samples against the
+// receive time. A positive drift means the data is older than expected, e.g. because it was
+// delayed or the clock of the sender is behind, a negative one that it's from the future.
+type clockSkewDetector struct {
+	threshold time.Duration
+
+	mu        sync.Mutex
+	resources map[string]*resourceSkew
+}
+
+// resourceSkew summarizes the drift of the profiles of a resource.
+type resourceSkew struct {
+	profiles int64
+	min, max time.Duration
+	sum      time.Duration
+}
+
+func newClockSkewDetector(threshold time.Duration) *clockSkewDetector {
+	return &clockSkewDetector{
+		threshold: threshold,
+		resources: map[string]*resourceSkew{},
+	}
+}
+
+// check warns about every profile whose end or sample timestamps drift from now by more than
+// the threshold.
+func (d *clockSkewDetector) check(log *slog.Logger, now time.Time, pd pprofile.Profiles) {
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rp := rps.At(i)
+		resource := resourceName(mapAttributes(rp.Resource().Attributes()))
+
+		sps := rp.ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			pcs := sps.At(j).Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				profile := pcs.At(k)
+				end := profile.Time().AsTime().Add(time.Duration(profile.DurationNano()))
+				drift := now.Sub(end)
+				d.record(resource, drift)
+
+				if abs(drift) > d.threshold {
+					log.Warn("profile time drifts from receive time",
+						slog.String("resource", resource),
+						slog.String("profile_id", profile.ProfileID().String()),
+						slog.Time("profile_end", end),
+						slog.Duration("drift", drift))
+				}
+
+				var maxDrift time.Duration
+				samples := profile.Samples()
+				for l := 0; l < samples.Len(); l++ {
+					for _, ts := range samples.At(l).TimestampsUnixNano().All() {
+						if sd := now.Sub(time.Unix(0, int64(ts))); abs(sd) > abs(maxDrift) {
+							maxDrift = sd
+						}
+					}
+				}
+				if abs(maxDrift) > d.threshold {
+					log.Warn("sample timestamps drift from receive time",
+						slog.String("resource", resource),
+						slog.String("profile_id", profile.ProfileID().String()),
+						slog.Duration("max_drift", maxDrift))
+				}
+			}
+		}
+	}
+}
+
+func (d *clockSkewDetector) record(resource string, drift time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	rs, ok := d.resources[resource]
+	if !ok {
+		rs = &resourceSkew{min: drift, max: drift}
+		d.resources[resource] = rs
+	}
+	rs.profiles++
+	rs.sum += drift
+	rs.min = min(rs.min, drift)
+	rs.max = max(rs.max, drift)
+}
+
+func (d *clockSkewDetector) printSummary(w io.Writer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.resources) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "------------------- Clock skew --------------------")
+	for _, name := range slices.Sorted(maps.Keys(d.resources)) {
+		rs := d.resources[name]
+		fmt.Fprintf(w, "  %s: profiles=%d min=%v max=%v avg=%v\n", name, rs.profiles,
+			rs.min.Round(time.Millisecond), rs.max.Round(time.Millisecond),
+			(rs.sum / time.Duration(rs.profiles)).Round(time.Millisecond))
+	}
+	fmt.Fprintln(w, "---------------------------------------------------")
+}
+
+// resourceName identifies a resource by the attributes most likely to tell senders apart, for
+// log messages and summaries.
+func resourceName(attrs map[string]string) string {
+	var parts []string
+	for _, k := range []string{"service.name", "host.name", "container.id"} {
+		if v := attrs[k]; v != "" {
+			parts = append(parts, k+"="+v)
+		}
+	}
+	if len(parts) == 0 {
+		return "unknown"
+	}
+	return strings.Join(parts, ",")
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// splitOutput writes the dump of every resource into its own file, named after the value of a
+// resource attribute. Resources without the attribute are dumped to the fallback logger. Only
+// the maxOpen most recently used files are kept open, the others are suspended.
+type splitOutput struct {
+	attribute  string
+	dir        string
+	rotation   rotationConfig
+	maxOpen    int
+	newHandler func(w io.Writer) slog.Handler
+	fallback   *slog.Logger
+
+	mu    sync.Mutex
+	files map[string]*splitFile
+	// open holds the open files, most recently used first.
+	open *list.List
+}
+
+type splitFile struct {
+	f   *rotatingFile
+	log *slog.Logger
+	// elem is the element of the file in splitOutput.open, nil while it's suspended.
+	elem *list.Element
+}
+
+func newSplitOutput(attribute, dir string, rotation rotationConfig, maxOpen int, newHandler func(w io.Writer) slog.Handler, fallback *slog.Logger) (*splitOutput, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &splitOutput{
+		attribute:  attribute,
+		dir:        dir,
+		rotation:   rotation,
+		maxOpen:    max(maxOpen, 1),
+		newHandler: newHandler,
+		fallback:   fallback,
+		files:      map[string]*splitFile{},
+		open:       list.New(),
+	}, nil
+}
+
+// dump writes every resource to its file. Errors closing suspended files are returned after
+// dumping all resources.
+func (s *splitOutput) dump(config Config, pd pprofile.Profiles) error {
+	var errs []error
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rp := rps.At(i)
+
+		v, ok := rp.Resource().Attributes().Get(s.attribute)
+		if !ok || v.AsString() == "" {
+			dump.ResourceProfile(s.fallback, config.Config, pd.Dictionary(), rp)
+			continue
+		}
+
+		log, err := s.logger(v.AsString())
+		if log == nil {
+			return err
+		}
+		errs = append(errs, err)
+		dump.ResourceProfile(log, config.Config, pd.Dictionary(), rp)
+	}
+	return errors.Join(errs...)
+}
+
+// logger returns the logger writing to the file of the given attribute value, opening the file
+// on first use. It suspends the least recently used files exceeding maxOpen.
+func (s *splitOutput) logger(value string) (*slog.Logger, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sf, ok := s.files[value]
+	if !ok {
+		f, err := openRotatingFile(filepath.Join(s.dir, splitFileName(value)), s.rotation)
+		if err != nil {
+			return nil, err
+		}
+		sf = &splitFile{
+			f:   f,
+			log: slog.New(s.newHandler(f)),
+		}
+		s.files[value] = sf
+	}
+	if sf.elem != nil {
+		s.open.MoveToFront(sf.elem)
+		return sf.log, nil
+	}
+
+	// A suspended file is opened again by its next write.
+	sf.elem = s.open.PushFront(sf)
+	var errs []error
+	for s.open.Len() > s.maxOpen {
+		lru := s.open.Remove(s.open.Back()).(*splitFile)
+		lru.elem = nil
+		errs = append(errs, lru.f.Suspend())
+	}
+	return sf.log, errors.Join(errs...)
+}
+
+// splitFileName turns an attribute value into the name of its log file. Values changed to
+// be safe get a hash of the original value appended, so e.g. a/b and a_b don't share a file.
+func splitFileName(value string) string {
+	name := safeFileName(value)
+	if name != value {
+		h := fnv.New32a()
+		h.Write([]byte(value))
+		name += fmt.Sprintf("-%08x", h.Sum32())
+	}
+	return name + ".log"
+}
+
+// safeFileName turns a value into a safe file name, replacing everything but letters, digits,
+// dots, dashes and underscores.
+func safeFileName(value string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, value)
+	if strings.Trim(name, ".") == "" {
+		name = "_" + name
+	}
+	return name
+}
+
+// Flush writes the buffered data of all files.
+func (s *splitOutput) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, sf := range s.files {
+		errs = append(errs, sf.f.Flush())
+	}
+	return errors.Join(errs...)
+}
+
+// Reopen reopens all files, see rotatingFile.Reopen.
+func (s *splitOutput) Reopen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, sf := range s.files {
+		errs = append(errs, sf.f.Reopen())
+	}
+	return errors.Join(errs...)
+}
+
+// Rotate rotates all files, see rotatingFile.Rotate.
+func (s *splitOutput) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, sf := range s.files {
+		errs = append(errs, sf.f.Rotate())
+	}
+	return errors.Join(errs...)
+}
+
+func (s *splitOutput) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, sf := range s.files {
+		errs = append(errs, sf.f.Close())
+	}
+	return errors.Join(errs...)
+}
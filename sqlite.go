@@ -0,0 +1,233 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS requests (
+	id INTEGER PRIMARY KEY,
+	received_at TIMESTAMP NOT NULL
+);
+CREATE TABLE IF NOT EXISTS resources (
+	id INTEGER PRIMARY KEY,
+	attributes TEXT NOT NULL UNIQUE,
+	schema_url TEXT
+);
+CREATE TABLE IF NOT EXISTS profiles (
+	id INTEGER PRIMARY KEY,
+	request_id INTEGER NOT NULL REFERENCES requests(id),
+	resource_id INTEGER NOT NULL REFERENCES resources(id),
+	profile_id TEXT,
+	scope_name TEXT,
+	scope_version TEXT,
+	time TIMESTAMP,
+	duration_nano INTEGER,
+	sample_type TEXT,
+	sample_unit TEXT,
+	period_type TEXT,
+	period_unit TEXT,
+	period INTEGER,
+	dropped_attributes_count INTEGER,
+	attributes TEXT
+);
+CREATE TABLE IF NOT EXISTS stacks (
+	id INTEGER PRIMARY KEY,
+	folded TEXT NOT NULL UNIQUE,
+	depth INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS frames (
+	stack_id INTEGER NOT NULL REFERENCES stacks(id),
+	position INTEGER NOT NULL,
+	type TEXT,
+	function TEXT,
+	file TEXT,
+	line INTEGER,
+	address INTEGER,
+	mapping TEXT,
+	inlined BOOLEAN,
+	PRIMARY KEY (stack_id, position)
+);
+CREATE TABLE IF NOT EXISTS samples (
+	id INTEGER PRIMARY KEY,
+	profile_id INTEGER NOT NULL REFERENCES profiles(id),
+	stack_id INTEGER REFERENCES stacks(id),
+	value INTEGER,
+	"values" TEXT,
+	timestamps TEXT,
+	attributes TEXT
+);
+`
+
+// sqliteStore persists received profiles into a SQLite database, so captures can be analyzed
+// after the fact, see the query subcommand.
+type sqliteStore struct {
+	log *slog.Logger
+
+	mu sync.Mutex
+	db *sql.DB
+}
+
+func openSQLiteStore(log *slog.Logger, path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only supports a single writer anyway.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating schema: %w", err)
+	}
+	return &sqliteStore{log: log, db: db}, nil
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// forward stores all profiles of a request. Like backends, the store keeps everything it
+// receives regardless of the dump filters, so queries aren't limited by them.
+func (s *sqliteStore) forward(pd pprofile.Profiles) {
+	if err := s.store(time.Now(), resolveProfiles(Config{}, pd)); err != nil {
+		s.log.Error("error storing profiles", slog.Any("error", err.Error()))
+	}
+}
+
+// store writes the profiles of a single request in one transaction.
+func (s *sqliteStore) store(receivedAt time.Time, views []profileView) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	res, err := tx.Exec(`INSERT INTO requests (received_at) VALUES (?)`, receivedAt.UTC())
+	if err != nil {
+		return err
+	}
+	requestID, _ := res.LastInsertId()
+
+	for _, view := range views {
+		resourceID, err := s.upsertResource(tx, view.Resource)
+		if err != nil {
+			return err
+		}
+
+		p := view.Profile
+		res, err := tx.Exec(`INSERT INTO profiles (request_id, resource_id, profile_id, scope_name, scope_version, time,
+			duration_nano, sample_type, sample_unit, period_type, period_unit, period, dropped_attributes_count, attributes)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			requestID, resourceID, p.ProfileID, view.Scope.Name, view.Scope.Version, p.Time.UTC(),
+			int64(p.Duration), p.SampleType, p.SampleUnit, p.PeriodType, p.PeriodUnit, p.Period,
+			p.DroppedAttributesCount, jsonString(p.Attributes))
+		if err != nil {
+			return err
+		}
+		profileID, _ := res.LastInsertId()
+
+		for _, sample := range p.Samples {
+			stackID, err := s.upsertStack(tx, sample.Frames)
+			if err != nil {
+				return err
+			}
+
+			// value sums up the values of samples with one per timestamp, "values" keeps them.
+			if _, err := tx.Exec(`INSERT INTO samples (profile_id, stack_id, value, "values", timestamps, attributes)
+				VALUES (?, ?, ?, ?, ?, ?)`,
+				profileID, stackID, sample.total(), jsonString(sample.Values), jsonString(sample.Timestamps),
+				jsonString(sample.Attributes)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteStore) upsertResource(tx *sql.Tx, resource resourceView) (int64, error) {
+	attrs := jsonString(resource.Attributes)
+	if _, err := tx.Exec(`INSERT INTO resources (attributes, schema_url) VALUES (?, ?) ON CONFLICT (attributes) DO NOTHING`,
+		attrs, resource.SchemaURL); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	err := tx.QueryRow(`SELECT id FROM resources WHERE attributes = ?`, attrs).Scan(&id)
+	return id, err
+}
+
+func (s *sqliteStore) upsertStack(tx *sql.Tx, frames []frameView) (int64, error) {
+	folded := foldFrames(frames)
+
+	var id int64
+	err := tx.QueryRow(`SELECT id FROM stacks WHERE folded = ?`, folded).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	res, err := tx.Exec(`INSERT INTO stacks (folded, depth) VALUES (?, ?)`, folded, len(frames))
+	if err != nil {
+		return 0, err
+	}
+	id, _ = res.LastInsertId()
+
+	for i, f := range frames {
+		if _, err := tx.Exec(`INSERT INTO frames (stack_id, position, type, function, file, line, address, mapping, inlined)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, i, f.Type, f.Function, f.File, f.Line, int64(f.Address), f.Mapping, f.Inlined); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// foldFrames renders the frames root first and separated by semicolons, just like the collapsed
+// stack format used by flamegraph tools.
+func foldFrames(frames []frameView) string {
+	parts := make([]string, 0, len(frames))
+	for i := len(frames) - 1; i >= 0; i-- {
+		parts = append(parts, frameName(frames[i]))
+	}
+	return strings.Join(parts, ";")
+}
+
+// frameName returns the function name of the frame, or its address and mapping for frames
+// that are not symbolized.
+func frameName(f frameView) string {
+	if f.Function != "" {
+		return f.Function
+	}
+	if f.Mapping != "" {
+		return fmt.Sprintf("%s+%#x", f.Mapping, f.Address)
+	}
+	return fmt.Sprintf("%#x", f.Address)
+}
+
+func jsonString(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runStats keeps track of everything received during the lifetime of the server.
+type runStats struct {
+	started time.Time
+
+	requests         atomic.Int64
+	resourceProfiles atomic.Int64
+	profiles         atomic.Int64
+	samples          atomic.Int64
+	// dumpsDropped counts requests that were not dumped as the dump queue was full.
+	dumpsDropped atomic.Int64
+	// requestsRejected counts requests rejected by -max-request-size or -memory-budget.
+	requestsRejected atomic.Int64
+	// corruptRequests counts requests referencing dictionary entries that don't exist.
+	corruptRequests atomic.Int64
+	// stringTableIssues counts requests with a malformed string table.
+	stringTableIssues atomic.Int64
+
+	mu sync.Mutex
+	// tenantProfiles counts the profiles by tenant, if -tenant-header is set.
+	tenantProfiles map[string]int64
+	// compression sums up the request sizes by compression algorithm.
+	compression map[string]*compressionTotals
+}
+
+// compressionTotals are the running totals of the requests received with one compression
+// algorithm.
+type compressionTotals struct {
+	Requests          int64 `json:"requests"`
+	CompressedBytes   int64 `json:"compressed_bytes"`
+	UncompressedBytes int64 `json:"uncompressed_bytes"`
+}
+
+// ratio returns the uncompressed size divided by the compressed size.
+func (t compressionTotals) ratio() float64 {
+	if t.CompressedBytes == 0 {
+		return 0
+	}
+	return float64(t.UncompressedBytes) / float64(t.CompressedBytes)
+}
+
+func newRunStats() *runStats {
+	return &runStats{
+		started:        time.Now(),
+		tenantProfiles: map[string]int64{},
+		compression:    map[string]*compressionTotals{},
+	}
+}
+
+// recordCompression adds the sizes of a request to the totals of its compression algorithm
+// and returns the updated totals.
+func (s *runStats) recordCompression(algorithm string, compressed, uncompressed int) compressionTotals {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.compression[algorithm]
+	if !ok {
+		t = &compressionTotals{}
+		s.compression[algorithm] = t
+	}
+	t.Requests++
+	t.CompressedBytes += int64(compressed)
+	t.UncompressedBytes += int64(uncompressed)
+	return *t
+}
+
+// compressionSnapshot returns the totals by compression algorithm.
+func (s *runStats) compressionSnapshot() map[string]compressionTotals {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make(map[string]compressionTotals, len(s.compression))
+	for algorithm, t := range s.compression {
+		out[algorithm] = *t
+	}
+	return out
+}
+
+func (s *runStats) printSummary(w io.Writer, resources int) {
+	fmt.Fprintln(w, "-------------------- Summary ----------------------")
+	fmt.Fprintf(w, "  Uptime: %v\n", time.Since(s.started).Round(time.Millisecond))
+	fmt.Fprintf(w, "  Requests: %d\n", s.requests.Load())
+	fmt.Fprintf(w, "  Resource profiles: %d\n", s.resourceProfiles.Load())
+	fmt.Fprintf(w, "  Distinct resources: %d\n", resources)
+	fmt.Fprintf(w, "  Profiles: %d\n", s.profiles.Load())
+	fmt.Fprintf(w, "  Samples: %d\n", s.samples.Load())
+	if dropped := s.dumpsDropped.Load(); dropped > 0 {
+		fmt.Fprintf(w, "  Dropped dumps: %d\n", dropped)
+	}
+	if rejected := s.requestsRejected.Load(); rejected > 0 {
+		fmt.Fprintf(w, "  Rejected requests: %d\n", rejected)
+	}
+	if corrupt := s.corruptRequests.Load(); corrupt > 0 {
+		fmt.Fprintf(w, "  Requests with invalid references: %d\n", corrupt)
+	}
+	if issues := s.stringTableIssues.Load(); issues > 0 {
+		fmt.Fprintf(w, "  Requests with string table issues: %d\n", issues)
+	}
+	s.mu.Lock()
+	for _, tenant := range slices.Sorted(maps.Keys(s.tenantProfiles)) {
+		fmt.Fprintf(w, "  Profiles of tenant %s: %d\n", tenant, s.tenantProfiles[tenant])
+	}
+	for _, algorithm := range slices.Sorted(maps.Keys(s.compression)) {
+		t := s.compression[algorithm]
+		fmt.Fprintf(w, "  Compression %s: %d requests, %d bytes compressed, %d bytes uncompressed (ratio %.2f)\n",
+			algorithm, t.Requests, t.CompressedBytes, t.UncompressedBytes, t.ratio())
+	}
+	s.mu.Unlock()
+	fmt.Fprintln(w, "---------------------------------------------------")
+}
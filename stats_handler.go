@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+)
+
+type requestInfoKey struct{}
+
+// requestInfo holds transport level details about a single RPC, that are not available to the
+// service handler itself.
+type requestInfo struct {
+	mu          sync.Mutex
+	compression string
+	peer        string
+	metadata    metadata.MD
+
+	// compressedSize and uncompressedSize are the size of the request message on the wire and
+	// after decompression.
+	compressedSize   int
+	uncompressedSize int
+	// received is when the request headers arrived, decoded when the message was decoded.
+	received time.Time
+	decoded  time.Time
+	// payload is the protobuf encoded request as received, if the transport has it. gRPC only
+	// hands out the decoded message.
+	payload []byte
+}
+
+func (r *requestInfo) Compression() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.compression == "" {
+		return "none"
+	}
+	return r.compression
+}
+
+// LogAttrs returns the peer address, user agent and request metadata as log attributes.
+// Credentials are redacted.
+func (r *requestInfo) LogAttrs() []slog.Attr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attrs := []slog.Attr{
+		slog.String("peer", r.peer),
+		slog.String("user_agent", strings.Join(r.metadata.Get("user-agent"), " ")),
+	}
+
+	var headers []any
+	for _, k := range slices.Sorted(maps.Keys(r.metadata)) {
+		v := strings.Join(r.metadata[k], ",")
+		if k == "authorization" || k == "proxy-authorization" {
+			v = "<redacted>"
+		}
+		headers = append(headers, slog.String(k, v))
+	}
+	return append(attrs, slog.Group("metadata", headers...))
+}
+
+// SizeAttrs returns the request size and the time it took to receive and decode the request
+// as log attributes.
+func (r *requestInfo) SizeAttrs() []slog.Attr {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attrs := []slog.Attr{
+		slog.Int("compressed_size", r.compressedSize),
+		slog.Int("uncompressed_size", r.uncompressedSize),
+	}
+	if r.compressedSize > 0 {
+		attrs = append(attrs, slog.String("compression_ratio", fmt.Sprintf("%.2f", float64(r.uncompressedSize)/float64(r.compressedSize))))
+	}
+	if !r.received.IsZero() && !r.decoded.IsZero() {
+		attrs = append(attrs, slog.Duration("decode_time", r.decoded.Sub(r.received)))
+	}
+	return attrs
+}
+
+// CompressedSize returns the size of the request message on the wire.
+func (r *requestInfo) CompressedSize() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.compressedSize
+}
+
+// UncompressedSize returns the size of the request message after decompression.
+func (r *requestInfo) UncompressedSize() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.uncompressedSize
+}
+
+// Metadata returns the values of a request metadata key, or HTTP header, joined by commas.
+func (r *requestInfo) Metadata(key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.metadata.Get(key), ",")
+}
+
+func requestInfoFromContext(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if info == nil {
+		return &requestInfo{}
+	}
+	return info
+}
+
+// requestInfoHandler is a stats.Handler collecting the requestInfo for every RPC.
+type requestInfoHandler struct{}
+
+func (h *requestInfoHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, &requestInfo{})
+}
+
+func (h *requestInfoHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	info, ok := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if !ok {
+		return
+	}
+
+	switch s := s.(type) {
+	case *stats.InHeader:
+		info.mu.Lock()
+		info.compression = s.Compression
+		info.metadata = s.Header
+		if s.RemoteAddr != nil {
+			info.peer = s.RemoteAddr.String()
+		}
+		info.received = time.Now()
+		info.mu.Unlock()
+	case *stats.InPayload:
+		info.mu.Lock()
+		info.compressedSize = s.CompressedLength
+		info.uncompressedSize = s.Length
+		info.decoded = s.RecvTime
+		info.mu.Unlock()
+	}
+}
+
+func (h *requestInfoHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *requestInfoHandler) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// profileStream fans out received profiles to live subscribers via Server-Sent Events. Slow
+// subscribers do not block the pipeline, profiles that don't fit their buffer are dropped.
+type profileStream struct {
+	mu          sync.Mutex
+	subscribers map[chan []byte]struct{}
+	dropped     atomic.Int64
+}
+
+func newProfileStream() *profileStream {
+	return &profileStream{
+		subscribers: map[chan []byte]struct{}{},
+	}
+}
+
+func (s *profileStream) hasSubscribers() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscribers) > 0
+}
+
+func (s *profileStream) publish(views []profileView) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, view := range views {
+		data, err := json.Marshal(view)
+		if err != nil {
+			continue
+		}
+		for ch := range s.subscribers {
+			select {
+			case ch <- data:
+			default:
+				s.dropped.Add(1)
+			}
+		}
+	}
+}
+
+func (s *profileStream) subscribe() (<-chan []byte, func()) {
+	ch := make(chan []byte, 64)
+
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subscribers, ch)
+		s.mu.Unlock()
+	}
+}
+
+func (s *profileStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch, unsubscribe := s.subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data := <-ch:
+			fmt.Fprintf(w, "event: profile\ndata: %s\n\n", data)
+			flusher.Flush()
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
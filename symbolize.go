@@ -0,0 +1,263 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// buildIDAttribute is the mapping attribute holding the GNU build ID of the mapped file.
+const buildIDAttribute = "process.executable.build_id.gnu"
+
+// symbolSource finds the file holding the symbols of a mapped file.
+type symbolSource interface {
+	find(buildID, filename string) (string, bool)
+}
+
+// localSymbols looks up symbol files in local directories, either by build ID in the
+// .build-id/xx/yyyy.debug layout, or by the file name of the mapping. Without directories,
+// the mapped file itself is used, as the server usually runs on the same node.
+type localSymbols struct {
+	dirs []string
+}
+
+func (l localSymbols) find(buildID, filename string) (string, bool) {
+	var candidates []string
+	for _, dir := range l.dirs {
+		if len(buildID) > 2 {
+			candidates = append(candidates, filepath.Join(dir, ".build-id", buildID[:2], buildID[2:]+".debug"))
+		}
+		if filename != "" {
+			candidates = append(candidates, filepath.Join(dir, filename), filepath.Join(dir, filepath.Base(filename)))
+		}
+	}
+	if filepath.IsAbs(filename) {
+		candidates = append(candidates, filename)
+	}
+
+	for _, c := range candidates {
+		if fi, err := os.Stat(c); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		if buildID != "" {
+			if id, err := readBuildID(c); err != nil || id != buildID {
+				continue
+			}
+		}
+		return c, true
+	}
+	return "", false
+}
+
+// symbolizer resolves the function names of frames that only have an address and a mapping.
+// The names are added to the dictionary as lines of the location, so all outputs show them.
+type symbolizer struct {
+	log     *slog.Logger
+	sources []symbolSource
+
+	mu sync.Mutex
+	// tables caches the symbol table by build ID and file name of the mapping.
+	tables map[[2]string]cachedSymbolTable
+}
+
+// symbolRetryInterval is the time after which the sources are asked again for a file they
+// didn't have, e.g. because it was still being downloaded.
+const symbolRetryInterval = 10 * time.Second
+
+type cachedSymbolTable struct {
+	// table is nil if no source had the file.
+	table *symbolTable
+	retry time.Time
+}
+
+func newSymbolizer(log *slog.Logger, sources ...symbolSource) *symbolizer {
+	return &symbolizer{
+		log:     log,
+		sources: sources,
+		tables:  map[[2]string]cachedSymbolTable{},
+	}
+}
+
+func (s *symbolizer) symbolize(pd pprofile.Profiles) {
+	dict := pd.Dictionary()
+	stringTable := dict.StringTable()
+	mappingTable := dict.MappingTable()
+	locationTable := dict.LocationTable()
+	lookup := dump.NewLookup(dict)
+
+	for i := 0; i < locationTable.Len(); i++ {
+		location := locationTable.At(i)
+		idx := int(location.MappingIndex())
+		if location.Lines().Len() > 0 || idx <= 0 || idx >= mappingTable.Len() {
+			continue
+		}
+		mapping := mappingTable.At(idx)
+		filename := lookup.String(mapping.FilenameStrindex())
+
+		table := s.table(mappingBuildID(dict, mapping), filename)
+		if table == nil {
+			continue
+		}
+		name, ok := table.lookup(table.fileAddress(mapping, location.Address()))
+		if !ok {
+			continue
+		}
+
+		fn := pprofile.NewFunction()
+		nameIdx, err := pprofile.SetString(stringTable, name)
+		if err != nil {
+			continue
+		}
+		fn.SetNameStrindex(nameIdx)
+		fn.SetSystemNameStrindex(nameIdx)
+		fn.SetFilenameStrindex(mapping.FilenameStrindex())
+		fnIdx, err := pprofile.SetFunction(dict.FunctionTable(), fn)
+		if err != nil {
+			continue
+		}
+		location.Lines().AppendEmpty().SetFunctionIndex(fnIdx)
+	}
+}
+
+// table returns the symbol table of the mapped file, loading it on first use.
+func (s *symbolizer) table(buildID, filename string) *symbolTable {
+	key := [2]string{buildID, filename}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.tables[key]; ok && (c.table != nil || time.Now().Before(c.retry)) {
+		return c.table
+	}
+	var table *symbolTable
+	for _, src := range s.sources {
+		path, ok := src.find(buildID, filename)
+		if !ok {
+			continue
+		}
+		t, err := loadSymbolTable(path)
+		if err != nil {
+			s.log.Warn("error loading symbols", slog.String("path", path), slog.Any("error", err.Error()))
+			continue
+		}
+		table = t
+		break
+	}
+	s.tables[key] = cachedSymbolTable{table: table, retry: time.Now().Add(symbolRetryInterval)}
+	return table
+}
+
+func mappingBuildID(dict pprofile.ProfilesDictionary, mapping pprofile.Mapping) string {
+	return dump.AttributeValue(mapping.AttributeIndices(), dict.AttributeTable(), dict.StringTable(), buildIDAttribute)
+}
+
+// symbolTable holds the function symbols of an ELF file, sorted by address.
+type symbolTable struct {
+	loads   []elf.ProgHeader
+	symbols []elf.Symbol
+}
+
+func loadSymbolTable(path string) (*symbolTable, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	syms, err := f.Symbols()
+	if err != nil || len(syms) == 0 {
+		syms, err = f.DynamicSymbols()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t := &symbolTable{}
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_LOAD {
+			t.loads = append(t.loads, p.ProgHeader)
+		}
+	}
+	for _, sym := range syms {
+		if elf.ST_TYPE(sym.Info) == elf.STT_FUNC && sym.Value != 0 {
+			t.symbols = append(t.symbols, sym)
+		}
+	}
+	if len(t.symbols) == 0 {
+		return nil, errors.New("no function symbols")
+	}
+	sort.Slice(t.symbols, func(i, j int) bool { return t.symbols[i].Value < t.symbols[j].Value })
+	return t, nil
+}
+
+// fileAddress converts the address of a frame to the virtual address in the ELF file. Addresses
+// within the memory range of the mapping are treated as runtime addresses, all others as
+// already relative to the file, as some profilers send them that way.
+func (t *symbolTable) fileAddress(mapping pprofile.Mapping, addr uint64) uint64 {
+	if mapping.MemoryStart() == 0 || addr < mapping.MemoryStart() || addr >= mapping.MemoryLimit() {
+		return addr
+	}
+	offset := addr - mapping.MemoryStart() + mapping.FileOffset()
+	for _, p := range t.loads {
+		if offset >= p.Off && offset < p.Off+p.Filesz {
+			return offset - p.Off + p.Vaddr
+		}
+	}
+	return addr
+}
+
+// lookup returns the name of the function containing addr.
+func (t *symbolTable) lookup(addr uint64) (string, bool) {
+	i := sort.Search(len(t.symbols), func(i int) bool { return t.symbols[i].Value > addr }) - 1
+	if i < 0 {
+		return "", false
+	}
+	sym := t.symbols[i]
+	if sym.Size > 0 && addr >= sym.Value+sym.Size {
+		return "", false
+	}
+	return sym.Name, true
+}
+
+// readBuildID returns the GNU build ID of an ELF file as hex.
+func readBuildID(path string) (string, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	for _, s := range f.Sections {
+		if s.Type != elf.SHT_NOTE {
+			continue
+		}
+		data, err := s.Data()
+		if err != nil {
+			continue
+		}
+		for len(data) >= 12 {
+			nameSize := int(f.ByteOrder.Uint32(data[0:4]))
+			descSize := int(f.ByteOrder.Uint32(data[4:8]))
+			noteType := f.ByteOrder.Uint32(data[8:12])
+			nameEnd := 12 + (nameSize+3)&^3
+			descEnd := nameEnd + (descSize+3)&^3
+			if descEnd > len(data) || nameEnd+descSize > len(data) {
+				break
+			}
+			if noteType == 3 && nameSize == 4 && string(data[12:15]) == "GNU" {
+				return hex.EncodeToString(data[nameEnd : nameEnd+descSize]), nil
+			}
+			data = data[descEnd:]
+		}
+	}
+	return "", errors.New("no GNU build ID")
+}
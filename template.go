@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+)
+
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"hex":   func(v uint64) string { return fmt.Sprintf("%#x", v) },
+}
+
+// profileTemplate renders received profiles via a text/template.
+type profileTemplate struct {
+	tmpl *template.Template
+}
+
+// parseProfileTemplate parses the template given either inline or as a file name, prefixed
+// with @.
+func parseProfileTemplate(text string) (*profileTemplate, error) {
+	if name, ok := strings.CutPrefix(text, "@"); ok {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading template: %w", err)
+		}
+		text = string(data)
+	}
+
+	tmpl, err := template.New("profile").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template: %w", err)
+	}
+	return &profileTemplate{tmpl: tmpl}, nil
+}
+
+func (t *profileTemplate) render(w io.Writer, config Config, pd pprofile.Profiles) error {
+	for _, view := range resolveProfiles(config, pd) {
+		if err := t.tmpl.Execute(w, view); err != nil {
+			return fmt.Errorf("error executing template: %w", err)
+		}
+	}
+	return nil
+}
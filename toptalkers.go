@@ -0,0 +1,152 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// topTalkerAttributes are the resource attributes shown to identify a top talker, in order.
+var topTalkerAttributes = []string{
+	"service.name", "k8s.namespace.name", "k8s.pod.name", "container.id", "host.name",
+	"process.executable.name", "process.pid",
+}
+
+// talker counts what a resource sent within the current interval.
+type talker struct {
+	attrs   string
+	samples int64
+	// bytes is the share of the request size by the share of samples of the resource.
+	bytes float64
+}
+
+// topTalkers periodically prints the resources sending the most samples and bytes, told apart
+// by the fingerprint of all their attributes, to find the workload a misbehaving profiler is
+// running on.
+type topTalkers struct {
+	k        int
+	interval time.Duration
+	out      io.Writer
+
+	mu        sync.Mutex
+	started   time.Time
+	resources map[string]*talker
+}
+
+func newTopTalkers(k int, interval time.Duration, out io.Writer) *topTalkers {
+	return &topTalkers{
+		k:         k,
+		interval:  interval,
+		out:       out,
+		started:   time.Now(),
+		resources: map[string]*talker{},
+	}
+}
+
+// record counts a request of size bytes on the wire.
+func (t *topTalkers) record(size int, pd pprofile.Profiles) {
+	rps := pd.ResourceProfiles()
+	totalSamples := 0
+	for i := 0; i < rps.Len(); i++ {
+		totalSamples += countSamples(rps.At(i))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := 0; i < rps.Len(); i++ {
+		attrs := rps.At(i).Resource().Attributes()
+		fingerprint := dump.Fingerprint(attrs)
+		r := t.resources[fingerprint]
+		if r == nil {
+			r = &talker{attrs: talkerAttributes(mapAttributes(attrs))}
+			t.resources[fingerprint] = r
+		}
+		samples := countSamples(rps.At(i))
+		r.samples += int64(samples)
+		if totalSamples > 0 {
+			r.bytes += float64(size) * float64(samples) / float64(totalSamples)
+		}
+	}
+}
+
+// talkerAttributes formats the identifying attributes of a resource.
+func talkerAttributes(attrs map[string]string) string {
+	var parts []string
+	for _, k := range topTalkerAttributes {
+		if v := attrs[k]; v != "" {
+			parts = append(parts, k+"="+v)
+		}
+	}
+	if len(parts) == 0 {
+		return "<no identifying attributes>"
+	}
+	return strings.Join(parts, " ")
+}
+
+// run prints the top talkers at the end of every interval until ctx is done.
+func (t *topTalkers) run(ctx context.Context) {
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.print(now)
+		}
+	}
+}
+
+// print writes the top talkers since the last print and resets the counts.
+func (t *topTalkers) print(now time.Time) {
+	t.mu.Lock()
+	resources := t.resources
+	elapsed := now.Sub(t.started).Seconds()
+	t.resources = map[string]*talker{}
+	t.started = now
+	t.mu.Unlock()
+
+	fmt.Fprintf(t.out, "------------- Top talkers (%s) -------------\n", now.Format(time.TimeOnly))
+	if len(resources) == 0 {
+		fmt.Fprintln(t.out, "  no profiles received")
+		return
+	}
+	fingerprints := make([]string, 0, len(resources))
+	for fingerprint := range resources {
+		fingerprints = append(fingerprints, fingerprint)
+	}
+
+	t.printTop("samples/s", fingerprints, resources, elapsed, func(a, b *talker) int {
+		return cmp.Compare(b.samples, a.samples)
+	})
+	t.printTop("bytes/s", fingerprints, resources, elapsed, func(a, b *talker) int {
+		return cmp.Compare(b.bytes, a.bytes)
+	})
+	fmt.Fprintf(t.out, "  %d resources in total\n", len(resources))
+}
+
+func (t *topTalkers) printTop(by string, fingerprints []string, resources map[string]*talker, elapsed float64, compare func(a, b *talker) int) {
+	slices.SortFunc(fingerprints, func(a, b string) int {
+		return cmp.Or(compare(resources[a], resources[b]), cmp.Compare(a, b))
+	})
+
+	fmt.Fprintf(t.out, "  By %s:\n", by)
+	tw := tabwriter.NewWriter(t.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "    RESOURCE\tSAMPLES/S\tBYTES/S\tATTRIBUTES")
+	for _, fingerprint := range fingerprints[:min(t.k, len(fingerprints))] {
+		r := resources[fingerprint]
+		fmt.Fprintf(tw, "    %s\t%.1f\t%.0f\t%s\n", fingerprint, float64(r.samples)/elapsed, r.bytes/elapsed, r.attrs)
+	}
+	tw.Flush()
+}
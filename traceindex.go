@@ -0,0 +1,162 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// traceAttributes are the sample attributes holding a trace ID, for senders that don't use
+// links.
+var traceAttributes = []string{"trace_id", "trace.id"}
+
+// traceSample is a sample referencing a trace.
+type traceSample struct {
+	ReceivedAt time.Time `json:"received_at"`
+	ProfileID  string    `json:"profile_id"`
+	SampleType string    `json:"sample_type"`
+	// Sample is the index of the sample in the profile.
+	Sample   int    `json:"sample"`
+	SpanID   string `json:"span_id,omitempty"`
+	Resource string `json:"resource"`
+	// Source is link or the attribute the trace ID was taken from.
+	Source string `json:"source"`
+}
+
+// traceIndex maps the trace IDs of recently received samples to the samples, to find out
+// whether there are samples for a trace. Entries expire after the window.
+type traceIndex struct {
+	window time.Duration
+
+	mu     sync.Mutex
+	traces map[string][]traceSample
+	// order holds the trace IDs in the order samples were added, to expire them.
+	order []traceSeen
+}
+
+type traceSeen struct {
+	traceID string
+	at      time.Time
+}
+
+func newTraceIndex(window time.Duration) *traceIndex {
+	return &traceIndex{
+		window: window,
+		traces: map[string][]traceSample{},
+	}
+}
+
+func (t *traceIndex) add(now time.Time, pd pprofile.Profiles) {
+	lookup := dump.NewLookup(pd.Dictionary())
+	var samples []traceSample
+	var traceIDs []string
+
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		resource := resourceName(mapAttributes(rps.At(i).Resource().Attributes()))
+		sps := rps.At(i).ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			pcs := sps.At(j).Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				profile := pcs.At(k)
+				for l, sample := range profile.Samples().All() {
+					ts := traceSample{
+						ReceivedAt: now,
+						ProfileID:  profile.ProfileID().String(),
+						SampleType: lookup.String(profile.SampleType().TypeStrindex()),
+						Sample:     l,
+						Resource:   resource,
+					}
+					var traceID string
+					if link, ok := lookup.Link(sample.LinkIndex()); ok && !link.TraceID().IsEmpty() {
+						traceID, ts.SpanID, ts.Source = link.TraceID().String(), link.SpanID().String(), "link"
+					} else {
+						for _, key := range traceAttributes {
+							if v := dump.AttributeValue(sample.AttributeIndices(), pd.Dictionary().AttributeTable(), pd.Dictionary().StringTable(), key); v != "" {
+								traceID, ts.Source = strings.ToLower(v), key
+								break
+							}
+						}
+					}
+					if traceID != "" {
+						samples = append(samples, ts)
+						traceIDs = append(traceIDs, traceID)
+					}
+				}
+			}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(now)
+	for i, traceID := range traceIDs {
+		t.traces[traceID] = append(t.traces[traceID], samples[i])
+		t.order = append(t.order, traceSeen{traceID: traceID, at: now})
+	}
+}
+
+// expire forgets the samples added before the window.
+func (t *traceIndex) expire(now time.Time) {
+	n := 0
+	for n < len(t.order) && now.Sub(t.order[n].at) > t.window {
+		seen := t.order[n]
+		samples := t.traces[seen.traceID]
+		drop := 0
+		for drop < len(samples) && !samples[drop].ReceivedAt.After(seen.at) {
+			drop++
+		}
+		if drop == len(samples) {
+			delete(t.traces, seen.traceID)
+		} else {
+			t.traces[seen.traceID] = samples[drop:]
+		}
+		n++
+	}
+	t.order = t.order[n:]
+}
+
+// lookup returns the samples referencing the trace.
+func (t *traceIndex) lookup(now time.Time, traceID string) []traceSample {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(now)
+	return append([]traceSample(nil), t.traces[strings.ToLower(traceID)]...)
+}
+
+// counts returns the number of samples by trace ID.
+func (t *traceIndex) counts(now time.Time) map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.expire(now)
+	out := make(map[string]int, len(t.traces))
+	for traceID, samples := range t.traces {
+		out[traceID] = len(samples)
+	}
+	return out
+}
+
+func (f *profilesServer) handleListTraces(w http.ResponseWriter, r *http.Request) {
+	if f.traces == nil {
+		http.Error(w, "trace index is disabled", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, f.traces.counts(time.Now()))
+}
+
+func (f *profilesServer) handleGetTrace(w http.ResponseWriter, r *http.Request) {
+	if f.traces == nil {
+		http.Error(w, "trace index is disabled", http.StatusServiceUnavailable)
+		return
+	}
+	samples := f.traces.lookup(time.Now(), r.PathValue("trace_id"))
+	if len(samples) == 0 {
+		http.Error(w, "no samples for this trace", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, samples)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// runTrim writes the profiles of a captured request matching the filters to a new request with
+// a re-indexed dictionary, to create small reproducers from large captures. It returns the exit
+// code of the process.
+func runTrim(args []string) int {
+	fs := flag.NewFlagSet("trim", flag.ExitOnError)
+	var profileIDs, sampleTypes, resourceAttrs stringSliceFlag
+	fs.Var(&profileIDs, "profile-id", "hex encoded ID of a profile to keep (repeatable, any of)")
+	fs.Var(&sampleTypes, "sample-type", "sample type of the profiles to keep (repeatable, any of)")
+	fs.Var(&resourceAttrs, "resource-attr", "key=value resource attribute the profiles to keep must have (repeatable)")
+	limit := fs.Int("limit", 0, "maximum number of profiles to keep (0 means no limit)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s trim [flags] <input> <output>\n\n", os.Args[0])
+		fmt.Fprintln(fs.Output(), "input and output are OTLP JSON files if their extension is .json, protobuf otherwise.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	attrs := map[string]string{}
+	for _, attr := range resourceAttrs {
+		key, value, ok := strings.Cut(attr, "=")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "invalid resource attribute filter %q, expected key=value\n", attr)
+			return 2
+		}
+		attrs[key] = value
+	}
+
+	in, out := fs.Arg(0), fs.Arg(1)
+	data, err := os.ReadFile(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading %s: %v\n", in, err)
+		return 1
+	}
+	request := pprofileotlp.NewExportRequest()
+	if filepath.Ext(in) == ".json" {
+		err = request.UnmarshalJSON(data)
+	} else {
+		err = request.UnmarshalProto(data)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error decoding %s: %v\n", in, err)
+		return 1
+	}
+
+	pd := request.Profiles()
+	lookup := dump.NewLookup(pd.Dictionary())
+	kept, total := 0, 0
+	trimmed := dump.Trim(pd, func(rp pprofile.ResourceProfiles, _ pprofile.ScopeProfiles, profile pprofile.Profile) bool {
+		total++
+		if *limit > 0 && kept >= *limit {
+			return false
+		}
+		if len(profileIDs) > 0 && !slices.Contains(profileIDs, profile.ProfileID().String()) {
+			return false
+		}
+		if len(sampleTypes) > 0 && !slices.Contains(sampleTypes, lookup.String(profile.SampleType().TypeStrindex())) {
+			return false
+		}
+		for key, value := range attrs {
+			if v, ok := rp.Resource().Attributes().Get(key); !ok || v.AsString() != value {
+				return false
+			}
+		}
+		kept++
+		return true
+	})
+
+	trimmedRequest := pprofileotlp.NewExportRequestFromProfiles(trimmed)
+	if filepath.Ext(out) == ".json" {
+		data, err = trimmedRequest.MarshalJSON()
+	} else {
+		data, err = trimmedRequest.MarshalProto()
+	}
+	if err == nil {
+		err = os.WriteFile(out, data, 0o644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error writing %s: %v\n", out, err)
+		return 1
+	}
+
+	fmt.Printf("Kept %d of %d profiles\n", kept, total)
+	fmt.Printf("  Before: %s\n", dump.CountDictionary(pd))
+	fmt.Printf("  After:  %s\n", dump.CountDictionary(trimmed))
+	return 0
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"cmp"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// unsymbolizedChecker warns about profiles in which the share of address-only frames exceeds
+// the threshold, which usually means stripped binaries or broken symbolization.
+type unsymbolizedChecker struct {
+	threshold float64
+}
+
+func (u unsymbolizedChecker) check(log *slog.Logger, pd pprofile.Profiles) {
+	dict := pd.Dictionary()
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rp := rps.At(i)
+		sps := rp.ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			pcs := sps.At(j).Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				profile := pcs.At(k)
+				stats := dump.CountFrames(dict, profile)
+				if stats.Total == 0 {
+					continue
+				}
+
+				unsymbolized := 0
+				for _, n := range stats.Unsymbolized {
+					unsymbolized += n
+				}
+				ratio := float64(unsymbolized) / float64(stats.Total)
+				if ratio <= u.threshold {
+					continue
+				}
+
+				// Worst mappings first.
+				files := slices.SortedFunc(maps.Keys(stats.Unsymbolized), func(a, b string) int {
+					return cmp.Or(cmp.Compare(stats.Unsymbolized[b], stats.Unsymbolized[a]), cmp.Compare(a, b))
+				})
+				var mappings []any
+				for _, f := range files {
+					mappings = append(mappings, slog.Int(f, stats.Unsymbolized[f]))
+				}
+				log.Warn("share of unsymbolized frames above threshold",
+					slog.String("resource", resourceName(mapAttributes(rp.Resource().Attributes()))),
+					slog.String("profile_id", profile.ProfileID().String()),
+					slog.Float64("ratio", ratio),
+					slog.Int("unsymbolized", unsymbolized),
+					slog.Int("frames", stats.Total),
+					slog.Group("mappings", mappings...))
+			}
+		}
+	}
+}
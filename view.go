@@ -0,0 +1,286 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"patrickpichler.dev/otel-profiles-debug-server/pkg/dump"
+)
+
+// profileView is a single profile with all dictionary references resolved. It is what templates
+// get executed with and what gets streamed to live subscribers.
+type profileView struct {
+	Resource   resourceView   `json:"resource"`
+	Scope      scopeView      `json:"scope"`
+	Profile    profileDetails `json:"profile"`
+	Dictionary dictionaryView `json:"-"`
+}
+
+type resourceView struct {
+	Attributes map[string]string `json:"attributes,omitempty"`
+	SchemaURL  string            `json:"schema_url,omitempty"`
+}
+
+type scopeView struct {
+	Name      string `json:"name,omitempty"`
+	Version   string `json:"version,omitempty"`
+	SchemaURL string `json:"schema_url,omitempty"`
+}
+
+type profileDetails struct {
+	ProfileID              string            `json:"profile_id,omitempty"`
+	Time                   time.Time         `json:"time"`
+	Duration               time.Duration     `json:"duration,omitempty"`
+	SampleType             string            `json:"sample_type,omitempty"`
+	SampleUnit             string            `json:"sample_unit,omitempty"`
+	PeriodType             string            `json:"period_type,omitempty"`
+	PeriodUnit             string            `json:"period_unit,omitempty"`
+	Period                 int64             `json:"period,omitempty"`
+	DroppedAttributesCount uint32            `json:"dropped_attributes_count,omitempty"`
+	Attributes             map[string]string `json:"attributes,omitempty"`
+	AttributeUnits         map[string]string `json:"attribute_units,omitempty"`
+	Samples                []sampleView      `json:"samples,omitempty"`
+}
+
+type sampleView struct {
+	Timestamps []time.Time       `json:"timestamps,omitempty"`
+	Values     []int64           `json:"values,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	// AttributeUnits holds the units of the attributes that have one.
+	AttributeUnits map[string]string `json:"attribute_units,omitempty"`
+	Frames         []frameView       `json:"frames,omitempty"`
+	// TraceID and SpanID are set if the sample is linked to a span.
+	TraceID string `json:"trace_id,omitempty"`
+	SpanID  string `json:"span_id,omitempty"`
+}
+
+// total returns the sum of the values of the sample, which are either one per timestamp or an
+// aggregate.
+func (s sampleView) total() int64 {
+	var total int64
+	for _, v := range s.Values {
+		total += v
+	}
+	return total
+}
+
+type frameView struct {
+	Type     string `json:"type,omitempty"`
+	Address  uint64 `json:"address,omitempty"`
+	Mapping  string `json:"mapping,omitempty"`
+	Function string `json:"function,omitempty"`
+	File     string `json:"file,omitempty"`
+	Line     int64  `json:"line,omitempty"`
+	Column   int64  `json:"column,omitempty"`
+	// Inlined is set for all but the last line of a location.
+	Inlined bool `json:"inlined,omitempty"`
+	// Attributes are the location attributes other than profile.frame.type, if
+	// -location-attributes is set.
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// dictionaryView gives templates access to raw dictionary lookups.
+type dictionaryView struct {
+	dict pprofile.ProfilesDictionary
+}
+
+func (d dictionaryView) String(idx int) string {
+	return dump.NewLookup(d.dict).String(int32(idx))
+}
+
+func (d dictionaryView) Attribute(idx int) string {
+	key, value := dump.NewLookup(d.dict).KeyValue(int32(idx), 0)
+	return key + "=" + value
+}
+
+// resolveProfiles resolves all dictionary references of the profiles matching the configured
+// filters.
+func resolveProfiles(config Config, pd pprofile.Profiles) []profileView {
+	var views []profileView
+
+	dict := pd.Dictionary()
+	lookup := dump.NewLookup(dict)
+
+	rps := pd.ResourceProfiles()
+	for i := 0; i < rps.Len(); i++ {
+		rp := rps.At(i)
+
+		if !dump.IncludeResource(config.Config, rp.Resource().Attributes()) {
+			continue
+		}
+		if config.IgnoreProfilesWithoutContainerID {
+			containerID, ok := rp.Resource().Attributes().Get("container.id")
+			if !ok || containerID.AsString() == "" {
+				continue
+			}
+		}
+
+		resource := resourceView{
+			Attributes: mapAttributes(rp.Resource().Attributes()),
+			SchemaURL:  rp.SchemaUrl(),
+		}
+
+		sps := rp.ScopeProfiles()
+		for j := 0; j < sps.Len(); j++ {
+			sp := sps.At(j)
+			if !dump.IncludeScope(config.Config, sp.Scope().Name()) {
+				continue
+			}
+			scope := scopeView{
+				Name:      sp.Scope().Name(),
+				Version:   sp.Scope().Version(),
+				SchemaURL: sp.SchemaUrl(),
+			}
+
+			pcs := sp.Profiles()
+			for k := 0; k < pcs.Len(); k++ {
+				profile := pcs.At(k)
+				sampleType := lookup.String(profile.SampleType().TypeStrindex())
+				if len(config.FilterSampleTypes) > 0 && !slices.Contains(config.FilterSampleTypes, sampleType) {
+					continue
+				}
+
+				data := profileView{
+					Resource: resource,
+					Scope:    scope,
+					Profile: profileDetails{
+						ProfileID:              profile.ProfileID().String(),
+						Time:                   profile.Time().AsTime(),
+						Duration:               time.Duration(profile.DurationNano()),
+						SampleType:             sampleType,
+						SampleUnit:             lookup.String(profile.SampleType().UnitStrindex()),
+						PeriodType:             lookup.String(profile.PeriodType().TypeStrindex()),
+						PeriodUnit:             lookup.String(profile.PeriodType().UnitStrindex()),
+						Period:                 profile.Period(),
+						DroppedAttributesCount: profile.DroppedAttributesCount(),
+						Attributes:             indexedAttributes(lookup, profile.AttributeIndices()),
+						AttributeUnits:         indexedAttributeUnits(lookup, profile.AttributeIndices()),
+					},
+					Dictionary: dictionaryView{dict: dict},
+				}
+
+				samples := profile.Samples()
+				for l := 0; l < samples.Len(); l++ {
+					sample := samples.At(l)
+					executableName := dump.AttributeValue(sample.AttributeIndices(), dict.AttributeTable(), dict.StringTable(), "process.executable.name")
+					if len(config.FilterExecutableNames) > 0 && !slices.Contains(config.FilterExecutableNames, executableName) {
+						continue
+					}
+					data.Profile.Samples = append(data.Profile.Samples, newSampleView(config, lookup, dict, sample))
+				}
+
+				views = append(views, data)
+			}
+		}
+	}
+
+	return views
+}
+
+func newSampleView(config Config, lookup dump.Lookup, dict pprofile.ProfilesDictionary, sample pprofile.Sample) sampleView {
+	s := sampleView{
+		Values:         sample.Values().AsRaw(),
+		Attributes:     indexedAttributes(lookup, sample.AttributeIndices()),
+		AttributeUnits: indexedAttributeUnits(lookup, sample.AttributeIndices()),
+	}
+	for _, ts := range sample.TimestampsUnixNano().All() {
+		s.Timestamps = append(s.Timestamps, time.Unix(0, int64(ts)))
+	}
+	if link, ok := lookup.Link(sample.LinkIndex()); ok {
+		s.TraceID = link.TraceID().String()
+		s.SpanID = link.SpanID().String()
+	}
+
+	stack, ok := lookup.Stack(sample.StackIndex())
+	if !ok {
+		return s
+	}
+	for _, locationIdx := range stack.LocationIndices().All() {
+		location, ok := lookup.Location(locationIdx)
+		if !ok {
+			s.Frames = append(s.Frames, frameView{Type: "unknown", Function: fmt.Sprintf("<invalid location %d>", locationIdx)})
+			continue
+		}
+		frameType := dump.FrameType(dict, location)
+		if len(config.ExportStackFrameTypes) > 0 && !slices.Contains(config.ExportStackFrameTypes, frameType) {
+			continue
+		}
+
+		frame := frameView{
+			Type:    frameType,
+			Address: location.Address(),
+		}
+		if config.ExportLocationAttributes {
+			frame.Attributes = indexedAttributes(lookup, location.AttributeIndices())
+			delete(frame.Attributes, "profile.frame.type")
+			if len(frame.Attributes) == 0 {
+				frame.Attributes = nil
+			}
+		}
+		if mapping, ok := lookup.Mapping(location.MappingIndex()); ok {
+			frame.Mapping = lookup.String(mapping.FilenameStrindex())
+		}
+
+		lines := location.Lines()
+		if lines.Len() == 0 {
+			s.Frames = append(s.Frames, frame)
+			continue
+		}
+		for n := 0; n < lines.Len(); n++ {
+			line := lines.At(n)
+			f := frame
+			if function, ok := lookup.Function(line.FunctionIndex()); ok {
+				f.Function = lookup.String(function.NameStrindex())
+				f.File = lookup.String(function.FilenameStrindex())
+			} else {
+				f.Function = fmt.Sprintf("<invalid function %d>", line.FunctionIndex())
+			}
+			f.Line = line.Line()
+			f.Column = line.Column()
+			f.Inlined = n < lines.Len()-1
+			s.Frames = append(s.Frames, f)
+		}
+	}
+
+	return s
+}
+
+func mapAttributes(attrs pcommon.Map) map[string]string {
+	m := make(map[string]string, attrs.Len())
+	attrs.Range(func(k string, v pcommon.Value) bool {
+		m[k] = v.AsString()
+		return true
+	})
+	return m
+}
+
+func indexedAttributes(lookup dump.Lookup, indices pcommon.Int32Slice) map[string]string {
+	m := make(map[string]string, indices.Len())
+	for _, idx := range indices.All() {
+		if attr, ok := lookup.Attribute(idx); ok {
+			m[lookup.String(attr.KeyStrindex())] = attr.Value().AsString()
+		}
+	}
+	return m
+}
+
+// indexedAttributeUnits returns the units of the attributes that have one, or nil.
+func indexedAttributeUnits(lookup dump.Lookup, indices pcommon.Int32Slice) map[string]string {
+	var m map[string]string
+	for _, idx := range indices.All() {
+		attr, ok := lookup.Attribute(idx)
+		if !ok {
+			continue
+		}
+		if unit := lookup.Unit(attr); unit != "" {
+			if m == nil {
+				m = map[string]string{}
+			}
+			m[lookup.String(attr.KeyStrindex())] = unit
+		}
+	}
+	return m
+}
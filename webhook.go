@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+)
+
+// webhookConfig configures posting received profiles to an HTTP endpoint.
+type webhookConfig struct {
+	URL string
+	// Format is json, posting every profile on its own, or proto, posting whole requests as
+	// OTLP protobuf.
+	Format  string
+	Retries int
+	Backoff time.Duration
+	Timeout time.Duration
+}
+
+func (c *webhookConfig) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.URL, "webhook-url", "", "URL to POST received profiles to")
+	fs.StringVar(&c.Format, "webhook-format", "json", "format of the webhook body (json: one POST per profile, proto: one POST per request as OTLP protobuf)")
+	fs.IntVar(&c.Retries, "webhook-retries", 3, "number of times a failed webhook POST is retried")
+	fs.DurationVar(&c.Backoff, "webhook-backoff", time.Second, "time to wait before the first webhook retry, doubled for every further one")
+	fs.DurationVar(&c.Timeout, "webhook-timeout", 10*time.Second, "timeout of a single webhook POST")
+}
+
+func (c webhookConfig) validate() error {
+	if c.Format != "json" && c.Format != "proto" {
+		return fmt.Errorf("unknown webhook format %q, expected json or proto", c.Format)
+	}
+	return nil
+}
+
+// webhookForwarder posts received profiles to an HTTP endpoint. Network errors, 429 and 5xx
+// responses are retried with exponential backoff.
+type webhookForwarder struct {
+	log    *slog.Logger
+	cfg    webhookConfig
+	config func() Config
+	client *http.Client
+}
+
+func newWebhookForwarder(log *slog.Logger, cfg webhookConfig, config func() Config) *webhookForwarder {
+	return &webhookForwarder{
+		log:    log,
+		cfg:    cfg,
+		config: config,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+func (w *webhookForwarder) forward(pd pprofile.Profiles) {
+	if w.cfg.Format == "proto" {
+		body, err := pprofileotlp.NewExportRequestFromProfiles(pd).MarshalProto()
+		if err != nil {
+			w.log.Error("error encoding request for webhook", slog.Any("error", err.Error()))
+			return
+		}
+		if err := w.post(body, "application/x-protobuf"); err != nil {
+			w.log.Error("error posting request to webhook", slog.Any("error", err.Error()))
+		}
+		return
+	}
+
+	for _, view := range resolveProfiles(w.config(), pd) {
+		body, err := json.Marshal(view)
+		if err != nil {
+			w.log.Error("error encoding profile for webhook",
+				slog.String("profile_id", view.Profile.ProfileID),
+				slog.Any("error", err.Error()))
+			continue
+		}
+		if err := w.post(body, "application/json"); err != nil {
+			w.log.Error("error posting profile to webhook",
+				slog.String("profile_id", view.Profile.ProfileID),
+				slog.Any("error", err.Error()))
+		}
+	}
+}
+
+// post sends the body, retrying failed attempts.
+func (w *webhookForwarder) post(body []byte, contentType string) error {
+	backoff := w.cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		retryable, err := w.postOnce(body, contentType)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= w.cfg.Retries {
+			return err
+		}
+		w.log.Warn("webhook post failed, retrying",
+			slog.Int("attempt", attempt+1),
+			slog.Duration("backoff", backoff),
+			slog.Any("error", err.Error()))
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// postOnce sends the body once. It returns whether a failure is worth retrying.
+func (w *webhookForwarder) postOnce(body []byte, contentType string) (bool, error) {
+	resp, err := w.client.Post(w.cfg.URL, contentType, bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, fmt.Errorf("unexpected status %s", resp.Status)
+}